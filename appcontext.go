@@ -3,26 +3,50 @@ package main
 import (
 	"errors"
 	"fmt"
+	"log"
 	"net/http"
+	"path"
+	"strings"
 
 	jwt "github.com/dgrijalva/jwt-go"
-	"github.com/idrum4316/devpad-server/internal/datastore"
+	"github.com/idrum4316/devpad-server/internal/backup"
+	"github.com/idrum4316/devpad-server/internal/collab"
+	"github.com/idrum4316/devpad-server/internal/event"
+	"github.com/idrum4316/devpad-server/internal/savedsearch"
 	"github.com/idrum4316/devpad-server/internal/search"
+	"github.com/idrum4316/devpad-server/internal/storage"
+	"github.com/idrum4316/devpad-server/internal/webhook"
 )
 
 // AppContext holds the overall application context (config, etc..)
 type AppContext struct {
-	Config *AppConfig
-	Index  *search.Index
-	Store  *datastore.Datastore
+	Config   *AppConfig
+	Index    *search.Index
+	Pages    storage.PageStore
+	Users    storage.UserStore
+	Meta     storage.MetaStore
+	Events   *event.Broker
+	Webhooks *webhook.Dispatcher
+	Collab   *collab.Manager
+	Backups  *backup.Scheduler
+	Indexer  *search.Indexer
+	Notifier *savedsearch.Notifier
 }
 
 // NewAppContext returns a pointer to a new AppContext with default values set.
 func NewAppContext() (a *AppContext) {
 	a = &AppContext{
-		Config: NewAppConfig(),
-		Index:  nil,
-		Store:  nil,
+		Config:   NewAppConfig(),
+		Index:    nil,
+		Pages:    nil,
+		Users:    nil,
+		Meta:     nil,
+		Events:   nil,
+		Webhooks: nil,
+		Collab:   nil,
+		Backups:  nil,
+		Indexer:  nil,
+		Notifier: nil,
 	}
 	return
 }
@@ -30,9 +54,8 @@ func NewAppContext() (a *AppContext) {
 // GetUserIDFromRequest returns the user id from the JWT token in the request
 func (a *AppContext) GetUserIDFromRequest(r *http.Request) (id string, err error) {
 
-	// Get the token from the HTTP headers. If it doesn't exist, return an
-	// error.
-	tokenHeader := r.Header.Get("jwt")
+	// Get the token from the request. If it doesn't exist, return an error.
+	tokenHeader := requestToken(r)
 	if tokenHeader == "" {
 		err = errors.New("missing jwt token")
 		return
@@ -60,3 +83,70 @@ func (a *AppContext) GetUserIDFromRequest(r *http.Request) (id string, err error
 	return
 
 }
+
+// requestToken returns the JWT token sent with the request. Browsers can't
+// set headers on WebSocket connections or EventSource streams, so those may
+// pass the token in the query string instead. It's redacted from the request
+// log.
+func requestToken(r *http.Request) string {
+
+	token := r.Header.Get("jwt")
+	if token == "" && (strings.EqualFold(r.Header.Get("Upgrade"), "websocket") ||
+		strings.Contains(r.Header.Get("Accept"), "text/event-stream")) {
+		token = r.URL.Query().Get("jwt")
+	}
+
+	return token
+
+}
+
+// PublishEvent hands an event to everything that listens for changes. Errors
+// are only logged, since the change the event describes has already been
+// saved by the time it is published.
+func (a *AppContext) PublishEvent(e *event.Event) {
+
+	if a.Events != nil {
+		err := a.Events.Publish(e)
+		if err != nil {
+			log.Println(err)
+		}
+	}
+
+	if a.Webhooks != nil {
+		err := a.Webhooks.Dispatch(e)
+		if err != nil {
+			log.Println(err)
+		}
+	}
+
+}
+
+// searchAnalysis returns how the search index analyzes the contents of pages
+func (a *AppContext) searchAnalysis() *search.Analysis {
+	return &search.Analysis{
+		Synonyms:  a.Config.SearchSynonyms,
+		StopWords: a.Config.SearchStopWords,
+	}
+}
+
+// indexPath returns where the search index is kept
+func (a *AppContext) indexPath() string {
+	return path.Join(a.Config.DataDir, "pages.index")
+}
+
+// sqlitePath returns where the SQLite database is kept
+func (a *AppContext) sqlitePath() string {
+	if a.Config.SQLitePath != "" {
+		return a.Config.SQLitePath
+	}
+	return path.Join(a.Config.DataDir, "devpad.sqlite")
+}
+
+// pagesDir returns where page files are kept when pages are stored on the
+// filesystem
+func (a *AppContext) pagesDir() string {
+	if a.Config.PagesDir != "" {
+		return a.Config.PagesDir
+	}
+	return path.Join(a.Config.DataDir, "pages")
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequestToken(t *testing.T) {
+
+	cases := []struct {
+		name    string
+		headers map[string]string
+		want    string
+	}{
+		{"header", map[string]string{"jwt": "from header"}, "from header"},
+		{"plain request", map[string]string{}, ""},
+		{"websocket", map[string]string{"Upgrade": "websocket"}, "from query"},
+		{"event stream", map[string]string{"Accept": "text/event-stream"}, "from query"},
+		{"header first", map[string]string{"jwt": "from header", "Accept": "text/event-stream"}, "from header"},
+	}
+
+	for _, c := range cases {
+		r := httptest.NewRequest("GET", "/api/events?jwt=from+query", nil)
+		for k, v := range c.headers {
+			r.Header.Set(k, v)
+		}
+		if got := requestToken(r); got != c.want {
+			t.Errorf("%s: expected %q, got %q", c.name, c.want, got)
+		}
+	}
+
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"errors"
+	"expvar"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"time"
+
+	"github.com/idrum4316/devpad-server/internal/backup"
+	"github.com/idrum4316/devpad-server/internal/cron"
+	"github.com/idrum4316/devpad-server/internal/datastore"
+	"github.com/idrum4316/devpad-server/internal/filestore"
+	"github.com/idrum4316/devpad-server/internal/sqlstore"
+)
+
+// Names of what's kept in a backup
+const (
+	backupBoltFile   = "devpad.db"
+	backupSQLiteFile = "devpad.sqlite"
+	backupPagesDir   = "pages"
+	backupIndexDir   = "pages.index"
+)
+
+// backupSnapshot is a consistent copy of the databases, kept in a temporary
+// directory until it's written out as a backup
+type backupSnapshot struct {
+	dir      string
+	manifest backup.Manifest
+}
+
+// snapshot copies the databases, and the search index if includeIndex is set,
+// so a backup can be made while the server keeps running. The snapshot must
+// be removed once it has been written.
+func (a *AppContext) snapshot(includeIndex bool) (*backupSnapshot, error) {
+
+	bolt, ok := a.Meta.(*datastore.Datastore)
+	if !ok {
+		return nil, errors.New("the datastore can't be backed up")
+	}
+
+	dir, err := ioutil.TempDir("", "devpad-backup-")
+	if err != nil {
+		return nil, err
+	}
+
+	s := backupSnapshot{
+		dir: dir,
+		manifest: backup.Manifest{
+			Created:       time.Now().UTC(),
+			ServerVersion: version,
+			Storage:       a.storageName(),
+			PageStorage:   a.pageStorageName(),
+			Index:         includeIndex,
+		},
+	}
+
+	// Page files are copied with writes paused, and the databases and the
+	// index are snapshotted during the pause so they all match
+	snapshotStores := func() error {
+
+		err := bolt.SnapshotTo(path.Join(dir, backupBoltFile))
+		if err != nil {
+			return err
+		}
+
+		if s.manifest.Storage == "sqlite" {
+			sqlStore, ok := a.Users.(*sqlstore.SQLStore)
+			if !ok {
+				return errors.New("the SQLite database can't be backed up")
+			}
+			err = sqlStore.SnapshotTo(path.Join(dir, backupSQLiteFile))
+			if err != nil {
+				return err
+			}
+		}
+
+		if includeIndex {
+			return a.Index.SnapshotTo(path.Join(dir, backupIndexDir))
+		}
+		return nil
+
+	}
+	if s.manifest.PageStorage == "filesystem" {
+		fs, ok := a.Pages.(*filestore.FileStore)
+		if !ok {
+			s.Remove()
+			return nil, errors.New("the page files can't be backed up")
+		}
+		err = fs.SnapshotTo(path.Join(dir, backupPagesDir), snapshotStores)
+	} else {
+		err = snapshotStores()
+	}
+	if err != nil {
+		s.Remove()
+		return nil, err
+	}
+
+	return &s, nil
+
+}
+
+// Write writes the snapshot to w as a backup archive
+func (s *backupSnapshot) Write(w io.Writer) error {
+
+	bw := backup.NewWriter(w, &s.manifest)
+
+	err := bw.AddFile(backupBoltFile, path.Join(s.dir, backupBoltFile))
+	if err != nil {
+		return err
+	}
+
+	if s.manifest.Storage == "sqlite" {
+		err = bw.AddFile(backupSQLiteFile, path.Join(s.dir, backupSQLiteFile))
+		if err != nil {
+			return err
+		}
+	}
+
+	if s.manifest.PageStorage == "filesystem" {
+		err = bw.AddDir(backupPagesDir, path.Join(s.dir, backupPagesDir))
+		if err != nil {
+			return err
+		}
+	}
+
+	if s.manifest.Index {
+		err = bw.AddDir(backupIndexDir, path.Join(s.dir, backupIndexDir))
+		if err != nil {
+			return err
+		}
+	}
+
+	return bw.Close()
+
+}
+
+// Remove removes the snapshot's temporary files
+func (s *backupSnapshot) Remove() {
+	os.RemoveAll(s.dir)
+}
+
+// storageName returns where pages and users are kept
+func (a *AppContext) storageName() string {
+	if a.Config.Storage == "" {
+		return "bolt"
+	}
+	return a.Config.Storage
+}
+
+// pageStorageName returns where pages are kept
+func (a *AppContext) pageStorageName() string {
+	if a.Config.PageStorage == "filesystem" {
+		return "filesystem"
+	}
+	return a.storageName()
+}
+
+// startBackupScheduler starts making backups on the configured schedule, if
+// there is one, and publishes the scheduler's status as metrics. The returned
+// function stops it.
+func (a *AppContext) startBackupScheduler() (func(), error) {
+
+	if a.Config.BackupSchedule == "" {
+		return func() {}, nil
+	}
+
+	schedule, err := cron.Parse(a.Config.BackupSchedule)
+	if err != nil {
+		return nil, err
+	}
+
+	dir := a.Config.BackupDir
+	if dir == "" {
+		dir = path.Join(a.Config.DataDir, "backups")
+	}
+
+	a.Backups = backup.NewScheduler(dir, schedule, func(w io.Writer) error {
+		s, err := a.snapshot(a.Config.BackupIndex)
+		if err != nil {
+			return err
+		}
+		defer s.Remove()
+		return s.Write(w)
+	})
+	a.Backups.KeepDaily = a.Config.BackupKeepDaily
+	a.Backups.KeepWeekly = a.Config.BackupKeepWeekly
+
+	expvar.Publish("backups", expvar.Func(func() interface{} {
+		return a.Backups.Metrics()
+	}))
+
+	a.Backups.Start()
+	return a.Backups.Stop, nil
+
+}
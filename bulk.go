@@ -0,0 +1,390 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/idrum4316/devpad-server/internal/event"
+	"github.com/idrum4316/devpad-server/internal/page"
+	"github.com/idrum4316/devpad-server/internal/storage"
+)
+
+// How many operations are applied at a time in best-effort mode
+const bulkChunkSize = 100
+
+// The operations a bulk request can have
+const (
+	bulkUpsert = "upsert"
+	bulkDelete = "delete"
+	bulkRename = "rename"
+)
+
+// What became of an operation in a bulk request
+const (
+	bulkCreated  = "created"
+	bulkUpdated  = "updated"
+	bulkDeleted  = "deleted"
+	bulkRenamed  = "renamed"
+	bulkNotFound = "not_found"
+	bulkFailed   = "failed"
+	bulkAborted  = "aborted"
+)
+
+// bulkOp is one line of a bulk request. Upserts have the page, and renames
+// have the slug it's moved to.
+type bulkOp struct {
+	Op   string          `json:"op"`
+	Slug string          `json:"slug"`
+	To   string          `json:"to,omitempty"`
+	Page json.RawMessage `json:"page,omitempty"`
+}
+
+// bulkResult is what became of one operation
+type bulkResult struct {
+	Index  int    `json:"index"`
+	Op     string `json:"op"`
+	Slug   string `json:"slug"`
+	To     string `json:"to,omitempty"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// bulkReport is what a bulk request did
+type bulkReport struct {
+	Atomic  bool          `json:"atomic"`
+	Applied int           `json:"applied"`
+	Failed  int           `json:"failed"`
+	Results []*bulkResult `json:"results"`
+}
+
+// bulkChange is an operation that passed its checks, ready to be applied
+type bulkChange struct {
+	result *bulkResult
+	op     *storage.PageOp
+	page   *page.Page
+}
+
+// errBulkAborted is returned when an atomic bulk request isn't applied
+// because some of its operations failed their checks
+var errBulkAborted = errors.New("some operations failed, so none were applied")
+
+// applyBulk checks a bulk request's operations against the pages as they'd
+// be after the ones before them, then applies the ones that pass. Atomic
+// requests are applied in one transaction, and not at all if any operation
+// fails. Otherwise they're checked and applied in chunks, and an operation
+// that fails doesn't stop the others. The changes are indexed in one batch.
+func (a *AppContext) applyBulk(ops []*bulkOp, atomic bool, actor string) (*bulkReport, error) {
+
+	report := bulkReport{
+		Atomic:  atomic,
+		Results: make([]*bulkResult, len(ops)),
+	}
+
+	var applied []*bulkChange
+	if atomic {
+		changes, err := a.planBulk(ops, 0, report.Results)
+		if err != nil {
+			return nil, err
+		}
+
+		failed := len(ops) - len(changes)
+		if failed > 0 {
+			for _, c := range changes {
+				c.result.Status = bulkAborted
+			}
+			report.Failed = failed
+			return &report, errBulkAborted
+		}
+
+		pageOps := []*storage.PageOp{}
+		for _, c := range changes {
+			if c.op != nil {
+				pageOps = append(pageOps, c.op)
+			}
+		}
+		err = a.Pages.(storage.PageBatcher).ApplyPageOps(pageOps)
+		if err != nil {
+			return nil, err
+		}
+		applied = changes
+	} else {
+		var err error
+		applied, err = a.applyBulkChunks(ops, report.Results)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Index what changed, in order, so the last change to a page wins
+	indexed := map[string]*page.Page{}
+	for _, c := range applied {
+		switch c.result.Status {
+		case bulkCreated, bulkUpdated:
+			indexed[c.op.ID] = c.page
+		case bulkDeleted:
+			indexed[c.op.ID] = nil
+		case bulkRenamed:
+			indexed[c.op.ID] = nil
+			indexed[c.op.NewID] = c.page
+		}
+	}
+	err := a.indexPages(indexed)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, c := range applied {
+		a.publishBulkEvent(c, actor)
+	}
+
+	for _, res := range report.Results {
+		if res.Status == bulkFailed {
+			report.Failed++
+		} else {
+			report.Applied++
+		}
+	}
+
+	return &report, nil
+
+}
+
+// planBulk checks each operation, filling in its result, and returns the
+// changes for the ones that pass. Pages are looked up as they'd be after the
+// operations before them. The operations are numbered from first.
+func (a *AppContext) planBulk(ops []*bulkOp, first int,
+	results []*bulkResult) ([]*bulkChange, error) {
+
+	// Pages the operations so far have written, or deleted (nil)
+	pending := map[string]*page.Page{}
+	lookup := func(slug string) (*page.Page, error) {
+		if p, ok := pending[slug]; ok {
+			return p, nil
+		}
+		return a.Pages.GetPage(slug)
+	}
+
+	changes := []*bulkChange{}
+	for n, op := range ops {
+		res := &bulkResult{Index: first + n, Op: op.Op, Slug: op.Slug, To: op.To}
+		results[n] = res
+
+		fail := func(format string, args ...interface{}) {
+			res.Status = bulkFailed
+			res.Error = fmt.Sprintf(format, args...)
+		}
+
+		if op.Slug == "" {
+			fail("missing slug")
+			continue
+		}
+
+		existing, err := lookup(op.Slug)
+		if err != nil {
+			return nil, err
+		}
+
+		switch op.Op {
+		case bulkUpsert:
+			if len(op.Page) == 0 {
+				fail("missing page")
+				continue
+			}
+			pg := page.New()
+			err = json.Unmarshal(op.Page, pg)
+			if err != nil {
+				fail("unable to decode page: %s", err)
+				continue
+			}
+			pg.Metadata.Modified = time.Now()
+
+			res.Status = bulkUpdated
+			if existing == nil {
+				res.Status = bulkCreated
+			}
+			pending[op.Slug] = pg
+			changes = append(changes, &bulkChange{
+				result: res,
+				op:     &storage.PageOp{Type: storage.OpPut, ID: op.Slug, Page: pg},
+				page:   pg,
+			})
+
+		case bulkDelete:
+			// Deleting a page that doesn't exist isn't an error
+			if existing == nil {
+				res.Status = bulkNotFound
+				changes = append(changes, &bulkChange{result: res})
+				continue
+			}
+			res.Status = bulkDeleted
+			pending[op.Slug] = nil
+			changes = append(changes, &bulkChange{
+				result: res,
+				op:     &storage.PageOp{Type: storage.OpDelete, ID: op.Slug},
+				page:   existing,
+			})
+
+		case bulkRename:
+			if op.To == "" || op.To == op.Slug {
+				fail("missing or unchanged 'to' slug")
+				continue
+			}
+			if existing == nil {
+				fail("could not find page %s", op.Slug)
+				continue
+			}
+			target, err := lookup(op.To)
+			if err != nil {
+				return nil, err
+			}
+			if target != nil {
+				fail("page %s already exists", op.To)
+				continue
+			}
+			res.Status = bulkRenamed
+			pending[op.Slug] = nil
+			pending[op.To] = existing
+			changes = append(changes, &bulkChange{
+				result: res,
+				op:     &storage.PageOp{Type: storage.OpRename, ID: op.Slug, NewID: op.To},
+				page:   existing,
+			})
+
+		default:
+			fail("unknown operation %q", op.Op)
+		}
+	}
+
+	return changes, nil
+
+}
+
+// applyBulkChunks checks and applies operations a chunk at a time, filling
+// in their results, and returns the changes that were applied. When a chunk
+// fails, none of it is applied, so its operations are checked again one at a
+// time against the pages as they are, and applied on their own. That way only
+// the ones that fail are reported as failed, and the others are reported as
+// what they really did. Stores that can't make changes in one transaction are
+// only ever given one at a time.
+func (a *AppContext) applyBulkChunks(ops []*bulkOp, results []*bulkResult) ([]*bulkChange, error) {
+
+	size := bulkChunkSize
+	if _, ok := a.Pages.(storage.PageBatcher); !ok {
+		size = 1
+	}
+
+	applied := []*bulkChange{}
+	for start := 0; start < len(ops); start += size {
+		end := start + size
+		if end > len(ops) {
+			end = len(ops)
+		}
+
+		changes, err := a.planBulk(ops[start:end], start, results[start:end])
+		if err != nil {
+			return nil, err
+		}
+
+		err = a.applyPageOps(changes)
+		if err == nil {
+			applied = append(applied, changes...)
+			continue
+		}
+		if end-start == 1 {
+			for _, c := range changes {
+				c.result.Status = bulkFailed
+				c.result.Error = err.Error()
+			}
+			continue
+		}
+
+		for n := start; n < end; n++ {
+			changes, err := a.planBulk(ops[n:n+1], n, results[n:n+1])
+			if err != nil {
+				return nil, err
+			}
+
+			err = a.applyPageOps(changes)
+			if err != nil {
+				for _, c := range changes {
+					c.result.Status = bulkFailed
+					c.result.Error = err.Error()
+				}
+				continue
+			}
+			applied = append(applied, changes...)
+		}
+	}
+
+	return applied, nil
+
+}
+
+// applyPageOps makes the changes to the page store, in one transaction if
+// the store can do that
+func (a *AppContext) applyPageOps(changes []*bulkChange) error {
+
+	ops := []*storage.PageOp{}
+	for _, c := range changes {
+		if c.op != nil {
+			ops = append(ops, c.op)
+		}
+	}
+	if len(ops) == 0 {
+		return nil
+	}
+
+	if b, ok := a.Pages.(storage.PageBatcher); ok {
+		return b.ApplyPageOps(ops)
+	}
+
+	for _, op := range ops {
+		var err error
+		switch op.Type {
+		case storage.OpPut:
+			err = a.Pages.PutPages(map[string]*page.Page{op.ID: op.Page})
+		case storage.OpDelete:
+			err = a.Pages.DeletePage(op.ID)
+		case storage.OpRename:
+			err = a.Pages.RenamePage(op.ID, op.NewID)
+		default:
+			err = fmt.Errorf("unknown page operation %q", op.Type)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+
+}
+
+// publishBulkEvent publishes the event for a change that was applied
+func (a *AppContext) publishBulkEvent(c *bulkChange, actor string) {
+
+	var e *event.Event
+	switch c.result.Status {
+	case bulkCreated:
+		e = event.New(event.PageCreated, actor)
+		e.Slug = c.op.ID
+	case bulkUpdated:
+		e = event.New(event.PageUpdated, actor)
+		e.Slug = c.op.ID
+	case bulkDeleted:
+		e = event.New(event.PageDeleted, actor)
+		e.Slug = c.op.ID
+	case bulkRenamed:
+		e = event.New(event.PageRenamed, actor)
+		e.Slug = c.op.NewID
+		e.OldSlug = c.op.ID
+	default:
+		return
+	}
+
+	e.Title = c.page.Metadata.Title
+	e.Tags = c.page.Metadata.Tags
+	a.PublishEvent(e)
+
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/idrum4316/devpad-server/internal/memstore"
+	"github.com/idrum4316/devpad-server/internal/page"
+	"github.com/idrum4316/devpad-server/internal/search"
+	"github.com/idrum4316/devpad-server/internal/storage"
+)
+
+// brokenStore refuses every batch that writes the page "broken", even
+// though the operation passes its checks
+type brokenStore struct {
+	*memstore.MemStore
+}
+
+func (s brokenStore) ApplyPageOps(ops []*storage.PageOp) error {
+	for _, op := range ops {
+		if op.ID == "broken" || op.NewID == "broken" {
+			return errors.New("the store refused the page")
+		}
+	}
+	return s.MemStore.ApplyPageOps(ops)
+}
+
+func TestApplyBulk(t *testing.T) {
+
+	upsert := func(slug string, title string) *bulkOp {
+		p := page.New()
+		p.Metadata.Title = title
+		pageBytes, err := json.Marshal(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &bulkOp{Op: bulkUpsert, Slug: slug, Page: pageBytes}
+	}
+	rename := func(slug string, to string) *bulkOp {
+		return &bulkOp{Op: bulkRename, Slug: slug, To: to}
+	}
+	del := func(slug string) *bulkOp {
+		return &bulkOp{Op: bulkDelete, Slug: slug}
+	}
+
+	cases := []struct {
+		name     string
+		atomic   bool
+		ops      []*bulkOp
+		err      error
+		statuses []string
+
+		// Whether each page exists afterwards, in the store and the index
+		pages map[string]bool
+	}{
+		{
+			name:     "rename after upsert",
+			atomic:   true,
+			ops:      []*bulkOp{upsert("a", "A"), rename("a", "b"), upsert("existing", "Changed")},
+			statuses: []string{bulkCreated, bulkRenamed, bulkUpdated},
+			pages:    map[string]bool{"a": false, "b": true, "existing": true},
+		},
+		{
+			name:     "rename after upsert, in chunks",
+			ops:      []*bulkOp{upsert("a", "A"), rename("a", "b"), del("missing")},
+			statuses: []string{bulkCreated, bulkRenamed, bulkNotFound},
+			pages:    map[string]bool{"a": false, "b": true},
+		},
+		{
+			name:     "aborted atomic run",
+			atomic:   true,
+			ops:      []*bulkOp{upsert("a", "A"), rename("missing", "b"), del("existing")},
+			err:      errBulkAborted,
+			statuses: []string{bulkAborted, bulkFailed, bulkAborted},
+			pages:    map[string]bool{"a": false, "b": false, "existing": true},
+		},
+		{
+			name:     "failed chunk",
+			ops:      []*bulkOp{upsert("a", "A"), upsert("broken", "B"), rename("existing", "c")},
+			statuses: []string{bulkCreated, bulkFailed, bulkRenamed},
+			pages:    map[string]bool{"a": true, "broken": false, "existing": false, "c": true},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+
+			store := brokenStore{memstore.New()}
+			err := store.UpdatePage(page.New(), "existing")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			index, err := search.NewIndex(filepath.Join(t.TempDir(), "index"), &search.Analysis{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer index.Close()
+			err = index.IndexPage("existing", page.New())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			a := NewAppContext()
+			a.Pages = store
+			a.Index = index
+
+			report, err := a.applyBulk(c.ops, c.atomic, "tester")
+			if err != c.err {
+				t.Fatalf("expected error %v, got %v", c.err, err)
+			}
+			for n, want := range c.statuses {
+				if got := report.Results[n].Status; got != want {
+					t.Errorf("operation %d: expected %s, got %s (%s)", n, want, got,
+						report.Results[n].Error)
+				}
+			}
+
+			for slug, want := range c.pages {
+				p, err := store.GetPage(slug)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if (p != nil) != want {
+					t.Errorf("expected page %s to exist: %v", slug, want)
+				}
+				indexed, err := index.HasPage(slug)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if indexed != want {
+					t.Errorf("expected page %s to be indexed: %v", slug, want)
+				}
+			}
+
+		})
+	}
+
+}
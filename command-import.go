@@ -0,0 +1,88 @@
+package main
+
+import (
+	"archive/zip"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/idrum4316/devpad-server/internal/archive"
+)
+
+// importCommand imports a directory of Markdown files, or a zip archive of
+// them. The server must not be running.
+func importCommand(a *AppContext, args []string) error {
+
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	overwrite := flags.Bool("overwrite", false, "replace pages that already exist")
+	folderTags := flags.Bool("folder-tags", true, "tag files without front matter with their folder names")
+	actor := flags.String("user", "", "the user the changes are made as")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: devpad-server import [flags] <directory or .zip>")
+		flags.PrintDefaults()
+	}
+
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errors.New("import needs a directory or zip archive")
+	}
+	source := flags.Arg(0)
+	opts := archive.Options{FolderTags: *folderTags}
+
+	info, err := os.Stat(source)
+	if err != nil {
+		return err
+	}
+
+	var entries []*archive.Entry
+	var skipped []*archive.Skipped
+	if info.IsDir() {
+		entries, skipped, err = archive.ReadDir(source, opts)
+	} else {
+		var zr *zip.ReadCloser
+		zr, err = zip.OpenReader(source)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		entries, skipped, err = archive.ReadZip(&zr.Reader, opts)
+	}
+	if err != nil {
+		return err
+	}
+
+	closeStores, err := a.openStores()
+	if err != nil {
+		return err
+	}
+	defer closeStores()
+
+	report, err := a.importPages(entries, skipped, *overwrite, *actor)
+	printImportReport(report)
+	if err != nil {
+		return err
+	}
+
+	return a.flushIndex()
+
+}
+
+// printImportReport prints what an import did
+func printImportReport(r *importReport) {
+
+	for _, s := range r.Skipped {
+		fmt.Printf("skipped    %s: %s\n", s.Path, s.Reason)
+	}
+	for _, c := range r.Conflicted {
+		fmt.Printf("conflicted %s (%s): %s\n", c.Path, c.Slug, c.Reason)
+	}
+
+	fmt.Printf("%d created, %d updated, %d skipped, %d conflicted\n", len(r.Created),
+		len(r.Updated), len(r.Skipped), len(r.Conflicted))
+
+}
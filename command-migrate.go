@@ -0,0 +1,167 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"path"
+	"sort"
+
+	"github.com/idrum4316/devpad-server/internal/datastore"
+	"github.com/idrum4316/devpad-server/internal/page"
+	"github.com/idrum4316/devpad-server/internal/sqlstore"
+	"github.com/idrum4316/devpad-server/internal/storage"
+	"github.com/idrum4316/devpad-server/internal/user"
+)
+
+// migrateSQLiteCommand copies every page and user from devpad.db into the
+// SQLite database, then reads both back and checks that the row counts and
+// content hashes match. The server must not be running.
+func migrateSQLiteCommand(a *AppContext, args []string) error {
+
+	if len(args) > 0 {
+		return errors.New("migrate-sqlite doesn't take any arguments")
+	}
+
+	boltPath := path.Join(a.Config.DataDir, "devpad.db")
+	src, err := datastore.New(boltPath)
+	if err != nil {
+		return fmt.Errorf("open %s (is the server still running?): %s", boltPath, err)
+	}
+	defer src.Close()
+
+	dst, err := sqlstore.New(a.sqlitePath())
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	log.Printf("Copying %s to %s.", boltPath, a.sqlitePath())
+	err = dst.CopyFrom(src, src)
+	if err != nil {
+		return err
+	}
+
+	want, err := digestStore(src, src)
+	if err != nil {
+		return err
+	}
+	got, err := digestStore(dst, dst)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("bolt:   %d pages, %d users, sha256 %x", len(want.pages),
+		len(want.users), want.sum())
+	log.Printf("sqlite: %d pages, %d users, sha256 %x", len(got.pages),
+		len(got.users), got.sum())
+
+	mismatches := want.diff(got)
+	for _, m := range mismatches {
+		log.Println("mismatch:", m)
+	}
+	if len(mismatches) > 0 {
+		return fmt.Errorf("the copy doesn't match: %d mismatches", len(mismatches))
+	}
+
+	log.Println("The copy matches. Set Storage = \"sqlite\" in config.toml to use it.")
+	return nil
+
+}
+
+// storeDigest holds a hash of every page and user in a store
+type storeDigest struct {
+	pages map[string][sha256.Size]byte
+	users map[string][sha256.Size]byte
+}
+
+// digestStore hashes every page and user. Modification times are compared in
+// UTC, so a different time zone doesn't count as a change.
+func digestStore(pages storage.PageStore, users storage.UserStore) (*storeDigest, error) {
+
+	d := storeDigest{
+		pages: map[string][sha256.Size]byte{},
+		users: map[string][sha256.Size]byte{},
+	}
+
+	err := pages.ForEachPage(func(id string, p *page.Page) error {
+		p.Metadata.Modified = p.Metadata.Modified.UTC()
+		b, err := json.Marshal(p)
+		if err != nil {
+			return err
+		}
+		d.pages[id] = sha256.Sum256(b)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = users.ForEachUser(func(u *user.User) error {
+		b, err := json.Marshal(u)
+		if err != nil {
+			return err
+		}
+		d.users[u.ID] = sha256.Sum256(b)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &d, nil
+
+}
+
+// sum combines the hashes into one, in id order
+func (d *storeDigest) sum() []byte {
+
+	h := sha256.New()
+	for _, set := range []map[string][sha256.Size]byte{d.pages, d.users} {
+		ids := []string{}
+		for id := range set {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+
+		for _, id := range ids {
+			sum := set[id]
+			h.Write([]byte(id))
+			h.Write(sum[:])
+		}
+	}
+
+	return h.Sum(nil)
+
+}
+
+// diff describes every page and user that is missing or different in other
+func (d *storeDigest) diff(other *storeDigest) []string {
+
+	diffs := []string{}
+
+	compare := func(kind string, want, got map[string][sha256.Size]byte) {
+		for id, sum := range want {
+			otherSum, ok := got[id]
+			if !ok {
+				diffs = append(diffs, fmt.Sprintf("%s %q is missing", kind, id))
+			} else if otherSum != sum {
+				diffs = append(diffs, fmt.Sprintf("%s %q is different", kind, id))
+			}
+		}
+		for id := range got {
+			if _, ok := want[id]; !ok {
+				diffs = append(diffs, fmt.Sprintf("%s %q is extra", kind, id))
+			}
+		}
+	}
+
+	compare("page", d.pages, other.pages)
+	compare("user", d.users, other.users)
+
+	sort.Strings(diffs)
+	return diffs
+
+}
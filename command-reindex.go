@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"os"
+
+	"github.com/idrum4316/devpad-server/internal/search"
+)
+
+// reindexCommand rebuilds the search index from the stored pages, with the
+// current mapping and analysis. An index that can't be opened at all, because
+// it's corrupted, is thrown away first. The server must not be running; while
+// it is, the reindex endpoint does the same.
+func reindexCommand(a *AppContext, args []string) error {
+
+	if len(args) > 0 {
+		return errors.New("reindex doesn't take any arguments")
+	}
+
+	err := a.ensureStopped()
+	if err != nil {
+		return err
+	}
+
+	// Bad settings shouldn't look like a corrupted index
+	analysis := a.searchAnalysis()
+	err = analysis.Check()
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(a.indexPath()); err == nil {
+		index, err := search.NewIndex(a.indexPath(), analysis)
+		if err != nil {
+			log.Printf("The search index can't be opened (%s), so it's replaced.", err)
+			err = os.RemoveAll(a.indexPath())
+			if err != nil {
+				return err
+			}
+		} else {
+			index.Close()
+		}
+	}
+
+	closeStores, err := a.openStores()
+	if err != nil {
+		return err
+	}
+	defer closeStores()
+
+	err = a.Index.Rebuild(a.Pages.ForEachPage, logProgress("Indexed"))
+	if err != nil {
+		return err
+	}
+	log.Printf("Indexed %d pages.", a.Index.RebuildProgress().Indexed)
+
+	return nil
+
+}
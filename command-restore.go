@@ -0,0 +1,380 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+
+	"github.com/idrum4316/devpad-server/internal/backup"
+)
+
+// restoreCommand restores a backup made by the backup endpoint. The archive is
+// checked against its manifest before anything is put in place, and existing
+// data is only replaced with -force. If any part can't be put in place, the
+// parts that were are rolled back. The search index is rebuilt from the
+// restored pages, unless -keep-index is given and the backup has one. The
+// server must not be running.
+func restoreCommand(a *AppContext, args []string) error {
+
+	flags := flag.NewFlagSet("restore", flag.ContinueOnError)
+	force := flags.Bool("force", false, "replace the data that's already there")
+	keepIndex := flags.Bool("keep-index", false, "use the backup's search index, and repair it, instead of rebuilding it")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: devpad-server restore [flags] <backup.tar>")
+		flags.PrintDefaults()
+	}
+
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errors.New("restore needs a backup archive")
+	}
+
+	targets := a.restoreTargets()
+
+	existing := []string{}
+	for _, target := range targets {
+		if _, err := os.Stat(target); err == nil {
+			existing = append(existing, target)
+		}
+	}
+	sort.Strings(existing)
+	if len(existing) > 0 && !*force {
+		return fmt.Errorf("%s already exists; use -force to replace it", existing[0])
+	}
+
+	err = a.ensureStopped()
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// The backup is extracted next to the data directory first, and only
+	// moved next to each part's target once it has been checked
+	parent := filepath.Dir(filepath.Clean(a.Config.DataDir))
+	err = os.MkdirAll(parent, 0700)
+	if err != nil {
+		return err
+	}
+	staging, err := ioutil.TempDir(parent, ".devpad-restore-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(staging)
+
+	manifest, err := backup.Extract(bufio.NewReader(f), staging)
+	if err != nil {
+		return fmt.Errorf("%s: %s", flags.Arg(0), err)
+	}
+	log.Printf("Checked %d files in the backup made %s.", len(manifest.Files),
+		manifest.Created.Local().Format("2006-01-02 15:04:05"))
+
+	if manifest.Storage != a.storageName() || manifest.PageStorage != a.pageStorageName() {
+		return fmt.Errorf("the backup was made with Storage = %q and pages in %q, but "+
+			"this server has Storage = %q and pages in %q", manifest.Storage,
+			manifest.PageStorage, a.storageName(), a.pageStorageName())
+	}
+
+	// An index that's going to be rebuilt anyway isn't restored
+	keep := manifest.Index && *keepIndex
+	if !keep {
+		err = os.RemoveAll(filepath.Join(staging, backupIndexDir))
+		if err != nil {
+			return err
+		}
+	}
+
+	names := []string{}
+	for name := range targets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	parts := []*restorePart{}
+	defer func() {
+		for _, p := range parts {
+			p.cleanUp()
+		}
+	}()
+	for _, name := range names {
+		p, err := stagePart(filepath.Join(staging, name), targets[name])
+		if err != nil {
+			return err
+		}
+		parts = append(parts, p)
+	}
+
+	err = swapParts(parts)
+	if err != nil {
+		return err
+	}
+
+	closeStores, err := a.openStores()
+	if err != nil {
+		return err
+	}
+	defer closeStores()
+
+	// The index in the backup was copied at about the same time as the
+	// pages, but not in the same transaction, so it's checked against them
+	if keep {
+		report, err := a.checkIndex(true)
+		if err != nil {
+			return err
+		}
+		log.Printf("Restored the backup, and repaired %d pages in its search index.",
+			report.Drift())
+		return nil
+	}
+
+	err = a.Index.Rebuild(a.Pages.ForEachPage, logProgress("Indexed"))
+	if err != nil {
+		return err
+	}
+	log.Printf("Restored the backup, and indexed %d pages.", a.Index.RebuildProgress().Indexed)
+
+	return nil
+
+}
+
+// restoreTargets returns where each part of a backup is restored to
+func (a *AppContext) restoreTargets() map[string]string {
+
+	targets := map[string]string{
+		backupBoltFile: path.Join(a.Config.DataDir, "devpad.db"),
+		backupIndexDir: a.indexPath(),
+	}
+	if a.storageName() == "sqlite" {
+		targets[backupSQLiteFile] = a.sqlitePath()
+	}
+	if a.pageStorageName() == "filesystem" {
+		targets[backupPagesDir] = a.pagesDir()
+	}
+
+	return targets
+
+}
+
+// restorePart is a part of a backup on its way into place. It's staged in a
+// directory next to its target, so it can be renamed into place, and the
+// data that was there is moved into the same directory, so it can be put
+// back.
+type restorePart struct {
+	target string
+	dir    string
+	staged bool
+
+	// The files moved out of the way, by where they were
+	aside map[string]string
+
+	// Whether the staged data is in place, and whether every part is
+	placed    bool
+	committed bool
+}
+
+// stagePart moves the part of the backup at src into a directory next to
+// target. It's copied if the target is on another file system. A part that
+// isn't in the backup still replaces the data that's there with nothing.
+func stagePart(src, target string) (*restorePart, error) {
+
+	err := os.MkdirAll(filepath.Dir(target), 0700)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := ioutil.TempDir(filepath.Dir(target), ".devpad-restore-")
+	if err != nil {
+		return nil, err
+	}
+
+	p := restorePart{
+		target: target,
+		dir:    dir,
+		aside:  map[string]string{},
+	}
+
+	if _, err := os.Stat(src); os.IsNotExist(err) {
+		return &p, nil
+	}
+
+	err = moveData(src, p.stagedPath())
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	p.staged = true
+
+	return &p, nil
+
+}
+
+// stagedPath is where the part of the backup is kept until it's put in place
+func (p *restorePart) stagedPath() string {
+	return filepath.Join(p.dir, "restored")
+}
+
+// swap moves the data at the target out of the way and puts the staged data
+// in its place. A SQLite database's journal files are moved with it, since
+// they would otherwise be applied to the restored database.
+func (p *restorePart) swap() error {
+
+	for i, name := range []string{p.target, p.target + "-wal", p.target + "-shm"} {
+		if _, err := os.Lstat(name); os.IsNotExist(err) {
+			continue
+		}
+		aside := filepath.Join(p.dir, fmt.Sprintf("replaced-%d", i))
+		err := os.Rename(name, aside)
+		if err != nil {
+			return err
+		}
+		p.aside[name] = aside
+	}
+
+	if !p.staged {
+		return nil
+	}
+
+	err := os.Rename(p.stagedPath(), p.target)
+	if err != nil {
+		return err
+	}
+	p.placed = true
+
+	return nil
+
+}
+
+// rollBack puts the data that was replaced back where it was
+func (p *restorePart) rollBack() error {
+
+	if p.placed {
+		err := os.RemoveAll(p.target)
+		if err != nil {
+			return err
+		}
+		p.placed = false
+	}
+
+	for name, aside := range p.aside {
+		err := os.Rename(aside, name)
+		if err != nil {
+			return err
+		}
+		delete(p.aside, name)
+	}
+
+	return nil
+
+}
+
+// cleanUp removes the staging directory, unless data that was replaced is
+// still in it because it couldn't be put back
+func (p *restorePart) cleanUp() {
+	if len(p.aside) > 0 && !p.committed {
+		log.Printf("The data that was replaced at %s is kept in %s.", p.target, p.dir)
+		return
+	}
+	os.RemoveAll(p.dir)
+}
+
+// swapParts puts every part in place, or none of them. If one can't be, the
+// ones before it are rolled back.
+func swapParts(parts []*restorePart) error {
+
+	for i, p := range parts {
+		err := p.swap()
+		if err == nil {
+			continue
+		}
+
+		for j := i; j >= 0; j-- {
+			rbErr := parts[j].rollBack()
+			if rbErr != nil {
+				log.Printf("Couldn't put %s back: %s", parts[j].target, rbErr)
+			}
+		}
+		return fmt.Errorf("%s: %s", p.target, err)
+	}
+
+	for _, p := range parts {
+		p.committed = true
+	}
+
+	return nil
+
+}
+
+// moveData moves a file or directory, copying it if it can't be renamed,
+// since it may be going to another file system
+func moveData(src, dst string) error {
+
+	err := os.Rename(src, dst)
+	if err == nil {
+		return nil
+	}
+
+	err = copyData(src, dst)
+	if err != nil {
+		os.RemoveAll(dst)
+		return err
+	}
+
+	return os.RemoveAll(src)
+
+}
+
+// copyData copies a file, or a directory and everything in it
+func copyData(src, dst string) error {
+
+	return filepath.Walk(src, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		if info.IsDir() {
+			return os.MkdirAll(target, info.Mode().Perm()|0700)
+		}
+
+		in, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+
+		out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+		if err != nil {
+			return err
+		}
+
+		_, err = io.Copy(out, in)
+		if err == nil {
+			err = out.Sync()
+		}
+		if closeErr := out.Close(); err == nil {
+			err = closeErr
+		}
+		return err
+	})
+
+}
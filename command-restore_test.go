@@ -0,0 +1,136 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// restoreFixture makes a target and a staged part of a backup for each name,
+// and returns the parts staged next to their targets
+func restoreFixture(t *testing.T, names ...string) (string, []*restorePart) {
+
+	root := t.TempDir()
+	write := func(p, contents string) {
+		err := os.MkdirAll(filepath.Dir(p), 0700)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(p, []byte(contents), 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	parts := []*restorePart{}
+	for _, name := range names {
+		target := filepath.Join(root, "data", name)
+		write(target, "old "+name)
+		write(target+"-wal", "journal")
+		src := filepath.Join(root, "backup", name)
+		write(src, "new "+name)
+
+		p, err := stagePart(src, target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts = append(parts, p)
+	}
+
+	return root, parts
+
+}
+
+func readData(t *testing.T, p string) string {
+	b, err := ioutil.ReadFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestSwapParts(t *testing.T) {
+
+	root, parts := restoreFixture(t, "a", "b")
+
+	err := swapParts(parts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range parts {
+		p.cleanUp()
+	}
+
+	for _, name := range []string{"a", "b"} {
+		target := filepath.Join(root, "data", name)
+		if got := readData(t, target); got != "new "+name {
+			t.Errorf("expected %s to be restored, got %q", name, got)
+		}
+		if _, err := os.Stat(target + "-wal"); !os.IsNotExist(err) {
+			t.Errorf("the journal of %s wasn't moved away", name)
+		}
+	}
+
+	left, err := filepath.Glob(filepath.Join(root, "data", ".devpad-restore-*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(left) > 0 {
+		t.Errorf("staging directories were left behind: %v", left)
+	}
+
+}
+
+func TestSwapPartsRollsBack(t *testing.T) {
+
+	root, parts := restoreFixture(t, "a", "b")
+
+	// The second part can't be put in place
+	err := os.RemoveAll(parts[1].dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = swapParts(parts)
+	if err == nil {
+		t.Fatal("expected the swap to fail")
+	}
+	for _, p := range parts {
+		p.cleanUp()
+	}
+
+	for _, name := range []string{"a", "b"} {
+		target := filepath.Join(root, "data", name)
+		if got := readData(t, target); got != "old "+name {
+			t.Errorf("expected %s to be rolled back, got %q", name, got)
+		}
+		if got := readData(t, target+"-wal"); got != "journal" {
+			t.Errorf("expected the journal of %s to be put back, got %q", name, got)
+		}
+	}
+
+}
+
+func TestCopyData(t *testing.T) {
+
+	src := filepath.Join(t.TempDir(), "pages")
+	err := os.MkdirAll(filepath.Join(src, "ops"), 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(src, "ops", "deploy.md"), []byte("deploying"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dst := filepath.Join(t.TempDir(), "pages")
+	err = copyData(src, dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := readData(t, filepath.Join(dst, "ops", "deploy.md")); got != "deploying" {
+		t.Errorf("expected the page to be copied, got %q", got)
+	}
+
+}
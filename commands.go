@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/idrum4316/devpad-server/internal/datastore"
+)
+
+// A command is run from the command line instead of starting the server, as
+// in "devpad-server <name> [args...]"
+type command struct {
+	usage string
+	run   func(a *AppContext, args []string) error
+}
+
+var commands = map[string]command{
+	"import": {
+		usage: "import a directory or zip archive of Markdown files",
+		run:   importCommand,
+	},
+	"migrate-sqlite": {
+		usage: "copy the pages and users in devpad.db to the SQLite database",
+		run:   migrateSQLiteCommand,
+	},
+	"reindex": {
+		usage: "rebuild the search index from the pages",
+		run:   reindexCommand,
+	},
+	"restore": {
+		usage: "restore a backup into an empty data directory",
+		run:   restoreCommand,
+	},
+}
+
+// runCommand runs the command named by args[0] and exits if it fails
+func runCommand(a *AppContext, args []string) {
+
+	cmd, ok := commands[args[0]]
+	if !ok {
+		printUsage()
+		os.Exit(2)
+	}
+
+	err := cmd.run(a, args[1:])
+	if err != nil {
+		log.Fatal(err)
+	}
+
+}
+
+// printUsage lists the available commands
+func printUsage() {
+
+	names := []string{}
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintf(os.Stderr, "Usage: %s [command]\n\n", path.Base(os.Args[0]))
+	fmt.Fprintln(os.Stderr, "Without a command the server is started. Commands:")
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %s%s%s\n", name,
+			strings.Repeat(" ", 16-len(name)), commands[name].usage)
+	}
+
+}
+
+// ensureStopped makes sure the server isn't running, since commands that
+// replace data would pull it out from under the server
+func (a *AppContext) ensureStopped() error {
+
+	boltPath := path.Join(a.Config.DataDir, "devpad.db")
+	if _, err := os.Stat(boltPath); err != nil {
+		return nil
+	}
+
+	store, err := datastore.New(boltPath)
+	if err != nil {
+		return fmt.Errorf("open %s (is the server still running?): %s", boltPath, err)
+	}
+	store.Close()
+
+	return nil
+
+}
+
+// logProgress returns a function that logs how many pages have been done, at
+// most once a second
+func logProgress(verb string) func(n int) {
+	last := time.Now()
+	return func(n int) {
+		if time.Since(last) >= time.Second {
+			log.Printf("%s %d pages...", verb, n)
+			last = time.Now()
+		}
+	}
+}
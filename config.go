@@ -14,6 +14,43 @@ type AppConfig struct {
 	DefaultFile  string
 	SanitizeHTML bool
 	SigningKey   string
+	PublicURL    string
+
+	// Where pages and users are kept: "bolt" (inside devpad.db) or "sqlite"
+	// (in SQLitePath)
+	Storage    string
+	SQLitePath string
+
+	// Where pages are kept: "" (wherever Storage says) or "filesystem" (as
+	// Markdown files in PagesDir)
+	PageStorage string
+	PagesDir    string
+
+	// How often collaborative editing sessions are saved, in seconds
+	CollabSnapshotInterval int
+
+	// How many days of changes are kept in the event log (0 keeps them all)
+	EventRetentionDays int
+
+	// What's done when the search index differs from the stored pages at
+	// startup: "report", "repair" or "off"
+	IndexCheck string
+
+	// How often subscribed searches are checked for new matches, in seconds
+	SubscriptionInterval int
+
+	// Groups of words that mean the same thing in searches, and the words
+	// left out of the search index (the English ones if it isn't set)
+	SearchSynonyms  [][]string
+	SearchStopWords []string
+
+	// When backups are made, as a cron schedule ("" for never), where they're
+	// kept and how many are kept
+	BackupSchedule   string
+	BackupDir        string
+	BackupKeepDaily  int
+	BackupKeepWeekly int
+	BackupIndex      bool
 }
 
 // NewAppConfig is a constructor that returns a new AppConfig instance with some
@@ -28,6 +65,30 @@ func NewAppConfig() (c *AppConfig) {
 		DefaultFile:  "index.html",
 		SanitizeHTML: true,
 		SigningKey:   "secret",
+		PublicURL:    "",
+
+		Storage:    "bolt",
+		SQLitePath: "",
+
+		PageStorage: "",
+		PagesDir:    "",
+
+		CollabSnapshotInterval: 30,
+
+		EventRetentionDays: 90,
+
+		IndexCheck: "report",
+
+		SubscriptionInterval: 60,
+
+		SearchSynonyms:  [][]string{},
+		SearchStopWords: nil,
+
+		BackupSchedule:   "",
+		BackupDir:        "",
+		BackupKeepDaily:  7,
+		BackupKeepWeekly: 4,
+		BackupIndex:      false,
 	}
 	return
 }
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"log"
+	"sort"
+
+	"github.com/idrum4316/devpad-server/internal/page"
+	"github.com/idrum4316/devpad-server/internal/search"
+)
+
+// How many pages are indexed at a time when the index is repaired
+const repairBatchSize = 200
+
+// indexReport is how the search index differs from the stored pages
+type indexReport struct {
+	Pages   int `json:"pages"`
+	Indexed int `json:"indexed"`
+
+	// Pages that are stored but not indexed, indexed with different
+	// contents, or indexed but not stored
+	Missing  []string `json:"missing"`
+	Stale    []string `json:"stale"`
+	Orphaned []string `json:"orphaned"`
+
+	Repaired bool `json:"repaired"`
+}
+
+// Drift returns how many pages differ
+func (r *indexReport) Drift() int {
+	return len(r.Missing) + len(r.Stale) + len(r.Orphaned)
+}
+
+// checkIndex compares the content hash of every stored page with the one in
+// the search index, and brings the index up to date if repair is set. Pages
+// can change while it runs, so anything that's repaired is read again first.
+func (a *AppContext) checkIndex(repair bool) (*indexReport, error) {
+
+	// Changes still waiting in the outbox would look like drift
+	err := a.flushIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	// The index is read first. A page written in between then looks
+	// missing or stale rather than orphaned, and is indexed again instead
+	// of being removed.
+	hashes, err := a.Index.ContentHashes()
+	if err != nil {
+		return nil, err
+	}
+
+	report := indexReport{
+		Indexed:  len(hashes),
+		Missing:  []string{},
+		Stale:    []string{},
+		Orphaned: []string{},
+	}
+
+	seen := map[string]bool{}
+	err = a.Pages.ForEachPage(func(id string, p *page.Page) error {
+		report.Pages++
+		seen[id] = true
+
+		hash, ok := hashes[id]
+		if !ok {
+			report.Missing = append(report.Missing, id)
+		} else if hash != search.ContentHash(p) {
+			report.Stale = append(report.Stale, id)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for id := range hashes {
+		if !seen[id] {
+			report.Orphaned = append(report.Orphaned, id)
+		}
+	}
+
+	sort.Strings(report.Missing)
+	sort.Strings(report.Stale)
+	sort.Strings(report.Orphaned)
+
+	if !repair || report.Drift() == 0 {
+		return &report, nil
+	}
+
+	ids := append(append(append([]string{}, report.Missing...), report.Stale...), report.Orphaned...)
+	err = a.repairIndex(ids)
+	if err != nil {
+		return &report, err
+	}
+	report.Repaired = true
+
+	return &report, nil
+
+}
+
+// repairIndex indexes the pages again as they are stored now, removing the
+// ones that no longer exist from the index
+func (a *AppContext) repairIndex(ids []string) error {
+
+	batch := map[string]*page.Page{}
+	for _, id := range ids {
+		p, err := a.Pages.GetPage(id)
+		if err != nil {
+			return err
+		}
+
+		if p == nil {
+			err = a.Index.DeletePage(id)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		batch[id] = p
+		if len(batch) == repairBatchSize {
+			err = a.Index.IndexPages(batch)
+			if err != nil {
+				return err
+			}
+			batch = map[string]*page.Page{}
+		}
+	}
+
+	return a.Index.IndexPages(batch)
+
+}
+
+// checkIndexOnStart checks the search index in the background when the
+// server starts, as configured with IndexCheck
+func (a *AppContext) checkIndexOnStart() {
+
+	repair := false
+	switch a.Config.IndexCheck {
+	case "off":
+		return
+	case "repair":
+		repair = true
+	case "report", "":
+	default:
+		log.Printf("index check: unknown IndexCheck %q, only reporting.", a.Config.IndexCheck)
+	}
+
+	go func() {
+		report, err := a.checkIndex(repair)
+		if err != nil {
+			log.Println("index check:", err)
+			return
+		}
+		if report.Drift() == 0 {
+			log.Printf("index check: %d pages are all indexed.", report.Pages)
+			return
+		}
+
+		log.Printf("index check: %d missing, %d stale and %d orphaned pages in the search index.",
+			len(report.Missing), len(report.Stale), len(report.Orphaned))
+		if report.Repaired {
+			log.Println("index check: repaired the search index.")
+		} else {
+			log.Println("index check: set IndexCheck = \"repair\" or POST /api/admin/index/repair to repair it.")
+		}
+	}()
+
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"log"
+
+	"github.com/idrum4316/devpad-server/internal/event"
+	"github.com/idrum4316/devpad-server/internal/filestore"
+	"github.com/idrum4316/devpad-server/internal/page"
+)
+
+// openFileStore attaches the filesystem page store, brings the search index up
+// to date with the files and starts watching them for external changes. The
+// returned watcher should be closed on shutdown.
+func (a *AppContext) openFileStore() (*filestore.Watcher, error) {
+
+	fs, err := filestore.New(a.pagesDir())
+	if err != nil {
+		return nil, err
+	}
+	a.Pages = fs
+
+	// Watch before syncing, so nothing that changes in between is missed
+	w, err := fs.Watch(a.applyExternalChange, func(err error) {
+		log.Println("filestore:", err)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = a.syncIndexWithFiles()
+	if err != nil {
+		w.Close()
+		return nil, err
+	}
+
+	log.Printf("Serving pages from %s.", fs.Dir())
+	return w, nil
+
+}
+
+// syncIndexWithFiles indexes every page file and removes pages from the index
+// whose files are gone. Files may have been edited while the server was down.
+func (a *AppContext) syncIndexWithFiles() error {
+
+	seen := map[string]bool{}
+
+	err := a.Pages.ForEachPage(func(id string, p *page.Page) error {
+		seen[id] = true
+		return a.Index.IndexPage(id, p)
+	})
+	if err != nil {
+		return err
+	}
+
+	ids, err := a.Index.PageIDs()
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		if !seen[id] {
+			err = a.Index.DeletePage(id)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+
+}
+
+// applyExternalChange updates the search index after a page file was changed
+// outside of the server, and publishes the change. p is nil if the file was
+// removed.
+func (a *AppContext) applyExternalChange(id string, p *page.Page) {
+
+	indexed, err := a.Index.HasPage(id)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	if p == nil {
+		err = a.Index.DeletePage(id)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		if indexed {
+			e := event.New(event.PageDeleted, "")
+			e.Slug = id
+			a.PublishEvent(e)
+		}
+		return
+	}
+
+	eventType := event.PageUpdated
+	if !indexed {
+		eventType = event.PageCreated
+	}
+
+	e := event.New(eventType, "")
+	e.Slug = id
+	e.Title = p.Metadata.Title
+	e.Tags = p.Metadata.Tags
+
+	err = a.Index.IndexPage(id, p)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	a.PublishEvent(e)
+
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"expvar"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/idrum4316/devpad-server/internal/backup"
+)
+
+// BackupHandler streams a backup of the data directory as a tar archive, while
+// the server keeps running. The databases are copied in read transactions, so
+// the backup is consistent. The search index is left out unless index=true,
+// since it can be rebuilt from the pages when the backup is restored.
+func BackupHandler(a *AppContext) http.Handler {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		includeIndex := false
+
+		// Check for the 'index' parameter
+		if i := r.URL.Query().Get("index"); i != "" {
+			b, err := strconv.ParseBool(i)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write(FormatError("Unable to parse boolean from " +
+					"'index' option."))
+				return
+			}
+			includeIndex = b
+		}
+
+		s, err := a.snapshot(includeIndex)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write(FormatError("Unable to make a backup."))
+			log.Println("backup:", err)
+			return
+		}
+		defer s.Remove()
+
+		filename := backup.ArchiveName(s.manifest.Created)
+		w.Header().Set("Content-Type", "application/x-tar")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+
+		// Once the archive has started, the only way to report an error is
+		// to cut it short. A backup without its manifest won't restore.
+		err = s.Write(w)
+		if err != nil {
+			log.Println("backup:", err)
+		}
+
+	})
+
+	return RequireAdmin(handler, a)
+}
+
+// BackupStatusHandler returns the status of scheduled backups: when the last
+// one succeeded or failed, when the next one is made and the backups that are
+// kept
+func BackupStatusHandler(a *AppContext) http.Handler {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		status := backup.Status{}
+		if a.Backups != nil {
+			status = a.Backups.Status()
+		}
+
+		j, err := json.Marshal(status)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write(FormatError("Unable to marshal the backup status."))
+			return
+		}
+
+		_, _ = w.Write(j)
+
+	})
+
+	return RequireAdmin(handler, a)
+}
+
+// MetricsHandler returns the server's metrics as JSON, including the status
+// of scheduled backups under "backups"
+func MetricsHandler(a *AppContext) http.Handler {
+	return RequireAdmin(expvar.Handler(), a)
+}
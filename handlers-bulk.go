@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/idrum4316/devpad-server/internal/storage"
+)
+
+// The largest bulk request, and the most operations it can have
+const (
+	bulkMaxSize = 64 << 20
+	bulkMaxOps  = 10000
+)
+
+// BulkPagesHandler applies many page changes sent as newline-delimited JSON,
+// one operation per line:
+//
+//	{"op": "upsert", "slug": "a", "page": {"contents": "...", "metadata": {...}}}
+//	{"op": "delete", "slug": "b"}
+//	{"op": "rename", "slug": "c", "to": "d"}
+//
+// By default the request is atomic: every operation is applied in one
+// transaction, or none are if any of them fails. With 'mode=best-effort',
+// operations are applied in chunks and a failed one doesn't stop the others.
+// Either way, the response has a result for every operation.
+func BulkPagesHandler(a *AppContext) http.Handler {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		// Check for the 'mode' parameter
+		atomic := true
+		switch r.URL.Query().Get("mode") {
+		case "", "atomic":
+		case "best-effort":
+			atomic = false
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write(FormatError("'mode' must be 'atomic' or 'best-effort'."))
+			return
+		}
+
+		if _, ok := a.Pages.(storage.PageBatcher); atomic && !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write(FormatError("This page storage can't apply changes " +
+				"atomically. Use 'mode=best-effort'."))
+			return
+		}
+
+		ops := []*bulkOp{}
+		decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, bulkMaxSize))
+		for {
+			op := bulkOp{}
+			err := decoder.Decode(&op)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write(FormatError(fmt.Sprintf("Unable to decode "+
+					"operation %d: %s", len(ops), err)))
+				return
+			}
+			ops = append(ops, &op)
+
+			if len(ops) > bulkMaxOps {
+				w.WriteHeader(http.StatusRequestEntityTooLarge)
+				_, _ = w.Write(FormatError(fmt.Sprintf("A bulk request can't "+
+					"have more than %d operations.", bulkMaxOps)))
+				return
+			}
+		}
+
+		actor, _ := a.GetUserIDFromRequest(r)
+		report, err := a.applyBulk(ops, atomic, actor)
+		if err != nil && err != errBulkAborted {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write(FormatError("Unable to save pages."))
+			log.Println(err)
+			return
+		}
+
+		j, err := json.Marshal(report)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write(FormatError("Unable to encode the response."))
+			return
+		}
+
+		// Nothing was applied, but the results say why
+		if report.Atomic && report.Failed > 0 {
+			w.WriteHeader(http.StatusConflict)
+		}
+		_, _ = w.Write(j)
+
+	})
+
+	return RequireAuth(handler, a)
+}
@@ -0,0 +1,333 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/idrum4316/devpad-server/internal/event"
+	"github.com/idrum4316/devpad-server/internal/feed"
+	"github.com/idrum4316/devpad-server/internal/render"
+)
+
+// GetChangesHandler returns the recent changes to pages, newest first. It can
+// be filtered by user, tag, namespace and time window, and is paged with the
+// 'cursor' returned by the previous request. With 'format' set to "atom" or
+// "rss" it is rendered as a feed. Feed readers can authenticate with the
+// 'token' parameter instead of a JWT token.
+func GetChangesHandler(a *AppContext) http.Handler {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		q := r.URL.Query()
+		numChanges := 50
+
+		// Check for the 'size' parameter
+		size, ok := q["size"]
+		if ok {
+			sizeInt, err := strconv.Atoi(size[0])
+			if err != nil || sizeInt < 1 {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write(FormatError("Unable to parse integer from 'size'" +
+					" option."))
+				return
+			}
+			numChanges = sizeInt
+		}
+		if numChanges > 500 {
+			numChanges = 500
+		}
+
+		// Check for the 'cursor' parameter
+		cursor := uint64(0)
+		if c := q.Get("cursor"); c != "" {
+			cursorInt, err := strconv.ParseUint(c, 10, 64)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write(FormatError("Unable to parse 'cursor' option."))
+				return
+			}
+			cursor = cursorInt
+		}
+
+		// Check for the time window
+		var since, until time.Time
+		if s := q.Get("since"); s != "" {
+			t, err := time.Parse(time.RFC3339, s)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write(FormatError("Unable to parse RFC 3339 time from " +
+					"'since' option."))
+				return
+			}
+			since = t
+		}
+		if u := q.Get("until"); u != "" {
+			t, err := time.Parse(time.RFC3339, u)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write(FormatError("Unable to parse RFC 3339 time from " +
+					"'until' option."))
+				return
+			}
+			until = t
+		}
+
+		userFilter := q.Get("user")
+		namespace := q.Get("namespace")
+		tags := q["tag"]
+
+		match := func(e *event.Event) (bool, bool) {
+			// The log is in time order, so nothing older will match
+			if !since.IsZero() && e.Timestamp.Before(since) {
+				return false, true
+			}
+			if !until.IsZero() && e.Timestamp.After(until) {
+				return false, false
+			}
+			if !e.IsPageEvent() {
+				return false, false
+			}
+			if userFilter != "" && e.Actor != userFilter {
+				return false, false
+			}
+			if namespace != "" && e.Namespace() != namespace {
+				return false, false
+			}
+			for _, tag := range tags {
+				if !e.HasTag(tag) {
+					return false, false
+				}
+			}
+			return true, false
+		}
+
+		changes, err := a.Meta.EventsBefore(cursor, numChanges, match)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write(FormatError("error accessing database"))
+			log.Println(err)
+			return
+		}
+
+		format := q.Get("format")
+		if format == "" {
+			format = "json"
+		}
+
+		switch format {
+		case "json":
+			type Response struct {
+				Changes    []*event.Event `json:"changes"`
+				NextCursor string         `json:"next_cursor,omitempty"`
+			}
+
+			resp := Response{Changes: changes}
+			if len(changes) == numChanges {
+				resp.NextCursor = strconv.FormatUint(changes[len(changes)-1].ID, 10)
+			}
+
+			j, err := json.Marshal(resp)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				_, _ = w.Write(FormatError("Unable to encode the response."))
+				return
+			}
+			_, _ = w.Write(j)
+
+		case "atom", "rss":
+			f := changesFeed(a, r, changes)
+
+			var body []byte
+			if format == "atom" {
+				w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+				body, err = f.Atom()
+			} else {
+				w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+				body, err = f.RSS()
+			}
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				_, _ = w.Write(FormatError("Unable to encode the response."))
+				return
+			}
+			_, _ = w.Write(body)
+
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write(FormatError("Unknown value in 'format' parameter."))
+		}
+
+	})
+
+	return RequireAuthOrFeedToken(handler, a)
+}
+
+// changesFeed builds a feed out of a list of page events
+func changesFeed(a *AppContext, r *http.Request, changes []*event.Event) *feed.Feed {
+
+	base := a.publicURL(r)
+	now := time.Now()
+
+	f := feed.Feed{
+		ID:      base + "/api/changes",
+		Title:   "DevPad recent changes",
+		Link:    base + "/api/changes",
+		Updated: now,
+	}
+	if len(changes) > 0 {
+		f.Updated = changes[0].Timestamp
+	}
+
+	for _, e := range changes {
+		title := e.Title
+		if title == "" {
+			title = e.Slug
+		}
+
+		summary := ""
+		switch e.Type {
+		case event.PageCreated:
+			summary = fmt.Sprintf("%s created %s", e.Actor, e.Slug)
+		case event.PageUpdated:
+			summary = fmt.Sprintf("%s updated %s", e.Actor, e.Slug)
+		case event.PageDeleted:
+			summary = fmt.Sprintf("%s deleted %s", e.Actor, e.Slug)
+		case event.PageRenamed:
+			summary = fmt.Sprintf("%s renamed %s to %s", e.Actor, e.OldSlug, e.Slug)
+		}
+
+		f.Items = append(f.Items, feed.Item{
+			ID:         fmt.Sprintf("%s/api/changes/%d", base, e.ID),
+			Title:      title,
+			Link:       a.feedPageLink(base, e.Slug, now),
+			Summary:    summary,
+			Author:     e.Actor,
+			Updated:    e.Timestamp,
+			Categories: e.Tags,
+		})
+	}
+
+	return &f
+
+}
+
+// publicURL returns the URL the server is reached at, without a trailing
+// slash. It comes from the configuration if set, otherwise it's guessed from
+// the request.
+func (a *AppContext) publicURL(r *http.Request) string {
+
+	if a.Config.PublicURL != "" {
+		return strings.TrimRight(a.Config.PublicURL, "/")
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+
+	return scheme + "://" + r.Host
+
+}
+
+// Feed readers open the links in a feed in a browser that has no JWT token,
+// so the links are signed to work without one for this long. They don't
+// carry the feed's token, so sharing a feed doesn't give the token away.
+const feedLinkLifetime = 30 * 24 * time.Hour
+
+// feedPageLink returns a signed link to a page, for a feed. The expiry is
+// rounded to the day, so the links don't change every time a feed is read.
+func (a *AppContext) feedPageLink(base string, slug string, now time.Time) string {
+
+	expires := now.Truncate(24 * time.Hour).Add(feedLinkLifetime).Unix()
+
+	q := url.Values{}
+	q.Set("expires", strconv.FormatInt(expires, 10))
+	q.Set("sig", a.signFeedLink(slug, expires))
+
+	return base + "/api/feed/pages/" + url.PathEscape(slug) + "?" + q.Encode()
+
+}
+
+// signFeedLink returns the signature of a link to a page that expires at the
+// given Unix time
+func (a *AppContext) signFeedLink(slug string, expires int64) string {
+
+	mac := hmac.New(sha256.New, []byte(a.Config.SigningKey))
+	fmt.Fprintf(mac, "feed page\n%s\n%d", slug, expires)
+
+	return hex.EncodeToString(mac.Sum(nil))
+
+}
+
+var feedPageTemplate = template.Must(template.New("").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+</head>
+<body>
+{{.Body}}
+</body>
+</html>
+`))
+
+// FeedPageHandler renders a page as a standalone HTML document. It's what the
+// items in the changes feed link to, so it can be read with the signature in
+// the link, or a feed token, instead of a JWT token.
+func FeedPageHandler(a *AppContext) http.Handler {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		slug := mux.Vars(r)["slug"]
+
+		pg, err := a.Pages.GetPage(slug)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write(FormatError("The server encountered an error trying to " +
+				"load the requested page."))
+			log.Println(err)
+			return
+		}
+		if pg == nil {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write(FormatError("The page you requested could not be found."))
+			return
+		}
+
+		title := pg.Metadata.Title
+		if title == "" {
+			title = slug
+		}
+		body := render.Markdown([]byte(pg.Contents), render.Options{
+			Sanitize: a.Config.SanitizeHTML,
+		})
+
+		// The signature in the link shouldn't be passed on to the sites the
+		// page links to
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Referrer-Policy", "no-referrer")
+		err = feedPageTemplate.Execute(w, map[string]interface{}{
+			"Title": title,
+			"Body":  template.HTML(body),
+		})
+		if err != nil {
+			log.Println(err)
+		}
+
+	})
+
+	return RequireAuthOrSignedLink(handler, a)
+}
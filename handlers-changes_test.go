@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/idrum4316/devpad-server/internal/memstore"
+)
+
+func TestFeedPageLink(t *testing.T) {
+
+	a := NewAppContext()
+	a.Config.SigningKey = "test key"
+	a.Users = memstore.New()
+
+	router := mux.NewRouter()
+	router.Handle("/api/feed/pages/{slug}", RequireAuthOrSignedLink(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(mux.Vars(r)["slug"]))
+		}), a))
+
+	get := func(link string) int {
+		u, err := url.Parse(link)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", u.RequestURI(), nil))
+		return w.Code
+	}
+
+	link := a.feedPageLink("http://devpad", "ops:deploy guide", time.Now())
+	if strings.Contains(link, "token=") {
+		t.Errorf("the link carries a feed token: %s", link)
+	}
+	if code := get(link); code != http.StatusOK {
+		t.Errorf("expected the signed link to work, got %d", code)
+	}
+
+	// The signature only works for its own page
+	other := strings.Replace(link, "deploy%20guide", "secrets", 1)
+	if other == link {
+		t.Fatalf("unexpected link %s", link)
+	}
+	if code := get(other); code != http.StatusUnauthorized {
+		t.Errorf("expected a link to another page to be refused, got %d", code)
+	}
+
+	// Or until it expires
+	old := a.feedPageLink("http://devpad", "ops:deploy guide", time.Now().Add(-2*feedLinkLifetime))
+	if code := get(old); code != http.StatusUnauthorized {
+		t.Errorf("expected an expired link to be refused, got %d", code)
+	}
+
+	// Or with the key it was signed with
+	a.Config.SigningKey = "new key"
+	if code := get(link); code != http.StatusUnauthorized {
+		t.Errorf("expected a link signed with an old key to be refused, got %d", code)
+	}
+
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/idrum4316/devpad-server/internal/collab"
+	"github.com/idrum4316/devpad-server/internal/event"
+	"github.com/idrum4316/devpad-server/internal/page"
+	"golang.org/x/net/websocket"
+)
+
+// CollabHandler opens a WebSocket to edit a page together with other users.
+// Edits are exchanged as operational transforms (see internal/collab), and the
+// page is saved periodically and when the last editor leaves.
+//
+// A client that reconnects should pass the 'client', 'session' and
+// 'revision' it last saw in the query string to resume where it left off.
+func CollabHandler(a *AppContext) http.Handler {
+	server := websocket.Server{
+
+		// Browsers send cookies and the like with WebSocket requests from any
+		// site, so only the server's own pages may open one.
+		Handshake: func(config *websocket.Config, r *http.Request) error {
+			return a.checkOrigin(config, r)
+		},
+
+		Handler: func(ws *websocket.Conn) {
+			defer ws.Close()
+
+			r := ws.Request()
+			vars := mux.Vars(r)
+			query := r.URL.Query()
+
+			userID, err := a.GetUserIDFromRequest(r)
+			if err != nil {
+				return
+			}
+
+			revision := 0
+			if rev := query.Get("revision"); rev != "" {
+				revision, err = strconv.Atoi(rev)
+				if err != nil {
+					_ = websocket.JSON.Send(ws, &collab.Message{
+						Type:    collab.TypeError,
+						Message: "Unable to parse integer from 'revision' option.",
+					})
+					return
+				}
+			}
+
+			client, err := collab.NewClient(query.Get("client"), userID)
+			if err != nil {
+				return
+			}
+
+			session, err := a.Collab.Join(vars["slug"], client, query.Get("session"), revision)
+			if err == collab.ErrNotFound {
+				_ = websocket.JSON.Send(ws, &collab.Message{
+					Type:    collab.TypeError,
+					Message: "The requested page could not be found.",
+				})
+				return
+			} else if err != nil {
+				_ = websocket.JSON.Send(ws, &collab.Message{
+					Type:    collab.TypeError,
+					Message: "Unable to load the page.",
+				})
+				return
+			}
+			defer session.Leave(client)
+
+			// Write queued messages until the session closes the queue
+			go func() {
+				for msg := range client.Send {
+					err := websocket.JSON.Send(ws, msg)
+					if err != nil {
+						break
+					}
+				}
+				ws.Close()
+			}()
+
+			for {
+				msg := collab.Message{}
+				err := websocket.JSON.Receive(ws, &msg)
+				if err != nil {
+					return
+				}
+				session.Receive(client, &msg)
+			}
+		},
+	}
+
+	return RequireAuth(server, a)
+}
+
+// checkOrigin accepts WebSocket requests without an Origin (which don't come
+// from a browser) and requests from the server's own host: the one in
+// PublicURL if it's set, otherwise the one the request was sent to.
+func (a *AppContext) checkOrigin(config *websocket.Config, r *http.Request) error {
+
+	origin, err := websocket.Origin(config, r)
+	if err != nil {
+		return err
+	}
+	config.Origin = origin
+	if origin == nil {
+		return nil
+	}
+
+	host := r.Host
+	if a.Config.PublicURL != "" {
+		public, err := url.Parse(a.Config.PublicURL)
+		if err != nil {
+			return err
+		}
+		host = public.Host
+	}
+
+	if origin.Host != host {
+		return websocket.ErrBadWebSocketOrigin
+	}
+
+	return nil
+
+}
+
+// pageVersion identifies the stored state of a page, so collaborative editing
+// sessions can tell whether it was changed by something else
+func pageVersion(pg *page.Page) (string, error) {
+
+	b, err := json.Marshal(pg)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+
+}
+
+// loadPageContents returns the contents and version of a page for a
+// collaborative editing session
+func (a *AppContext) loadPageContents(slug string) (string, string, error) {
+
+	pg, err := a.Pages.GetPage(slug)
+	if err != nil {
+		return "", "", err
+	}
+	if pg == nil {
+		return "", "", collab.ErrNotFound
+	}
+
+	version, err := pageVersion(pg)
+	if err != nil {
+		return "", "", err
+	}
+
+	return pg.Contents, version, nil
+
+}
+
+// savePageSnapshot saves the contents of a collaborative editing session to
+// the page, keeping its metadata. The page isn't saved if it was changed,
+// renamed or deleted since the session loaded or last saved it, so those
+// changes aren't lost or undone. The check and the save are made in one
+// transaction.
+func (a *AppContext) savePageSnapshot(slug string, contents string, actor string,
+	version string) (string, error) {
+
+	pg := page.Page{}
+	saved, err := a.Pages.UpdatePageIf(&pg, slug, func(current *page.Page) error {
+		if current == nil {
+			return collab.ErrConflict
+		}
+		v, err := pageVersion(current)
+		if err != nil {
+			return err
+		}
+		if v != version {
+			return collab.ErrConflict
+		}
+
+		// The page is saved with its own metadata
+		pg = *current
+		pg.Contents = contents
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	err = a.indexPage(slug, saved)
+	if err != nil {
+		return "", err
+	}
+
+	e := event.New(event.PageUpdated, actor)
+	e.Slug = slug
+	e.Title = saved.Metadata.Title
+	e.Tags = saved.Metadata.Tags
+	a.PublishEvent(e)
+
+	// The store may have changed the page as it saved it (its modification
+	// time, for one), so the new version is taken from what was stored
+	return pageVersion(saved)
+
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/idrum4316/devpad-server/internal/event"
+)
+
+const (
+	// How many logged events are read at a time when a client catches up
+	eventReplayBatch = 500
+
+	// How often a comment is sent to keep idle connections open
+	eventKeepAlive = 30 * time.Second
+)
+
+// GetEventsHandler streams page changes as Server-Sent Events. Clients that
+// reconnect with a Last-Event-ID header are sent everything they missed from
+// the event log before the live stream continues. Browsers' EventSource can't
+// send the JWT token in a header, so it can be passed in the 'jwt' parameter.
+func GetEventsHandler(a *AppContext) http.Handler {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write(FormatError("Streaming is not supported."))
+			return
+		}
+
+		// The last event the client saw. It can also be given as a query
+		// parameter, since EventSource only sends the header on reconnect.
+		lastID := uint64(0)
+		lastIDParam := r.Header.Get("Last-Event-ID")
+		if lastIDParam == "" {
+			lastIDParam = r.URL.Query().Get("last_event_id")
+		}
+		if lastIDParam != "" {
+			id, err := strconv.ParseUint(lastIDParam, 10, 64)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write(FormatError("Unable to parse integer from " +
+					"'Last-Event-ID'."))
+				return
+			}
+			lastID = id
+		}
+
+		// Subscribe before reading the log so nothing published in between
+		// is missed. Anything seen twice is skipped by its ID.
+		sub := a.Events.Subscribe()
+		defer sub.Cancel()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		// Replay the events the client missed
+		for {
+			events, err := a.Events.Since(lastID, eventReplayBatch)
+			if err != nil {
+				log.Println(err)
+				return
+			}
+
+			for _, e := range events {
+				err = writeEvent(w, e)
+				if err != nil {
+					return
+				}
+				lastID = e.ID
+			}
+			flusher.Flush()
+
+			if len(events) < eventReplayBatch {
+				break
+			}
+		}
+
+		keepAlive := time.NewTicker(eventKeepAlive)
+		defer keepAlive.Stop()
+
+		// Stream new events as they're published
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+
+			case <-keepAlive.C:
+				_, err := fmt.Fprint(w, ": keep-alive\n\n")
+				if err != nil {
+					return
+				}
+				flusher.Flush()
+
+			case e, ok := <-sub.C:
+				// The subscription was dropped because the client fell
+				// behind. It will reconnect and catch up from the log.
+				if !ok {
+					return
+				}
+				if e.ID <= lastID {
+					continue
+				}
+				err := writeEvent(w, e)
+				if err != nil {
+					return
+				}
+				lastID = e.ID
+				flusher.Flush()
+			}
+		}
+
+	})
+
+	return RequireAuth(handler, a)
+}
+
+// writeEvent writes a page event in the Server-Sent Events format. Other
+// events are skipped.
+func writeEvent(w http.ResponseWriter, e *event.Event) error {
+
+	if !e.IsPageEvent() {
+		return nil
+	}
+
+	j, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, j)
+	return err
+
+}
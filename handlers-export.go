@@ -0,0 +1,315 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/idrum4316/devpad-server/internal/archive"
+	"github.com/idrum4316/devpad-server/internal/epub"
+	"github.com/idrum4316/devpad-server/internal/page"
+	"github.com/idrum4316/devpad-server/internal/render"
+	"github.com/idrum4316/devpad-server/internal/site"
+)
+
+// epubStylesheet is the stylesheet used by EPUB exports, along with the one
+// for highlighted code
+const epubStylesheet = `body { font-family: serif; line-height: 1.5; }
+h1, h2, h3, h4, h5, h6 { font-family: sans-serif; line-height: 1.2; }
+pre { font-size: 0.85em; white-space: pre-wrap; }
+code { font-family: monospace; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 0.2em 0.5em; }
+blockquote { margin-left: 1em; padding-left: 1em; border-left: 3px solid #ccc; }
+`
+
+// epubPage is a page that is a chapter of an EPUB export
+type epubPage struct {
+	slug string
+	page *page.Page
+}
+
+// ExportHandler streams a zip archive of every page, as Markdown files with
+// front matter for the title, tags and modification time. Namespaces become
+// folders, the same layout the import endpoint reads, so an export can be
+// imported again as it is.
+func ExportHandler(a *AppContext) http.Handler {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		// The pages are listed first, so the store isn't held open while the
+		// archive is written to a slow client
+		ids := []string{}
+		err := a.Pages.ForEachPage(func(id string, p *page.Page) error {
+			if _, err := archive.PathFor(id); err != nil {
+				log.Println("export: skipping page:", err)
+				return nil
+			}
+			ids = append(ids, id)
+			return nil
+		})
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write(FormatError("Unable to list the pages."))
+			log.Println(err)
+			return
+		}
+
+		filename := fmt.Sprintf("devpad-%s.zip", time.Now().Format("2006-01-02"))
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+
+		// Once the archive has started there's no way to report an error
+		// other than cutting it short, which leaves it unreadable
+		zw := archive.NewWriter(w)
+		for _, id := range ids {
+			p, err := a.Pages.GetPage(id)
+			if err != nil {
+				log.Println(err)
+				return
+			}
+
+			// Pages deleted since they were listed are left out
+			if p == nil {
+				continue
+			}
+
+			err = zw.AddPage(id, p)
+			if err != nil {
+				log.Println(err)
+				return
+			}
+		}
+
+		err = zw.Close()
+		if err != nil {
+			log.Println(err)
+		}
+
+	})
+
+	return RequireAuth(handler, a)
+}
+
+// ExportSiteHandler streams a static HTML site made from every page, as a zip
+// archive. Pages are rendered the same way as with format=html, and links
+// between them are rewritten so the site can be browsed without the server.
+func ExportSiteHandler(a *AppContext) http.Handler {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		filename := fmt.Sprintf("devpad-site-%s.zip", time.Now().Format("2006-01-02"))
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+
+		err := site.Build(w, a.Pages, site.Options{
+			Title:    "DevPad",
+			Sanitize: a.Config.SanitizeHTML,
+		})
+		if err != nil {
+			log.Println(err)
+		}
+
+	})
+
+	return RequireAuth(handler, a)
+}
+
+// ExportEPUBHandler returns an EPUB book made from a page and every page in
+// its namespace (root=ops for ops, ops:deploy, ...), or from every page with
+// a tag (tag=...). Each page is a chapter, and the table of contents lists
+// the chapters with the headings in them. Links between pages in the book
+// lead to their chapters.
+func ExportEPUBHandler(a *AppContext) http.Handler {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		q := r.URL.Query()
+		root, tag := q.Get("root"), q.Get("tag")
+		if (root == "") == (tag == "") {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write(FormatError("Either 'root' or 'tag' is required."))
+			return
+		}
+
+		pages := []*epubPage{}
+		err := a.Pages.ForEachPage(func(id string, p *page.Page) error {
+			if root != "" && (id == root || strings.HasPrefix(id, root+":")) {
+				pages = append(pages, &epubPage{id, p})
+			}
+			if tag != "" {
+				for _, t := range p.Metadata.Tags {
+					if t == tag {
+						pages = append(pages, &epubPage{id, p})
+						break
+					}
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write(FormatError("Unable to read pages."))
+			log.Println(err)
+			return
+		}
+		if len(pages) == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write(FormatError("No pages were found."))
+			return
+		}
+
+		// A namespace reads from its root page down, and pages with a tag
+		// are in order of their titles
+		title := tag
+		if root != "" {
+			title = root
+			sort.Slice(pages, func(i, j int) bool {
+				if (pages[i].slug == root) != (pages[j].slug == root) {
+					return pages[i].slug == root
+				}
+				return pages[i].slug < pages[j].slug
+			})
+			if pages[0].slug == root && pages[0].page.Metadata.Title != "" {
+				title = pages[0].page.Metadata.Title
+			}
+		} else {
+			sort.Slice(pages, func(i, j int) bool {
+				ti := strings.ToLower(pageTitle(pages[i]))
+				tj := strings.ToLower(pageTitle(pages[j]))
+				if ti != tj {
+					return ti < tj
+				}
+				return pages[i].slug < pages[j].slug
+			})
+		}
+
+		book, err := a.newEPUB(title, pages)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write(FormatError("Unable to create the book."))
+			log.Println(err)
+			return
+		}
+
+		// The book is made before anything is sent, so errors can still be
+		// reported
+		buf := bytes.Buffer{}
+		err = book.Write(&buf)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write(FormatError("Unable to create the book."))
+			log.Println(err)
+			return
+		}
+
+		name := root
+		if name == "" {
+			name = tag
+		}
+		name = strings.Map(func(r rune) rune {
+			if r < 0x20 || strings.ContainsRune(`"\/:`, r) {
+				return '-'
+			}
+			return r
+		}, name)
+
+		w.Header().Set("Content-Type", "application/epub+zip")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+name+`.epub"`)
+		_, _ = w.Write(buf.Bytes())
+
+	})
+
+	return RequireAuth(handler, a)
+}
+
+// newEPUB makes a book with a chapter for each page
+func (a *AppContext) newEPUB(title string, pages []*epubPage) (*epub.Book, error) {
+
+	id, err := epub.NewIdentifier()
+	if err != nil {
+		return nil, err
+	}
+
+	css := bytes.Buffer{}
+	css.WriteString(epubStylesheet)
+	err = render.WriteCSS(&css)
+	if err != nil {
+		return nil, err
+	}
+
+	book := epub.Book{
+		Title:      title,
+		Language:   epubLanguage(pages),
+		Identifier: id,
+		CSS:        css.String(),
+	}
+
+	chapters := map[string]string{}
+	for i, p := range pages {
+		chapters[p.slug] = epub.ChapterFile(i)
+	}
+
+	for _, p := range pages {
+		from := p.slug
+		body := render.Markdown([]byte(p.page.Contents), render.Options{
+			Sanitize: a.Config.SanitizeHTML,
+			Classes:  true,
+			Link: func(dest string) string {
+				targets, fragment := page.LinkTargets(dest, from)
+				for _, slug := range targets {
+					if file, ok := chapters[slug]; ok {
+						return file + fragment
+					}
+				}
+				return dest
+			},
+		})
+
+		book.Chapters = append(book.Chapters, &epub.Chapter{
+			Title:    pageTitle(p),
+			Language: p.page.Metadata.Language,
+			Body:     body,
+		})
+
+		if p.page.Metadata.Modified.After(book.Modified) {
+			book.Modified = p.page.Metadata.Modified
+		}
+	}
+	if book.Modified.IsZero() {
+		book.Modified = time.Now()
+	}
+
+	return &book, nil
+
+}
+
+// epubLanguage returns the language of a book: the language of its pages if
+// they all have the same one, and English otherwise. Chapters in other
+// languages are marked as such.
+func epubLanguage(pages []*epubPage) string {
+
+	language := ""
+	for _, p := range pages {
+		l := p.page.Metadata.Language
+		if l == "" || (language != "" && l != language) {
+			return "en"
+		}
+		language = l
+	}
+
+	if language == "" {
+		return "en"
+	}
+	return language
+
+}
+
+// pageTitle returns the title of a page, or its slug if it doesn't have one
+func pageTitle(p *epubPage) string {
+	if p.page.Metadata.Title != "" {
+		return p.page.Metadata.Title
+	}
+	return p.slug
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/idrum4316/devpad-server/internal/archive"
+)
+
+// The largest zip archive that can be uploaded to the import endpoint
+const importMaxSize = 64 << 20
+
+// ImportHandler imports the Markdown files in a zip archive, sent as the body
+// of the request. Paths become slugs and folders become namespaces. Pages
+// that already exist are left alone unless 'overwrite' is true. Files without
+// front matter are tagged with their folder names unless 'folder_tags' is
+// false.
+func ImportHandler(a *AppContext) http.Handler {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		q := r.URL.Query()
+		overwrite := false
+		opts := archive.Options{FolderTags: true}
+
+		// Check for the 'overwrite' parameter
+		if o := q.Get("overwrite"); o != "" {
+			b, err := strconv.ParseBool(o)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write(FormatError("Unable to parse boolean from " +
+					"'overwrite' option."))
+				return
+			}
+			overwrite = b
+		}
+
+		// Check for the 'folder_tags' parameter
+		if f := q.Get("folder_tags"); f != "" {
+			b, err := strconv.ParseBool(f)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write(FormatError("Unable to parse boolean from " +
+					"'folder_tags' option."))
+				return
+			}
+			opts.FolderTags = b
+		}
+
+		body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, importMaxSize))
+		if err != nil {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			_, _ = w.Write(FormatError("The archive is too large."))
+			return
+		}
+
+		zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write(FormatError("Unable to read the zip archive."))
+			return
+		}
+
+		entries, skipped, err := archive.ReadZip(zr, opts)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write(FormatError("Unable to read the zip archive."))
+			log.Println(err)
+			return
+		}
+
+		actor, _ := a.GetUserIDFromRequest(r)
+		report, err := a.importPages(entries, skipped, overwrite, actor)
+
+		// Some batches may have been saved before an error, which the report
+		// still says
+		status := http.StatusOK
+		if err != nil {
+			status = http.StatusInternalServerError
+			log.Println(err)
+		}
+
+		j, err := json.Marshal(report)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write(FormatError("Unable to encode the response."))
+			return
+		}
+		w.WriteHeader(status)
+		_, _ = w.Write(j)
+
+	})
+
+	return RequireAuth(handler, a)
+}
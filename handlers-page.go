@@ -6,12 +6,11 @@ import (
 	"net/http"
 	"strconv"
 
-	"github.com/Depado/bfchroma"
 	"github.com/blevesearch/bleve"
 	"github.com/gorilla/mux"
+	"github.com/idrum4316/devpad-server/internal/event"
 	"github.com/idrum4316/devpad-server/internal/page"
-	"github.com/microcosm-cc/bluemonday"
-	bf "gopkg.in/russross/blackfriday.v2"
+	"github.com/idrum4316/devpad-server/internal/render"
 )
 
 // GetPagesHandler returns a list of all pages - with optional paging and
@@ -82,7 +81,7 @@ func GetPageHandler(a *AppContext) http.Handler {
 		vars := mux.Vars(r)
 		slug := vars["slug"]
 
-		pg, err := a.Store.GetPage(slug)
+		pg, err := a.Pages.GetPage(slug)
 
 		// Do this if there was an error loading the page (the page not
 		// existing is not an error).
@@ -114,25 +113,10 @@ func GetPageHandler(a *AppContext) http.Handler {
 
 		switch format[0] {
 		case "html":
-			renderer := bf.NewHTMLRenderer(bf.HTMLRendererParameters{
-				Flags: bf.CommonHTMLFlags,
-			})
-
-			if toc[0] == "true" {
-				renderer.Flags |= bf.TOC
-			}
-
-			if a.Config.SanitizeHTML {
-				unsafe := bf.Run([]byte(pg.Contents), bf.WithRenderer(renderer))
-				pg.Contents = string(bluemonday.UGCPolicy().SanitizeBytes(unsafe))
-			} else {
-				r := bfchroma.NewRenderer(
-					bfchroma.Extend(renderer),
-					bfchroma.WithoutAutodetect(),
-					bfchroma.Style("tango"),
-				)
-				pg.Contents = string(bf.Run([]byte(pg.Contents), bf.WithRenderer(r)))
-			}
+			pg.Contents = string(render.Markdown([]byte(pg.Contents), render.Options{
+				TOC:      toc[0] == "true",
+				Sanitize: a.Config.SanitizeHTML,
+			}))
 
 		case "source":
 			// Don't render the Markdown
@@ -173,8 +157,16 @@ func PutPageHandler(a *AppContext) http.Handler {
 			return
 		}
 
+		// Check if the page already exists so the right event can be sent
+		existing, err := a.Pages.GetPage(vars["slug"])
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write(FormatError("Unable to save page."))
+			return
+		}
+
 		// Update the page in datastore
-		err = a.Store.UpdatePage(pg, vars["slug"])
+		err = a.Pages.UpdatePage(pg, vars["slug"])
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			_, _ = w.Write(FormatError("Unable to save page."))
@@ -182,13 +174,24 @@ func PutPageHandler(a *AppContext) http.Handler {
 		}
 
 		// Update the page in the search index
-		err = a.Index.IndexPage(vars["slug"], pg)
+		err = a.indexPage(vars["slug"], pg)
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			_, _ = w.Write(FormatError("Unable to update search index."))
 			return
 		}
 
+		eventType := event.PageUpdated
+		if existing == nil {
+			eventType = event.PageCreated
+		}
+		actor, _ := a.GetUserIDFromRequest(r)
+		e := event.New(eventType, actor)
+		e.Slug = vars["slug"]
+		e.Title = pg.Metadata.Title
+		e.Tags = pg.Metadata.Tags
+		a.PublishEvent(e)
+
 	})
 
 	return RequireAuth(handler, a)
@@ -201,20 +204,38 @@ func DeletePageHandler(a *AppContext) http.Handler {
 		vars := mux.Vars(r)
 		pageID := vars["slug"]
 
-		err := a.Store.DeletePage(pageID)
+		pg, err := a.Pages.GetPage(pageID)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write(FormatError("Unable to delete page."))
+			return
+		}
+
+		err = a.Pages.DeletePage(pageID)
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			_, _ = w.Write(FormatError("Unable to delete page."))
 			return
 		}
 
-		err = a.Index.DeletePage(pageID)
+		err = a.indexPage(pageID, nil)
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			_, _ = w.Write(FormatError("Unable to remove page from index."))
 			return
 		}
 
+		// Deleting a page that doesn't exist isn't an error, but it isn't
+		// worth telling anyone about either.
+		if pg != nil {
+			actor, _ := a.GetUserIDFromRequest(r)
+			e := event.New(event.PageDeleted, actor)
+			e.Slug = pageID
+			e.Title = pg.Metadata.Title
+			e.Tags = pg.Metadata.Tags
+			a.PublishEvent(e)
+		}
+
 		return
 
 	})
@@ -247,7 +268,7 @@ func RenamePageHandler(a *AppContext) http.Handler {
 		}
 
 		// Rename the page
-		err := a.Store.RenamePage(pageID, newID)
+		err := a.Pages.RenamePage(pageID, newID)
 		if err != nil {
 			log.Println(err)
 			w.WriteHeader(http.StatusInternalServerError)
@@ -255,24 +276,15 @@ func RenamePageHandler(a *AppContext) http.Handler {
 			return
 		}
 
-		// Remove the old search index data
-		err = a.Index.DeletePage(pageID)
-		if err != nil {
-			log.Println(err)
-			w.WriteHeader(http.StatusInternalServerError)
-			_, _ = w.Write(FormatError("Unable to remove old page from index."))
-			return
-		}
-
-		// Index the new page ID
-		pg, err := a.Store.GetPage(newID)
+		// Move the page to its new ID in the search index
+		pg, err := a.Pages.GetPage(newID)
 		if err != nil {
 			log.Println(err)
 			w.WriteHeader(http.StatusInternalServerError)
 			_, _ = w.Write(FormatError("Unable to update search index (1)."))
 			return
 		}
-		err = a.Index.IndexPage(newID, pg)
+		err = a.indexPages(map[string]*page.Page{pageID: nil, newID: pg})
 		if err != nil {
 			log.Println(err)
 			w.WriteHeader(http.StatusInternalServerError)
@@ -280,6 +292,14 @@ func RenamePageHandler(a *AppContext) http.Handler {
 			return
 		}
 
+		actor, _ := a.GetUserIDFromRequest(r)
+		e := event.New(event.PageRenamed, actor)
+		e.Slug = newID
+		e.OldSlug = pageID
+		e.Title = pg.Metadata.Title
+		e.Tags = pg.Metadata.Tags
+		a.PublishEvent(e)
+
 		return
 
 	})
@@ -4,10 +4,8 @@ import (
 	"encoding/json"
 	"net/http"
 
-	"github.com/Depado/bfchroma"
 	"github.com/idrum4316/devpad-server/internal/page"
-	"github.com/microcosm-cc/bluemonday"
-	bf "gopkg.in/russross/blackfriday.v2"
+	"github.com/idrum4316/devpad-server/internal/render"
 )
 
 // PostPreviewHandler renders the text sent in to HTML
@@ -29,25 +27,10 @@ func PostPreviewHandler(a *AppContext) http.Handler {
 			toc = []string{"false"}
 		}
 
-		renderer := bf.NewHTMLRenderer(bf.HTMLRendererParameters{
-			Flags: bf.CommonHTMLFlags,
-		})
-
-		if toc[0] == "true" {
-			renderer.Flags |= bf.TOC
-		}
-
-		if a.Config.SanitizeHTML {
-			unsafe := bf.Run([]byte(pg.Contents), bf.WithRenderer(renderer))
-			pg.Contents = string(bluemonday.UGCPolicy().SanitizeBytes(unsafe))
-		} else {
-			r := bfchroma.NewRenderer(
-				bfchroma.Extend(renderer),
-				bfchroma.WithoutAutodetect(),
-				bfchroma.Style("tango"),
-			)
-			pg.Contents = string(bf.Run([]byte(pg.Contents), bf.WithRenderer(r)))
-		}
+		pg.Contents = string(render.Markdown([]byte(pg.Contents), render.Options{
+			TOC:      toc[0] == "true",
+			Sanitize: a.Config.SanitizeHTML,
+		}))
 
 		j, err := json.Marshal(pg)
 		if err != nil {
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/idrum4316/devpad-server/internal/search"
+)
+
+// StartReindexHandler starts rebuilding the search index from the stored
+// pages in the background. Searches keep using the old index until the new
+// one is swapped in. The response is the progress of the rebuild, which can
+// be followed with GetReindexHandler.
+func StartReindexHandler(a *AppContext) http.Handler {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		status := http.StatusAccepted
+		err := a.Index.StartRebuild(a.Pages.ForEachPage, func(err error) {
+			if err != nil {
+				log.Println("reindex:", err)
+				return
+			}
+			log.Printf("reindex: indexed %d pages.", a.Index.RebuildProgress().Indexed)
+		})
+		if err == search.ErrRebuilding {
+			status = http.StatusConflict
+		} else if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write(FormatError("Unable to rebuild the index."))
+			log.Println(err)
+			return
+		}
+
+		j, err := json.Marshal(a.Index.RebuildProgress())
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write(FormatError("Unable to encode the response."))
+			return
+		}
+		w.WriteHeader(status)
+		_, _ = w.Write(j)
+
+	})
+
+	return RequireAdmin(handler, a)
+}
+
+// GetReindexHandler returns the progress of the running rebuild of the search
+// index, or of the last one
+func GetReindexHandler(a *AppContext) http.Handler {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		j, err := json.Marshal(a.Index.RebuildProgress())
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write(FormatError("Unable to encode the response."))
+			return
+		}
+		_, _ = w.Write(j)
+
+	})
+
+	return RequireAdmin(handler, a)
+}
+
+// CheckIndexHandler compares the stored pages with the search index and
+// returns the pages that differ. With repair set, they're indexed again or
+// removed from the index.
+func CheckIndexHandler(a *AppContext, repair bool) http.Handler {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		report, err := a.checkIndex(repair)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write(FormatError("Unable to check the search index."))
+			log.Println(err)
+			return
+		}
+
+		j, err := json.Marshal(report)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write(FormatError("Unable to encode the response."))
+			return
+		}
+		_, _ = w.Write(j)
+
+	})
+
+	return RequireAdmin(handler, a)
+}
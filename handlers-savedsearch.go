@@ -0,0 +1,431 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/blevesearch/bleve"
+	"github.com/gorilla/mux"
+	"github.com/idrum4316/devpad-server/internal/savedsearch"
+)
+
+// savedSearchData is what's sent to create or change a saved search
+type savedSearchData struct {
+	Name       string   `json:"name"`
+	Query      string   `json:"query"`
+	Tags       []string `json:"tags"`
+	Sort       []string `json:"sort"`
+	Subscribed bool     `json:"subscribed"`
+}
+
+// GetSavedSearchesHandler returns the user's saved searches
+func GetSavedSearchesHandler(a *AppContext) http.Handler {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		userID, _ := a.GetUserIDFromRequest(r)
+
+		searches, err := a.Meta.ListSavedSearches(userID)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write(FormatError("error accessing database"))
+			log.Println(err)
+			return
+		}
+
+		j, err := json.Marshal(searches)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write(FormatError("Unable to encode the response."))
+			return
+		}
+		_, _ = w.Write(j)
+
+	})
+
+	return RequireAuth(handler, a)
+}
+
+// CreateSavedSearchHandler saves a new search for the user
+func CreateSavedSearchHandler(a *AppContext) http.Handler {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		userID, _ := a.GetUserIDFromRequest(r)
+
+		data, ok := readSavedSearchData(w, r)
+		if !ok {
+			return
+		}
+
+		s, err := savedsearch.New(userID, data.Name)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write(FormatError("Unable to save the search."))
+			log.Println(err)
+			return
+		}
+		data.apply(s)
+
+		if !a.saveSearch(w, s) {
+			return
+		}
+
+		j, err := json.Marshal(s)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write(FormatError("Unable to encode the response."))
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write(j)
+
+	})
+
+	return RequireAuth(handler, a)
+}
+
+// GetSavedSearchHandler returns one of the user's saved searches
+func GetSavedSearchHandler(a *AppContext) http.Handler {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		s, ok := a.getOwnSavedSearch(w, r)
+		if !ok {
+			return
+		}
+
+		j, err := json.Marshal(s)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write(FormatError("Unable to encode the response."))
+			return
+		}
+		_, _ = w.Write(j)
+
+	})
+
+	return RequireAuth(handler, a)
+}
+
+// UpdateSavedSearchHandler replaces one of the user's saved searches. When
+// the user subscribes to it, they're notified about pages changed from then
+// on.
+func UpdateSavedSearchHandler(a *AppContext) http.Handler {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		s, ok := a.getOwnSavedSearch(w, r)
+		if !ok {
+			return
+		}
+
+		data, ok := readSavedSearchData(w, r)
+		if !ok {
+			return
+		}
+
+		if !a.checkSearchName(w, s.Owner, s.ID, data.Name) {
+			return
+		}
+
+		// Only what the user can edit is changed, so a check of the search
+		// made meanwhile isn't undone
+		s, err := a.Meta.UpdateSavedSearch(s.ID, func(stored *savedsearch.SavedSearch) {
+			if data.Subscribed && !stored.Subscribed {
+				stored.Checked = time.Now()
+			}
+			stored.Name = data.Name
+			data.apply(stored)
+		})
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write(FormatError("Unable to save the search."))
+			log.Println(err)
+			return
+		}
+		if s == nil {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write(FormatError("The saved search you requested could not be found."))
+			return
+		}
+
+		j, err := json.Marshal(s)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write(FormatError("Unable to encode the response."))
+			return
+		}
+		_, _ = w.Write(j)
+
+	})
+
+	return RequireAuth(handler, a)
+}
+
+// DeleteSavedSearchHandler deletes one of the user's saved searches
+func DeleteSavedSearchHandler(a *AppContext) http.Handler {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		s, ok := a.getOwnSavedSearch(w, r)
+		if !ok {
+			return
+		}
+
+		err := a.Meta.DeleteSavedSearch(s.ID)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write(FormatError("Unable to delete the saved search."))
+			log.Println(err)
+			return
+		}
+
+	})
+
+	return RequireAuth(handler, a)
+}
+
+// RunSavedSearchHandler runs one of the user's saved searches. Its results
+// are paged with 'size' and 'from', like a search.
+func RunSavedSearchHandler(a *AppContext) http.Handler {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		s, ok := a.getOwnSavedSearch(w, r)
+		if !ok {
+			return
+		}
+
+		req := savedSearchRequest(s)
+
+		// Check for the 'size' parameter
+		size, ok := r.URL.Query()["size"]
+		if ok {
+			sizeInt, err := strconv.Atoi(size[0])
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write(FormatError("Unable to parse integer from 'size'" +
+					" option."))
+				return
+			}
+			req.Size = sizeInt
+		}
+
+		// Check for the 'from' parameter
+		from, ok := r.URL.Query()["from"]
+		if ok {
+			fromInt, err := strconv.Atoi(from[0])
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write(FormatError("Unable to parse integer from 'from'" +
+					" option."))
+				return
+			}
+			req.From = fromInt
+		}
+
+		// Add the Tags facet
+		req.AddFacet("tags", bleve.NewFacetRequest("metadata.tags", 100))
+
+		searchResults, err := a.Index.ExecuteSearch(req)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write(FormatError("Unable to process your search query."))
+			return
+		}
+
+		j, err := json.Marshal(searchResults)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write(FormatError("Unable to encode the response."))
+			return
+		}
+		_, _ = w.Write(j)
+
+	})
+
+	return RequireAuth(handler, a)
+}
+
+// GetNotificationsHandler returns the user's notifications about pages that
+// match their subscribed searches, newest first
+func GetNotificationsHandler(a *AppContext) http.Handler {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		userID, _ := a.GetUserIDFromRequest(r)
+		numNotifications := 50
+
+		// Check for the 'size' parameter
+		size, ok := r.URL.Query()["size"]
+		if ok {
+			sizeInt, err := strconv.Atoi(size[0])
+			if err != nil || sizeInt < 1 {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write(FormatError("Unable to parse integer from 'size'" +
+					" option."))
+				return
+			}
+			numNotifications = sizeInt
+		}
+		if numNotifications > 500 {
+			numNotifications = 500
+		}
+
+		notes, err := a.Meta.ListNotifications(userID, numNotifications)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write(FormatError("error accessing database"))
+			log.Println(err)
+			return
+		}
+
+		j, err := json.Marshal(notes)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write(FormatError("Unable to encode the response."))
+			return
+		}
+		_, _ = w.Write(j)
+
+	})
+
+	return RequireAuth(handler, a)
+}
+
+// DeleteNotificationsHandler clears the user's notifications
+func DeleteNotificationsHandler(a *AppContext) http.Handler {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		userID, _ := a.GetUserIDFromRequest(r)
+
+		err := a.Meta.DeleteNotifications(userID)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write(FormatError("Unable to delete notifications."))
+			log.Println(err)
+			return
+		}
+
+	})
+
+	return RequireAuth(handler, a)
+}
+
+// readSavedSearchData decodes and checks a saved search from the request. If
+// it's no good, the error is written and false is returned.
+func readSavedSearchData(w http.ResponseWriter, r *http.Request) (*savedSearchData, bool) {
+
+	data := savedSearchData{}
+	err := json.NewDecoder(r.Body).Decode(&data)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write(FormatError("Unable to decode JSON request."))
+		log.Println(err)
+		return nil, false
+	}
+
+	data.Name = strings.TrimSpace(data.Name)
+	if data.Name == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write(FormatError("You must provide a name for the search."))
+		return nil, false
+	}
+
+	if data.Query != "" {
+		_, err = bleve.NewQueryStringQuery(data.Query).Parse()
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write(FormatError("Unable to parse the query: " + err.Error()))
+			return nil, false
+		}
+	}
+
+	return &data, true
+
+}
+
+// apply copies everything but the name to the saved search
+func (d *savedSearchData) apply(s *savedsearch.SavedSearch) {
+
+	s.Query = d.Query
+	s.Tags = d.Tags
+	if s.Tags == nil {
+		s.Tags = []string{}
+	}
+	s.Sort = d.Sort
+	if s.Sort == nil {
+		s.Sort = []string{}
+	}
+	s.Subscribed = d.Subscribed
+
+}
+
+// saveSearch saves a search, unless its owner has another one with the same
+// name. If it isn't saved, the error is written and false is returned.
+func (a *AppContext) saveSearch(w http.ResponseWriter, s *savedsearch.SavedSearch) bool {
+
+	if !a.checkSearchName(w, s.Owner, s.ID, s.Name) {
+		return false
+	}
+
+	err := a.Meta.PutSavedSearch(s)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write(FormatError("Unable to save the search."))
+		log.Println(err)
+		return false
+	}
+
+	return true
+
+}
+
+// checkSearchName makes sure the owner has no saved search other than id
+// named name. If they do, the error is written and false is returned.
+func (a *AppContext) checkSearchName(w http.ResponseWriter, owner string, id string,
+	name string) bool {
+
+	searches, err := a.Meta.ListSavedSearches(owner)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write(FormatError("error accessing database"))
+		log.Println(err)
+		return false
+	}
+	for _, other := range searches {
+		if other.ID != id && strings.EqualFold(other.Name, name) {
+			w.WriteHeader(http.StatusConflict)
+			_, _ = w.Write(FormatError("You already have a saved search named '" +
+				other.Name + "'."))
+			return false
+		}
+	}
+
+	return true
+
+}
+
+// getOwnSavedSearch returns the saved search in the URL, if it belongs to
+// the user. If it doesn't, the error is written and false is returned.
+func (a *AppContext) getOwnSavedSearch(w http.ResponseWriter, r *http.Request) (*savedsearch.SavedSearch, bool) {
+
+	vars := mux.Vars(r)
+	userID, _ := a.GetUserIDFromRequest(r)
+
+	s, err := a.Meta.GetSavedSearch(vars["id"])
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write(FormatError("error accessing database"))
+		log.Println(err)
+		return nil, false
+	}
+
+	// Other users' searches are treated as though they don't exist
+	if s == nil || s.Owner != userID {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write(FormatError("The saved search you requested could not be found."))
+		return nil, false
+	}
+
+	return s, true
+
+}
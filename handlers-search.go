@@ -2,17 +2,26 @@ package main
 
 import (
 	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/blevesearch/bleve"
 	"github.com/blevesearch/bleve/search/query"
+	"github.com/gorilla/mux"
+	"github.com/idrum4316/devpad-server/internal/search"
 )
 
-// SearchHandler searches the wiki files for a search term
+// SearchHandler searches the wiki files for a search term. Results can be
+// limited to pages modified from 'modified_after' up to 'modified_before',
+// which take dates like 2006-01-02 or now-14d.
 func SearchHandler(a *AppContext) http.Handler {
 	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
+		now := time.Now()
 		searchQuery := ""
 
 		searchInput, ok := r.URL.Query()["q"]
@@ -22,28 +31,42 @@ func SearchHandler(a *AppContext) http.Handler {
 			}
 		}
 
-		queries := []query.Query{}
+		// Check for the 'tag' parameter
+		tags := r.URL.Query()["tag"]
 
-		if searchQuery == "" {
-			queries = append(queries, bleve.NewMatchAllQuery())
-		} else {
-			queries = append(queries, bleve.NewQueryStringQuery(searchQuery))
-		}
+		queries := pageQueries(searchQuery, tags)
 
-		// Check for the 'size' parameter
-		tags, ok := r.URL.Query()["tag"]
-		if ok {
-			for _, tag := range tags {
-				tagQuery := bleve.NewTermQuery(tag)
-				tagQuery.FieldVal = "metadata.tags"
-				queries = append(queries, tagQuery)
+		// Check for the 'modified_after' and 'modified_before' parameters
+		var modified [2]time.Time
+		for n, param := range []string{"modified_after", "modified_before"} {
+			v := r.URL.Query().Get(param)
+			if v == "" {
+				continue
+			}
+			t, err := search.ParseDate(v, now)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write(FormatError(fmt.Sprintf("Unable to parse date from "+
+					"'%s' option: %s.", param, err)))
+				return
 			}
+			modified[n] = t
+		}
+		after, before := modified[0], modified[1]
+		if !after.IsZero() && !before.IsZero() && !after.Before(before) {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write(FormatError("'modified_after' must be earlier than " +
+				"'modified_before'."))
+			return
+		}
+		if !after.IsZero() || !before.IsZero() {
+			queries = append(queries, search.NewModifiedQuery(after, before))
 		}
 
 		q := bleve.NewConjunctionQuery(queries...)
-		search := bleve.NewSearchRequest(q)
-		search.Highlight = bleve.NewHighlight()
-		search.Fields = []string{"contents", "metadata.title", "metadata.tags", "metadata.modified"}
+		req := bleve.NewSearchRequest(q)
+		req.Highlight = bleve.NewHighlight()
+		req.Fields = []string{"contents", "metadata.title", "metadata.tags", "metadata.modified"}
 
 		// Check for the 'size' parameter
 		size, ok := r.URL.Query()["size"]
@@ -55,7 +78,7 @@ func SearchHandler(a *AppContext) http.Handler {
 					" option."))
 				return
 			}
-			search.Size = sizeInt
+			req.Size = sizeInt
 		}
 
 		// Check for the 'from' parameter
@@ -68,23 +91,208 @@ func SearchHandler(a *AppContext) http.Handler {
 					" option."))
 				return
 			}
-			search.From = fromInt
+			req.From = fromInt
 		}
 
 		// Check for the 'sort' paramter
 		sort, ok := r.URL.Query()["sort"]
 		if ok {
-			search.SortBy(sort)
+			req.SortBy(sort)
 		}
 
 		// Add the Tags facet
 		tagsFacet := bleve.NewFacetRequest("metadata.tags", 100)
-		search.AddFacet("tags", tagsFacet)
+		req.AddFacet("tags", tagsFacet)
+
+		// Add the facet for when pages were modified
+		req.AddFacet("modified", search.NewModifiedFacet(now))
+
+		searchResults, err := a.Index.ExecuteSearch(req)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write(FormatError("Unable to process your search query."))
+			return
+		}
+
+		j, err := json.Marshal(searchResults)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write(FormatError("Unable to encode the response."))
+			return
+		}
+		_, _ = w.Write(j)
+
+	})
+
+	return RequireAuth(handler, a)
+}
+
+// The number of suggestions returned by default, and the most that can be
+// asked for
+const (
+	suggestDefaultSize = 10
+	suggestMaxSize     = 50
+)
+
+// pageQueries returns the queries for pages that match a query string and
+// have every one of the tags. An empty query string matches every page.
+func pageQueries(searchQuery string, tags []string) []query.Query {
+
+	queries := []query.Query{}
+
+	if searchQuery == "" {
+		queries = append(queries, bleve.NewMatchAllQuery())
+	} else {
+		queries = append(queries, search.NewQueryStringQuery(searchQuery))
+	}
+
+	for _, tag := range tags {
+		tagQuery := bleve.NewTermQuery(tag)
+		tagQuery.FieldVal = "metadata.tags"
+		queries = append(queries, tagQuery)
+	}
+
+	return queries
+
+}
+
+// SuggestHandler returns the pages whose titles or slugs start with what's
+// being typed, for link pickers and the like
+func SuggestHandler(a *AppContext) http.Handler {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		size := suggestDefaultSize
+
+		// Check for the 'size' parameter
+		if s := r.URL.Query().Get("size"); s != "" {
+			sizeInt, err := strconv.Atoi(s)
+			if err != nil || sizeInt < 1 || sizeInt > suggestMaxSize {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write(FormatError(fmt.Sprintf("'size' must be a number "+
+					"from 1 to %d.", suggestMaxSize)))
+				return
+			}
+			size = sizeInt
+		}
+
+		suggestions, err := a.Index.Suggest(r.URL.Query().Get("q"), size)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write(FormatError("Unable to process your search query."))
+			log.Println(err)
+			return
+		}
+
+		j, err := json.Marshal(map[string]interface{}{
+			"suggestions": suggestions,
+		})
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write(FormatError("Unable to encode the response."))
+			return
+		}
+		_, _ = w.Write(j)
+
+	})
+
+	return RequireAuth(handler, a)
+}
+
+// The number of related pages returned by default, and the most that can be
+// asked for
+const (
+	relatedDefaultSize = 10
+	relatedMaxSize     = 50
+)
+
+// RelatedPagesHandler returns the pages most like a page: the ones that share
+// its most distinctive words and its tags. The words used are returned too.
+func RelatedPagesHandler(a *AppContext) http.Handler {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		slug := mux.Vars(r)["slug"]
+		size := relatedDefaultSize
+
+		// Check for the 'size' parameter
+		if s := r.URL.Query().Get("size"); s != "" {
+			sizeInt, err := strconv.Atoi(s)
+			if err != nil || sizeInt < 1 || sizeInt > relatedMaxSize {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write(FormatError(fmt.Sprintf("'size' must be a number "+
+					"from 1 to %d.", relatedMaxSize)))
+				return
+			}
+			size = sizeInt
+		}
+
+		pg, err := a.Pages.GetPage(slug)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write(FormatError("The server encountered an error trying to " +
+				"load the requested page."))
+			log.Println(err)
+			return
+		}
+		if pg == nil {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write(FormatError("The page you requested could not be found."))
+			return
+		}
+
+		related, terms, err := a.Index.Related(slug, pg, size)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write(FormatError("Unable to find related pages."))
+			log.Println(err)
+			return
+		}
+
+		j, err := json.Marshal(map[string]interface{}{
+			"related": related,
+			"terms":   terms,
+		})
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write(FormatError("Unable to encode the response."))
+			return
+		}
+		_, _ = w.Write(j)
+
+	})
+
+	return RequireAuth(handler, a)
+}
+
+// The largest JSON search that can be posted
+const searchDSLMaxSize = 1 << 20
+
+// SearchDSLHandler runs a search written as JSON, for searches that need more
+// than a query string: boolean clauses, phrases, fuzzy, prefix and regexp
+// matches, date ranges, field boosts and facets. Mistakes in the search are
+// returned with the path to the clause they're in.
+func SearchDSLHandler(a *AppContext) http.Handler {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, searchDSLMaxSize))
+		if err != nil {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			_, _ = w.Write(FormatError("The search is too large."))
+			return
+		}
+
+		req, err := search.ParseDSL(body, time.Now())
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			j, _ := json.Marshal(err)
+			_, _ = w.Write(j)
+			return
+		}
 
-		searchResults, err := a.Index.ExecuteSearch(search)
+		searchResults, err := a.Index.ExecuteSearch(req)
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			_, _ = w.Write(FormatError("Unable to process your search query."))
+			log.Println(err)
 			return
 		}
 
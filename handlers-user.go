@@ -6,6 +6,7 @@ import (
 	"net/http"
 
 	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/idrum4316/devpad-server/internal/event"
 	"github.com/idrum4316/devpad-server/internal/user"
 )
 
@@ -29,7 +30,7 @@ func GetAuthToken(a *AppContext) http.Handler {
 			return
 		}
 
-		u, err := a.Store.GetUser(pd.Username)
+		u, err := a.Users.GetUser(pd.Username)
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			_, _ = w.Write(FormatError("error accessing database"))
@@ -127,7 +128,7 @@ func ChangePasswordHandler(a *AppContext) http.Handler {
 		}
 
 		// Fetch the user account from the datastore
-		u, err := a.Store.GetUser(userID)
+		u, err := a.Users.GetUser(userID)
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			_, _ = w.Write(FormatError("error accessing database"))
@@ -158,7 +159,7 @@ func ChangePasswordHandler(a *AppContext) http.Handler {
 		}
 
 		// Update the user in the data store
-		err = a.Store.UpdateUser(u)
+		err = a.Users.UpdateUser(u)
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			_, _ = w.Write(FormatError("unable to set new password"))
@@ -189,7 +190,7 @@ func CreateUserHandler(a *AppContext) http.Handler {
 		}
 
 		// Fetch the user account from the datastore
-		u, err := a.Store.GetUser(userID)
+		u, err := a.Users.GetUser(userID)
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			_, _ = w.Write(FormatError("error accessing database"))
@@ -244,7 +245,7 @@ func CreateUserHandler(a *AppContext) http.Handler {
 		}
 
 		// Update the user in the data store
-		err = a.Store.CreateUser(&newUser)
+		err = a.Users.CreateUser(&newUser)
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			_, _ = w.Write(FormatError("unable to set new password"))
@@ -252,9 +253,74 @@ func CreateUserHandler(a *AppContext) http.Handler {
 			return
 		}
 
+		e := event.New(event.UserCreated, userID)
+		e.UserID = newUser.ID
+		a.PublishEvent(e)
+
 		return
 
 	})
 
 	return RequireAuth(handler, a)
 }
+
+// NewFeedTokenHandler generates a new feed token for the user, replacing any
+// old one. The token is only returned this once.
+func NewFeedTokenHandler(a *AppContext) http.Handler {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		// Parse the user id from the request's auth token
+		userID, err := a.GetUserIDFromRequest(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write(FormatError("error parsing authentication token"))
+			log.Println(err)
+			return
+		}
+
+		// Fetch the user account from the datastore
+		u, err := a.Users.GetUser(userID)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write(FormatError("error accessing database"))
+			log.Println(err)
+			return
+		}
+		if u == nil {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write(FormatError("user not found"))
+			return
+		}
+
+		token, err := u.NewFeedToken()
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write(FormatError("unable to generate feed token"))
+			log.Println(err)
+			return
+		}
+
+		err = a.Users.UpdateUser(u)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write(FormatError("unable to save feed token"))
+			log.Println(err)
+			return
+		}
+
+		responseJSON, err := json.Marshal(map[string]interface{}{
+			"token": token,
+		})
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write(FormatError("unable to encode response"))
+			log.Println(err)
+			return
+		}
+
+		_, _ = w.Write(responseJSON)
+
+	})
+
+	return RequireAuth(handler, a)
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/idrum4316/devpad-server/internal/event"
+	"github.com/idrum4316/devpad-server/internal/webhook"
+)
+
+// GetWebhooksHandler returns a list of all webhooks. The secrets are left out.
+func GetWebhooksHandler(a *AppContext) http.Handler {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		hooks, err := a.Meta.ListWebhooks()
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write(FormatError("error accessing database"))
+			log.Println(err)
+			return
+		}
+
+		for _, hook := range hooks {
+			hook.Secret = ""
+		}
+
+		j, err := json.Marshal(hooks)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write(FormatError("Unable to encode the response."))
+			return
+		}
+		_, _ = w.Write(j)
+
+	})
+
+	return RequireAdmin(handler, a)
+}
+
+// CreateWebhookHandler creates a new webhook. The response is the only time
+// the webhook's signing secret is returned.
+func CreateWebhookHandler(a *AppContext) http.Handler {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		// Parse the body of the POST request
+		type PostData struct {
+			URL    string   `json:"url"`
+			Events []string `json:"events"`
+			Secret string   `json:"secret"`
+		}
+		decoder := json.NewDecoder(r.Body)
+		pd := PostData{}
+		err := decoder.Decode(&pd)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write(FormatError("Unable to decode JSON request."))
+			log.Println(err)
+			return
+		}
+
+		// Make sure the URL is something we can POST to
+		u, err := url.Parse(pd.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write(FormatError("You must provide an http or https URL."))
+			return
+		}
+
+		// Make sure the event filters are all known events
+		for _, e := range pd.Events {
+			if !event.IsValidType(e) {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write(FormatError("Unknown event type: " + e))
+				return
+			}
+		}
+
+		hook, err := webhook.New(pd.URL, pd.Events)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write(FormatError("Unable to create webhook."))
+			log.Println(err)
+			return
+		}
+		if pd.Secret != "" {
+			hook.Secret = pd.Secret
+		}
+
+		err = a.Meta.CreateWebhook(hook)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write(FormatError("Unable to save webhook."))
+			log.Println(err)
+			return
+		}
+
+		j, err := json.Marshal(hook)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write(FormatError("Unable to encode the response."))
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write(j)
+
+	})
+
+	return RequireAdmin(handler, a)
+}
+
+// DeleteWebhookHandler deletes a webhook
+func DeleteWebhookHandler(a *AppContext) http.Handler {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		vars := mux.Vars(r)
+
+		err := a.Meta.DeleteWebhook(vars["id"])
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write(FormatError("Unable to delete webhook."))
+			log.Println(err)
+			return
+		}
+
+	})
+
+	return RequireAdmin(handler, a)
+}
+
+// GetWebhookDeliveriesHandler returns the delivery log of a webhook, newest
+// first.
+func GetWebhookDeliveriesHandler(a *AppContext) http.Handler {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		vars := mux.Vars(r)
+		numDeliveries := 50
+
+		// Check for the 'size' parameter
+		size, ok := r.URL.Query()["size"]
+		if ok {
+			sizeInt, err := strconv.Atoi(size[0])
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write(FormatError("Unable to parse integer from 'size'" +
+					" option."))
+				return
+			}
+			numDeliveries = sizeInt
+		}
+
+		hook, err := a.Meta.GetWebhook(vars["id"])
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write(FormatError("error accessing database"))
+			log.Println(err)
+			return
+		}
+		if hook == nil {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write(FormatError("The webhook you requested could not be found."))
+			return
+		}
+
+		deliveries, err := a.Meta.ListDeliveries(hook.ID, numDeliveries)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write(FormatError("error accessing database"))
+			log.Println(err)
+			return
+		}
+
+		j, err := json.Marshal(deliveries)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write(FormatError("Unable to encode the response."))
+			return
+		}
+		_, _ = w.Write(j)
+
+	})
+
+	return RequireAdmin(handler, a)
+}
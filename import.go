@@ -0,0 +1,134 @@
+package main
+
+import (
+	"time"
+
+	"github.com/idrum4316/devpad-server/internal/archive"
+	"github.com/idrum4316/devpad-server/internal/event"
+	"github.com/idrum4316/devpad-server/internal/page"
+)
+
+// How many pages are written and indexed at a time during an import
+const importBatchSize = 200
+
+// importReport describes what an import did
+type importReport struct {
+	Created    []string           `json:"created"`
+	Updated    []string           `json:"updated"`
+	Skipped    []*archive.Skipped `json:"skipped"`
+	Conflicted []*importConflict  `json:"conflicted"`
+}
+
+// importConflict is a file that wasn't imported because its page is taken
+type importConflict struct {
+	Path   string `json:"path"`
+	Slug   string `json:"slug"`
+	Reason string `json:"reason"`
+}
+
+// importPages saves the pages read from a directory or archive, in batches.
+// Pages that already exist are only replaced if overwrite is set, otherwise
+// they're reported as conflicts. If an error stops the import, the report
+// covers the batches that were saved.
+func (a *AppContext) importPages(entries []*archive.Entry, skipped []*archive.Skipped,
+	overwrite bool, actor string) (*importReport, error) {
+
+	report := importReport{
+		Created:    []string{},
+		Updated:    []string{},
+		Skipped:    skipped,
+		Conflicted: []*importConflict{},
+	}
+
+	seen := map[string]string{}
+	batch := map[string]*page.Page{}
+	events := []*event.Event{}
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+
+		err := a.Pages.PutPages(batch)
+		if err != nil {
+			return err
+		}
+
+		err = a.indexPages(batch)
+		if err != nil {
+			return err
+		}
+
+		for _, e := range events {
+			a.PublishEvent(e)
+			if e.Type == event.PageCreated {
+				report.Created = append(report.Created, e.Slug)
+			} else {
+				report.Updated = append(report.Updated, e.Slug)
+			}
+		}
+
+		batch = map[string]*page.Page{}
+		events = []*event.Event{}
+		return nil
+	}
+
+	for _, entry := range entries {
+
+		// Two files can end up with the same slug, like a.md and a.markdown
+		if other, ok := seen[entry.Slug]; ok {
+			report.Conflicted = append(report.Conflicted, &importConflict{
+				Path:   entry.Path,
+				Slug:   entry.Slug,
+				Reason: "the page is also imported from " + other,
+			})
+			continue
+		}
+		seen[entry.Slug] = entry.Path
+
+		existing, err := a.Pages.GetPage(entry.Slug)
+		if err != nil {
+			return &report, err
+		}
+		if existing != nil && !overwrite {
+			report.Conflicted = append(report.Conflicted, &importConflict{
+				Path:   entry.Path,
+				Slug:   entry.Slug,
+				Reason: "the page already exists",
+			})
+			continue
+		}
+
+		p := entry.Page
+		if p.Metadata.Modified.IsZero() {
+			p.Metadata.Modified = time.Now()
+		}
+
+		eventType := event.PageCreated
+		if existing != nil {
+			eventType = event.PageUpdated
+		}
+		e := event.New(eventType, actor)
+		e.Slug = entry.Slug
+		e.Title = p.Metadata.Title
+		e.Tags = p.Metadata.Tags
+
+		batch[entry.Slug] = p
+		events = append(events, e)
+
+		if len(batch) >= importBatchSize {
+			err = flush()
+			if err != nil {
+				return &report, err
+			}
+		}
+	}
+
+	err := flush()
+	if err != nil {
+		return &report, err
+	}
+
+	return &report, nil
+
+}
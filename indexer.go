@@ -0,0 +1,101 @@
+package main
+
+import (
+	"expvar"
+	"log"
+
+	"github.com/idrum4316/devpad-server/internal/page"
+	"github.com/idrum4316/devpad-server/internal/search"
+	"github.com/idrum4316/devpad-server/internal/storage"
+)
+
+// indexPages brings the search index up to date with pages that were just
+// saved. Pages that are nil were deleted. Stores with an outbox have already
+// queued the changes along with the pages, so the indexer only needs to be
+// woken up; other stores are indexed right away.
+func (a *AppContext) indexPages(pages map[string]*page.Page) error {
+
+	if a.Indexer != nil {
+		a.Indexer.Notify()
+		return nil
+	}
+
+	return a.Index.IndexPages(pages)
+
+}
+
+// indexPage is indexPages for a single page
+func (a *AppContext) indexPage(id string, p *page.Page) error {
+	return a.indexPages(map[string]*page.Page{id: p})
+}
+
+// flushIndex applies the changes waiting in the outbox to the search index
+func (a *AppContext) flushIndex() error {
+	if a.Indexer == nil {
+		return nil
+	}
+	return a.Indexer.Flush()
+}
+
+// startIndexer starts applying queued changes to the search index in the
+// background, if the page store has an outbox. The returned function stops
+// it.
+func (a *AppContext) startIndexer() func() {
+
+	if a.Indexer == nil {
+		return func() {}
+	}
+
+	expvar.Publish("indexer", expvar.Func(func() interface{} {
+		return a.Indexer.Status()
+	}))
+
+	a.Indexer.Start()
+	return a.Indexer.Stop
+
+}
+
+// newIndexer returns an indexer for the page store's outbox, or nil if it
+// doesn't have one
+func (a *AppContext) newIndexer() *search.Indexer {
+
+	outbox, ok := a.Pages.(storage.Outbox)
+	if !ok {
+		return nil
+	}
+
+	return search.NewIndexer(outbox, a.Index, a.Pages.GetPage)
+
+}
+
+// rebuildOutdatedIndex rebuilds the search index in the background if it was
+// built with an older mapping, or other synonyms or stop words. Searches keep
+// using the old index until the new one is ready. It returns true if a
+// rebuild was started.
+func (a *AppContext) rebuildOutdatedIndex() bool {
+
+	reason, err := a.Index.Outdated()
+	if err != nil {
+		log.Println(err)
+		return false
+	}
+	if reason == "" {
+		return false
+	}
+
+	log.Printf("The search index needs rebuilding, since %s. Rebuilding it in the background.", reason)
+	err = a.Index.StartRebuild(a.Pages.ForEachPage, func(err error) {
+		if err != nil {
+			log.Println("reindex:", err)
+			return
+		}
+		log.Printf("reindex: indexed %d pages.", a.Index.RebuildProgress().Indexed)
+	})
+	if err != nil {
+		log.Println(err)
+		return false
+	}
+
+	return true
+
+}
@@ -0,0 +1,110 @@
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"testing"
+
+	"github.com/idrum4316/devpad-server/internal/page"
+)
+
+func TestRoundTrip(t *testing.T) {
+
+	slugs := []string{
+		"plain",
+		"ops:deploy",
+		"Deploy Guide",
+		"tabs\tand\nnewlines",
+		"what?",
+		"heading#anchor",
+		"100%",
+		"%41",
+		"back\\slash",
+		"slash/in/slug",
+		".hidden",
+		"ops:.hidden",
+		"..",
+		"ünïcödé space here",
+		"a-b_c.d",
+	}
+
+	buf := bytes.Buffer{}
+	w := NewWriter(&buf)
+	for _, slug := range slugs {
+		p := page.New()
+		p.Metadata.Title = slug
+		p.Contents = "contents of " + slug
+		err := w.AddPage(slug, p)
+		if err != nil {
+			t.Fatalf("%q: %s", slug, err)
+		}
+	}
+	err := w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, skipped, err := ReadZip(zr, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range skipped {
+		t.Errorf("%s was skipped: %s", s.Path, s.Reason)
+	}
+
+	got := map[string]*page.Page{}
+	for _, e := range entries {
+		got[e.Slug] = e.Page
+	}
+	for _, slug := range slugs {
+		p, ok := got[slug]
+		if !ok {
+			t.Errorf("%q didn't come back", slug)
+			continue
+		}
+		if p.Contents != "contents of "+slug {
+			t.Errorf("%q came back with %q", slug, p.Contents)
+		}
+	}
+	if len(entries) != len(slugs) {
+		t.Errorf("expected %d pages, got %d", len(slugs), len(entries))
+	}
+
+}
+
+func TestPathForRefuses(t *testing.T) {
+	for _, slug := range []string{"", ":", "ops:", ":deploy", "a::b"} {
+		if _, err := PathFor(slug); err == nil {
+			t.Errorf("expected %q to be refused", slug)
+		}
+	}
+}
+
+func TestSlugFor(t *testing.T) {
+
+	cases := map[string]string{
+		"deploy.md":              "deploy",
+		"ops/Deploy Guide.md":    "ops:Deploy-Guide",
+		"what?.md":               "what",
+		"100% done.md":           "100-done",
+		"ops/Deploy%20Guide.md":  "ops:Deploy Guide",
+		"a%3Ab.md":               "a3Ab",
+		"notes/2019/january.md":  "notes:2019:january",
+		"tabs\tand  spaces.md":   "tabs-and-spaces",
+		"%2Ehidden/page.md":      ".hidden:page",
+		"trailing%2520escape.md": "trailing%20escape",
+	}
+
+	for name, want := range cases {
+		got, ok := SlugFor(name)
+		if !ok || got != want {
+			t.Errorf("SlugFor(%q) = %q, %v; expected %q", name, got, ok, want)
+		}
+	}
+
+}
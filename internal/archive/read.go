@@ -0,0 +1,296 @@
+package archive
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/idrum4316/devpad-server/internal/page"
+)
+
+// MaxFileSize is the largest file that is read as a page
+const MaxFileSize = 8 << 20
+
+// Extensions are the file extensions that are read as pages
+var Extensions = []string{".md", ".markdown"}
+
+var (
+	atxHeading    = regexp.MustCompile(`^ {0,3}#{1,6}[ \t]+(.*?)(?:[ \t]+#+)?[ \t]*$`)
+	setextHeading = regexp.MustCompile(`^ {0,3}=+[ \t]*$`)
+	codeFence     = regexp.MustCompile("^ {0,3}(```|~~~)")
+)
+
+// Entry is a page read from a directory or archive
+type Entry struct {
+	Path string
+	Slug string
+	Page *page.Page
+}
+
+// Skipped is a file that wasn't read as a page, and why
+type Skipped struct {
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+}
+
+// Options change how files are turned into pages
+type Options struct {
+	// Pages without front matter are tagged with the names of the folders
+	// they're in
+	FolderTags bool
+}
+
+// ReadDir reads every Markdown file under dir. Hidden directories, like a
+// .git directory, are left out.
+func ReadDir(dir string, opts Options) ([]*Entry, []*Skipped, error) {
+
+	entries := []*Entry{}
+	skipped := []*Skipped{}
+
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			if p != dir && strings.HasPrefix(info.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		if info.Size() > MaxFileSize {
+			skipped = append(skipped, &Skipped{Path: rel, Reason: "file is too large"})
+			return nil
+		}
+
+		b, err := ioutil.ReadFile(p)
+		if err != nil {
+			return err
+		}
+
+		e, skip := readFile(rel, b, info.ModTime(), opts)
+		if skip != nil {
+			skipped = append(skipped, skip)
+		} else {
+			entries = append(entries, e)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return entries, skipped, nil
+
+}
+
+// ReadZip reads every Markdown file in a zip archive
+func ReadZip(r *zip.Reader, opts Options) ([]*Entry, []*Skipped, error) {
+
+	entries := []*Entry{}
+	skipped := []*Skipped{}
+
+	for _, f := range r.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+
+		if f.UncompressedSize64 > MaxFileSize {
+			skipped = append(skipped, &Skipped{Path: f.Name, Reason: "file is too large"})
+			continue
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %s", f.Name, err)
+		}
+		b, err := ioutil.ReadAll(io.LimitReader(rc, MaxFileSize))
+		rc.Close()
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %s", f.Name, err)
+		}
+
+		e, skip := readFile(f.Name, b, f.Modified, opts)
+		if skip != nil {
+			skipped = append(skipped, skip)
+		} else {
+			entries = append(entries, e)
+		}
+	}
+
+	return entries, skipped, nil
+
+}
+
+// readFile turns a file into a page, or says why it was skipped. name is the
+// slash separated path of the file in the directory or archive.
+func readFile(name string, b []byte, modTime time.Time, opts Options) (*Entry, *Skipped) {
+
+	ext := strings.ToLower(path.Ext(name))
+	if !isPageExtension(ext) {
+		return nil, &Skipped{Path: name, Reason: "not a Markdown file"}
+	}
+
+	clean := path.Clean(name)
+	if path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") {
+		return nil, &Skipped{Path: name, Reason: "path is outside of the archive"}
+	}
+
+	folders := strings.Split(path.Dir(clean), "/")
+	if folders[0] == "." {
+		folders = nil
+	}
+	for _, part := range strings.Split(clean, "/") {
+		if strings.HasPrefix(part, ".") || part == "__MACOSX" {
+			return nil, &Skipped{Path: name, Reason: "hidden file"}
+		}
+	}
+
+	slug, ok := SlugFor(clean)
+	if !ok {
+		return nil, &Skipped{Path: name, Reason: "no page name can be made from the path"}
+	}
+
+	p, err := page.ParseMarkdown(b)
+	if err != nil {
+		return nil, &Skipped{Path: name, Reason: "front matter: " + err.Error()}
+	}
+
+	if p.Metadata.Title == "" {
+		p.Metadata.Title = firstHeading(p.Contents)
+	}
+	if p.Metadata.Title == "" {
+		p.Metadata.Title = strings.TrimSuffix(path.Base(clean), path.Ext(clean))
+	}
+
+	if !page.HasFrontMatter(b) && opts.FolderTags {
+		p.Metadata.Tags = append([]string{}, folders...)
+	}
+
+	if p.Metadata.Modified.IsZero() {
+		p.Metadata.Modified = modTime
+	}
+
+	return &Entry{Path: name, Slug: slug, Page: p}, nil
+
+}
+
+// SlugFor returns the slug of the page kept at a slash separated path.
+// Folders become namespaces, so ops/Deploy Guide.md is "ops:Deploy-Guide".
+// Names percent-encoded by PathFor are decoded as they are, so exported pages
+// keep their slugs.
+func SlugFor(name string) (string, bool) {
+
+	name = strings.TrimSuffix(name, path.Ext(name))
+
+	parts := strings.Split(name, "/")
+	for i, part := range parts {
+		if unescaped, ok := unescapePart(part); ok {
+			parts[i] = unescaped
+			continue
+		}
+		parts[i] = slugPart(part)
+		if parts[i] == "" {
+			return "", false
+		}
+	}
+
+	return strings.Join(parts, ":"), true
+
+}
+
+// unescapePart decodes a file or folder name that was percent-encoded by
+// PathFor. Names without valid escapes, or that would decode to something
+// that isn't part of a slug, aren't decoded.
+func unescapePart(part string) (string, bool) {
+
+	if !strings.Contains(part, "%") {
+		return "", false
+	}
+
+	unescaped, err := url.PathUnescape(part)
+	if err != nil || unescaped == "" || strings.Contains(unescaped, ":") {
+		return "", false
+	}
+
+	return unescaped, true
+
+}
+
+// slugPart turns a file or folder name into part of a slug: whitespace
+// becomes dashes, and characters with a meaning in slugs or URLs are dropped
+func slugPart(s string) string {
+
+	s = strings.Join(strings.FieldsFunc(s, unicode.IsSpace), "-")
+
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`:/\?#%`, r) || unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, s)
+
+}
+
+// firstHeading returns the text of the first heading in Markdown contents,
+// skipping over code blocks
+func firstHeading(contents string) string {
+
+	scanner := bufio.NewScanner(bytes.NewReader([]byte(contents)))
+	scanner.Buffer(nil, MaxFileSize)
+
+	inFence := false
+	previous := ""
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+
+		if codeFence.MatchString(line) {
+			inFence = !inFence
+			previous = ""
+			continue
+		}
+		if inFence {
+			continue
+		}
+
+		if m := atxHeading.FindStringSubmatch(line); m != nil && m[1] != "" {
+			return m[1]
+		}
+		if strings.TrimSpace(previous) != "" && setextHeading.MatchString(line) {
+			return strings.TrimSpace(previous)
+		}
+
+		previous = line
+	}
+
+	return ""
+
+}
+
+// isPageExtension returns true if files with the extension are pages
+func isPageExtension(ext string) bool {
+	for _, e := range Extensions {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,94 @@
+package archive
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+
+	"github.com/idrum4316/devpad-server/internal/page"
+)
+
+// Writer writes pages to a zip archive, in the layout ReadZip reads them from
+type Writer struct {
+	zw *zip.Writer
+}
+
+// NewWriter returns a Writer that writes a zip archive to w
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{zw: zip.NewWriter(w)}
+}
+
+// AddPage adds a page to the archive as a Markdown file with front matter
+func (w *Writer) AddPage(slug string, p *page.Page) error {
+
+	name, err := PathFor(slug)
+	if err != nil {
+		return err
+	}
+
+	b, err := p.MarshalMarkdown()
+	if err != nil {
+		return err
+	}
+
+	header := zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: p.Metadata.Modified,
+	}
+	f, err := w.zw.CreateHeader(&header)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(b)
+	return err
+
+}
+
+// Close finishes the archive. It doesn't close the underlying writer.
+func (w *Writer) Close() error {
+	return w.zw.Close()
+}
+
+// PathFor returns the slash separated path a page is kept at in an archive.
+// Namespaces become folders, so "ops:deploy" is ops/deploy.md. Characters
+// that SlugFor would change or that would hide the file (whitespace, slashes,
+// '?', '#', '%', control characters and a leading '.') are percent-encoded,
+// so SlugFor turns the path back into the same slug. Slugs with an empty
+// namespace can't be kept in an archive.
+func PathFor(slug string) (string, error) {
+
+	parts := strings.Split(slug, ":")
+	for i, part := range parts {
+		if part == "" {
+			return "", fmt.Errorf("page %q can't be stored in an archive", slug)
+		}
+		parts[i] = escapePart(part)
+	}
+
+	return strings.Join(parts, "/") + Extensions[0], nil
+
+}
+
+// escapePart percent-encodes the characters of a slug part that can't be
+// kept in a file or folder name as they are
+func escapePart(part string) string {
+
+	var b strings.Builder
+	for i, r := range part {
+		if unicode.IsSpace(r) || unicode.IsControl(r) ||
+			strings.ContainsRune(`/\?#%`, r) || (i == 0 && r == '.') {
+			for _, c := range []byte(string(r)) {
+				fmt.Fprintf(&b, "%%%02X", c)
+			}
+			continue
+		}
+		b.WriteRune(r)
+	}
+
+	return b.String()
+
+}
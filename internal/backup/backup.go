@@ -0,0 +1,168 @@
+package backup
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ManifestName is the name of the manifest in a backup
+const ManifestName = "manifest.json"
+
+// Version is the version of the backup format
+const Version = 1
+
+// Manifest describes a backup: what it was made from, and the files in it
+// with their checksums
+type Manifest struct {
+	Version       int       `json:"version"`
+	Created       time.Time `json:"created"`
+	ServerVersion string    `json:"server_version"`
+
+	// The storage settings of the server the backup was made on, which say
+	// what the files are
+	Storage     string `json:"storage"`
+	PageStorage string `json:"page_storage"`
+
+	// Whether the search index is included. Without it, the index has to be
+	// rebuilt from the pages when the backup is restored.
+	Index bool `json:"index"`
+
+	Files []*File `json:"files"`
+}
+
+// File is a file in a backup
+type File struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Writer writes a backup as a tar archive. The files come first, and the
+// manifest comes last, once all of the checksums are known.
+type Writer struct {
+	tw       *tar.Writer
+	manifest *Manifest
+}
+
+// NewWriter returns a Writer that writes a backup to w. The manifest's list of
+// files is filled in as they're added.
+func NewWriter(w io.Writer, m *Manifest) *Writer {
+	m.Version = Version
+	m.Files = []*File{}
+	return &Writer{
+		tw:       tar.NewWriter(w),
+		manifest: m,
+	}
+}
+
+// AddFile adds the file at path to the backup as name, a slash separated path
+func (w *Writer) AddFile(name, path string) error {
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	err = w.tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     info.Size(),
+		Mode:     0600,
+		ModTime:  info.ModTime(),
+	})
+	if err != nil {
+		return err
+	}
+
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(w.tw, h), io.LimitReader(f, info.Size()))
+	if err != nil {
+		return err
+	}
+	if n != info.Size() {
+		return fmt.Errorf("%s changed while it was being backed up", path)
+	}
+
+	w.manifest.Files = append(w.manifest.Files, &File{
+		Name:   name,
+		Size:   n,
+		SHA256: hex.EncodeToString(h.Sum(nil)),
+	})
+
+	return nil
+
+}
+
+// AddDir adds every file under dir to the backup, in the folder name. Hidden
+// files and folders are left out, and so are files that are removed before
+// they're added.
+func (w *Writer) AddDir(name, dir string) error {
+	return filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if p != dir && strings.HasPrefix(info.Name(), ".") {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		err = w.AddFile(name+"/"+filepath.ToSlash(rel), p)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	})
+}
+
+// Close writes the manifest and finishes the archive. It doesn't close the
+// underlying writer.
+func (w *Writer) Close() error {
+
+	j, err := json.MarshalIndent(w.manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = w.tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     ManifestName,
+		Size:     int64(len(j)),
+		Mode:     0600,
+		ModTime:  w.manifest.Created,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = w.tw.Write(j)
+	if err != nil {
+		return err
+	}
+
+	return w.tw.Close()
+
+}
@@ -0,0 +1,146 @@
+package backup
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// The largest manifest that is read
+const maxManifestSize = 16 << 20
+
+// Extract reads a backup archive into dir, which must already exist, and
+// checks every file against the manifest. Files missing from the archive,
+// files that aren't in the manifest and checksums that don't match are all
+// errors, in which case dir is left with whatever was extracted.
+func Extract(r io.Reader, dir string) (*Manifest, error) {
+
+	tr := tar.NewReader(r)
+	extracted := map[string]*File{}
+	var manifest *Manifest
+
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if h.Typeflag == tar.TypeDir {
+			continue
+		}
+		if h.Typeflag != tar.TypeReg {
+			return nil, fmt.Errorf("%s: not a regular file", h.Name)
+		}
+
+		if h.Name == ManifestName {
+			manifest, err = readManifest(tr)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if _, ok := extracted[h.Name]; ok {
+			return nil, fmt.Errorf("%s is in the archive twice", h.Name)
+		}
+		f, err := extractFile(tr, h.Name, dir)
+		if err != nil {
+			return nil, err
+		}
+		extracted[h.Name] = f
+	}
+
+	if manifest == nil {
+		return nil, errors.New("the archive has no manifest; it isn't a backup, or it was cut short")
+	}
+
+	for _, want := range manifest.Files {
+		got, ok := extracted[want.Name]
+		if !ok {
+			return nil, fmt.Errorf("%s is missing from the archive", want.Name)
+		}
+		if got.Size != want.Size || got.SHA256 != want.SHA256 {
+			return nil, fmt.Errorf("%s doesn't match its checksum", want.Name)
+		}
+		delete(extracted, want.Name)
+	}
+	for name := range extracted {
+		return nil, fmt.Errorf("%s isn't in the manifest", name)
+	}
+
+	return manifest, nil
+
+}
+
+// readManifest reads the manifest, making sure it's a version that can be
+// restored
+func readManifest(r io.Reader) (*Manifest, error) {
+
+	b, err := ioutil.ReadAll(io.LimitReader(r, maxManifestSize))
+	if err != nil {
+		return nil, err
+	}
+
+	m := Manifest{}
+	err = json.Unmarshal(b, &m)
+	if err != nil {
+		return nil, fmt.Errorf("manifest: %s", err)
+	}
+	if m.Version < 1 || m.Version > Version {
+		return nil, fmt.Errorf("backup format version %d isn't supported", m.Version)
+	}
+
+	return &m, nil
+
+}
+
+// extractFile writes a file from the archive to dir, returning its size and
+// checksum
+func extractFile(r io.Reader, name, dir string) (*File, error) {
+
+	clean := path.Clean(name)
+	if clean != name || path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") {
+		return nil, fmt.Errorf("%s: path is outside of the backup", name)
+	}
+
+	p := filepath.Join(dir, filepath.FromSlash(clean))
+	err := os.MkdirAll(filepath.Dir(p), 0700)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(f, h), r)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", name, err)
+	}
+
+	err = f.Sync()
+	if err != nil {
+		return nil, err
+	}
+
+	return &File{
+		Name:   name,
+		Size:   n,
+		SHA256: hex.EncodeToString(h.Sum(nil)),
+	}, nil
+
+}
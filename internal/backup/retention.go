@@ -0,0 +1,109 @@
+package backup
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Backups are named after when they were made, in UTC
+const (
+	archivePrefix     = "devpad-backup-"
+	archiveSuffix     = ".tar"
+	archiveTimeFormat = "2006-01-02-150405Z"
+)
+
+// tempSuffix is added to the name of a backup while it's being written
+const tempSuffix = ".tmp"
+
+// Archive is a backup in the backup directory
+type Archive struct {
+	Name    string    `json:"name"`
+	Created time.Time `json:"created"`
+	Size    int64     `json:"size"`
+}
+
+// ArchiveName returns the file name of a backup made at t. It's in UTC, so
+// backups made an hour apart when the clocks go back don't get the same name.
+func ArchiveName(t time.Time) string {
+	return archivePrefix + t.UTC().Format(archiveTimeFormat) + archiveSuffix
+}
+
+// List returns the backups in dir, newest first. Other files are ignored.
+func List(dir string) ([]*Archive, error) {
+
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	archives := []*Archive{}
+	for _, info := range infos {
+		name := info.Name()
+		if !info.Mode().IsRegular() || !strings.HasPrefix(name, archivePrefix) ||
+			!strings.HasSuffix(name, archiveSuffix) {
+			continue
+		}
+
+		stamp := strings.TrimSuffix(strings.TrimPrefix(name, archivePrefix), archiveSuffix)
+		created, err := time.Parse(archiveTimeFormat, stamp)
+		if err != nil {
+			continue
+		}
+		created = created.Local()
+
+		archives = append(archives, &Archive{
+			Name:    name,
+			Created: created,
+			Size:    info.Size(),
+		})
+	}
+
+	sort.Slice(archives, func(i, j int) bool {
+		return archives[i].Created.After(archives[j].Created)
+	})
+
+	return archives, nil
+
+}
+
+// Expired returns the backups that aren't kept by the retention rules: the
+// newest backup of each of the last keepDaily days that have one, and the
+// newest of each of the last keepWeekly weeks. The newest backup is always
+// kept. archives must be sorted newest first, as List returns them.
+func Expired(archives []*Archive, keepDaily, keepWeekly int) []*Archive {
+
+	keep := map[*Archive]bool{}
+	if len(archives) > 0 {
+		keep[archives[0]] = true
+	}
+
+	days := map[string]bool{}
+	weeks := map[string]bool{}
+	for _, a := range archives {
+		day := a.Created.Format("2006-01-02")
+		if !days[day] && len(days) < keepDaily {
+			days[day] = true
+			keep[a] = true
+		}
+
+		year, w := a.Created.ISOWeek()
+		week := fmt.Sprintf("%d-%d", year, w)
+		if !weeks[week] && len(weeks) < keepWeekly {
+			weeks[week] = true
+			keep[a] = true
+		}
+	}
+
+	expired := []*Archive{}
+	for _, a := range archives {
+		if !keep[a] {
+			expired = append(expired, a)
+		}
+	}
+
+	return expired
+
+}
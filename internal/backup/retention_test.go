@@ -0,0 +1,165 @@
+package backup
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/idrum4316/devpad-server/internal/cron"
+)
+
+func TestArchiveName(t *testing.T) {
+
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("no time zone database:", err)
+	}
+
+	// 01:30 happens twice when the clocks go back
+	first := time.Date(2020, 11, 1, 5, 30, 0, 0, time.UTC).In(ny)
+	second := first.Add(time.Hour)
+	if first.Format("15:04") != second.Format("15:04") {
+		t.Fatal("expected the same local time twice")
+	}
+
+	if ArchiveName(first) == ArchiveName(second) {
+		t.Errorf("both backups are named %s", ArchiveName(first))
+	}
+	if want := "devpad-backup-2020-11-01-053000Z.tar"; ArchiveName(first) != want {
+		t.Errorf("expected %s, got %s", want, ArchiveName(first))
+	}
+
+}
+
+func TestList(t *testing.T) {
+
+	dir := t.TempDir()
+	created := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	old := time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	for _, name := range []string{
+		ArchiveName(created),
+		ArchiveName(old),
+		ArchiveName(created.Add(time.Hour)) + tempSuffix,
+		"devpad-backup-garbage.tar",
+		"notes.txt",
+	} {
+		err := ioutil.WriteFile(filepath.Join(dir, name), []byte("x"), 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	archives, err := List(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(archives) != 2 {
+		t.Fatalf("expected 2 backups, got %d", len(archives))
+	}
+	if !archives[0].Created.Equal(created) {
+		t.Errorf("expected the newest backup to be from %s, got %s", created, archives[0].Created)
+	}
+	if !archives[1].Created.Equal(old) {
+		t.Errorf("expected the oldest backup to be from %s, got %s", old, archives[1].Created)
+	}
+
+}
+
+func TestExpired(t *testing.T) {
+
+	day := func(d, h int) *Archive {
+		created := time.Date(2020, 6, d, h, 0, 0, 0, time.Local)
+		return &Archive{Name: ArchiveName(created), Created: created}
+	}
+
+	// Two backups a day from Monday the 1st to Sunday the 14th, newest first
+	archives := []*Archive{}
+	for d := 14; d >= 1; d-- {
+		archives = append(archives, day(d, 18), day(d, 6))
+	}
+
+	cases := []struct {
+		name       string
+		keepDaily  int
+		keepWeekly int
+		kept       []string
+	}{
+		{"nothing", 0, 0, []string{"14 18"}},
+		{"daily", 3, 0, []string{"14 18", "13 18", "12 18"}},
+		{"weekly", 0, 2, []string{"14 18", "7 18"}},
+		{"both", 2, 2, []string{"14 18", "13 18", "7 18"}},
+		{"more than there are", 30, 10, []string{
+			"14 18", "13 18", "12 18", "11 18", "10 18", "9 18", "8 18",
+			"7 18", "6 18", "5 18", "4 18", "3 18", "2 18", "1 18",
+		}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+
+			expired := map[*Archive]bool{}
+			for _, a := range Expired(archives, c.keepDaily, c.keepWeekly) {
+				expired[a] = true
+			}
+
+			kept := []string{}
+			for _, a := range archives {
+				if !expired[a] {
+					kept = append(kept, a.Created.Format("2 15"))
+				}
+			}
+
+			if strings.Join(kept, ",") != strings.Join(c.kept, ",") {
+				t.Errorf("expected %v to be kept, got %v", c.kept, kept)
+			}
+
+		})
+	}
+
+	if n := len(Expired(nil, 1, 1)); n != 0 {
+		t.Errorf("expected nothing to expire, got %d", n)
+	}
+
+}
+
+func TestPruneRemovesUnfinished(t *testing.T) {
+
+	schedule, err := cron.Parse("@daily")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	s := NewScheduler(dir, schedule, func(w io.Writer) error {
+		_, err := w.Write([]byte("backup"))
+		return err
+	})
+
+	unfinished := filepath.Join(dir, ArchiveName(time.Now().Add(-time.Hour))+tempSuffix)
+	err = ioutil.WriteFile(unfinished, []byte("partial"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(unfinished); !os.IsNotExist(err) {
+		t.Error("the unfinished backup wasn't removed")
+	}
+	archives, err := List(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(archives) != 1 {
+		t.Errorf("expected 1 backup, got %d", len(archives))
+	}
+
+}
@@ -0,0 +1,282 @@
+package backup
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/idrum4316/devpad-server/internal/cron"
+)
+
+// Scheduler makes backups on a schedule and keeps them in a directory,
+// removing old ones by its retention rules
+type Scheduler struct {
+	Dir        string
+	Schedule   *cron.Schedule
+	KeepDaily  int
+	KeepWeekly int
+
+	// Backup writes a backup to w
+	Backup func(w io.Writer) error
+
+	mu     sync.Mutex
+	status Status
+	stop   chan struct{}
+	wg     sync.WaitGroup
+}
+
+// Status is what the scheduler has done, and what it will do next
+type Status struct {
+	Enabled             bool       `json:"enabled"`
+	Schedule            string     `json:"schedule"`
+	Dir                 string     `json:"dir"`
+	Running             bool       `json:"running"`
+	NextRun             *time.Time `json:"next_run"`
+	LastSuccess         *time.Time `json:"last_success"`
+	LastFailure         *time.Time `json:"last_failure"`
+	LastError           string     `json:"last_error,omitempty"`
+	LastArchive         *Archive   `json:"last_archive"`
+	LastDuration        float64    `json:"last_duration_seconds"`
+	Failures            int        `json:"failures"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	Archives            []*Archive `json:"archives"`
+}
+
+// NewScheduler returns a new Scheduler with default retention rules
+func NewScheduler(dir string, schedule *cron.Schedule, backup func(w io.Writer) error) *Scheduler {
+	return &Scheduler{
+		Dir:        dir,
+		Schedule:   schedule,
+		KeepDaily:  7,
+		KeepWeekly: 4,
+		Backup:     backup,
+	}
+}
+
+// Start makes backups in the background until Stop is called
+func (s *Scheduler) Start() {
+
+	s.stop = make(chan struct{})
+	s.wg.Add(1)
+
+	go func() {
+		defer s.wg.Done()
+
+		for {
+			next := s.Schedule.Next(time.Now())
+			if next.IsZero() {
+				log.Printf("backup: schedule %q never runs", s.Schedule)
+				return
+			}
+
+			s.mu.Lock()
+			s.status.NextRun = &next
+			s.mu.Unlock()
+
+			timer := time.NewTimer(time.Until(next))
+			select {
+			case <-s.stop:
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+
+			err := s.Run()
+			if err != nil {
+				log.Println("backup:", err)
+			}
+		}
+	}()
+
+}
+
+// Stop stops making backups, waiting for one that's being made to finish
+func (s *Scheduler) Stop() {
+	close(s.stop)
+	s.wg.Wait()
+}
+
+// Run makes a backup now, then removes the ones that are no longer kept
+func (s *Scheduler) Run() error {
+
+	s.mu.Lock()
+	if s.status.Running {
+		s.mu.Unlock()
+		return errors.New("a backup is already being made")
+	}
+	s.status.Running = true
+	s.mu.Unlock()
+
+	start := time.Now()
+	archive, err := s.write(start)
+
+	s.mu.Lock()
+	now := time.Now()
+	s.status.Running = false
+	s.status.LastDuration = now.Sub(start).Seconds()
+	if err != nil {
+		s.status.LastFailure = &now
+		s.status.LastError = err.Error()
+		s.status.Failures++
+		s.status.ConsecutiveFailures++
+	} else {
+		s.status.LastSuccess = &now
+		s.status.LastError = ""
+		s.status.LastArchive = archive
+		s.status.ConsecutiveFailures = 0
+	}
+	s.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+	log.Printf("backup: wrote %s (%d bytes).", archive.Name, archive.Size)
+
+	return s.prune()
+
+}
+
+// write writes a backup to the directory. It's written to a temporary file
+// first, so a backup that fails part of the way is never left looking like a
+// finished one.
+func (s *Scheduler) write(t time.Time) (*Archive, error) {
+
+	err := os.MkdirAll(s.Dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+
+	name := ArchiveName(t)
+	p := filepath.Join(s.Dir, name)
+	tmp := p + tempSuffix
+
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.Backup(f)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, p)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return nil, err
+	}
+
+	info, err := os.Stat(p)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Archive{Name: name, Created: t, Size: info.Size()}, nil
+
+}
+
+// prune removes the backups that the retention rules don't keep, and the
+// temporary files of backups that were never finished because the server
+// stopped while they were being written
+func (s *Scheduler) prune() error {
+
+	infos, err := ioutil.ReadDir(s.Dir)
+	if err != nil {
+		return err
+	}
+	for _, info := range infos {
+		name := info.Name()
+		if !info.Mode().IsRegular() || !strings.HasPrefix(name, archivePrefix) ||
+			!strings.HasSuffix(name, archiveSuffix+tempSuffix) {
+			continue
+		}
+		err = os.Remove(filepath.Join(s.Dir, name))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		log.Printf("backup: removed unfinished %s.", name)
+	}
+
+	archives, err := List(s.Dir)
+	if err != nil {
+		return err
+	}
+
+	for _, a := range Expired(archives, s.KeepDaily, s.KeepWeekly) {
+		err = os.Remove(filepath.Join(s.Dir, a.Name))
+		if err != nil {
+			return err
+		}
+		log.Printf("backup: removed %s.", a.Name)
+	}
+
+	return nil
+
+}
+
+// Status returns what the scheduler has done, along with the backups that are
+// in the directory
+func (s *Scheduler) Status() Status {
+
+	s.mu.Lock()
+	status := s.status
+	s.mu.Unlock()
+
+	status.Enabled = true
+	status.Schedule = s.Schedule.String()
+	status.Dir = s.Dir
+
+	archives, err := List(s.Dir)
+	if err != nil {
+		archives = []*Archive{}
+	}
+	status.Archives = archives
+
+	return status
+
+}
+
+// Metrics returns the scheduler's status as numbers, for monitoring. Times
+// are Unix timestamps, and 0 if they haven't happened.
+func (s *Scheduler) Metrics() map[string]interface{} {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	unix := func(t *time.Time) int64 {
+		if t == nil {
+			return 0
+		}
+		return t.Unix()
+	}
+
+	running, size := 0, int64(0)
+	if s.status.Running {
+		running = 1
+	}
+	if s.status.LastArchive != nil {
+		size = s.status.LastArchive.Size
+	}
+
+	return map[string]interface{}{
+		"running":               running,
+		"next_run":              unix(s.status.NextRun),
+		"last_success":          unix(s.status.LastSuccess),
+		"last_failure":          unix(s.status.LastFailure),
+		"last_duration_seconds": s.status.LastDuration,
+		"last_size_bytes":       size,
+		"failures_total":        s.status.Failures,
+		"consecutive_failures":  s.status.ConsecutiveFailures,
+	}
+
+}
@@ -0,0 +1,302 @@
+package collab
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"unicode/utf16"
+)
+
+// Component is a single step of an Operation. Exactly one of its fields is
+// set.
+type Component struct {
+	Retain int
+	Insert string
+	Delete int
+}
+
+// Operation is a text operation in the same format as the ot.js library. It
+// walks over the whole document, retaining, inserting and deleting text. All
+// lengths are counted in UTF-16 code units, like JavaScript strings.
+//
+// In JSON, a positive number retains, a negative number deletes and a string
+// inserts.
+type Operation []Component
+
+// Retain appends a retain component, merging it with the last component if
+// possible
+func (o Operation) Retain(n int) Operation {
+	if n <= 0 {
+		return o
+	}
+	if l := len(o); l > 0 && o[l-1].Retain > 0 {
+		o[l-1].Retain += n
+		return o
+	}
+	return append(o, Component{Retain: n})
+}
+
+// Insert appends an insert component. Inserts are always placed before a
+// trailing delete, so equivalent operations have the same representation.
+func (o Operation) Insert(s string) Operation {
+	if s == "" {
+		return o
+	}
+	l := len(o)
+	if l > 0 && o[l-1].Insert != "" {
+		o[l-1].Insert += s
+		return o
+	}
+	if l > 0 && o[l-1].Delete > 0 {
+		if l > 1 && o[l-2].Insert != "" {
+			o[l-2].Insert += s
+			return o
+		}
+		o = append(o, o[l-1])
+		o[l-1] = Component{Insert: s}
+		return o
+	}
+	return append(o, Component{Insert: s})
+}
+
+// Delete appends a delete component, merging it with the last component if
+// possible
+func (o Operation) Delete(n int) Operation {
+	if n <= 0 {
+		return o
+	}
+	if l := len(o); l > 0 && o[l-1].Delete > 0 {
+		o[l-1].Delete += n
+		return o
+	}
+	return append(o, Component{Delete: n})
+}
+
+// BaseLength is the length of the document the operation can be applied to
+func (o Operation) BaseLength() int {
+	n := 0
+	for _, c := range o {
+		n += c.Retain + c.Delete
+	}
+	return n
+}
+
+// TargetLength is the length of the document after the operation is applied
+func (o Operation) TargetLength() int {
+	n := 0
+	for _, c := range o {
+		n += c.Retain + textLength(c.Insert)
+	}
+	return n
+}
+
+// Apply applies the operation to a document
+func (o Operation) Apply(doc []uint16) ([]uint16, error) {
+
+	if len(doc) != o.BaseLength() {
+		return nil, fmt.Errorf("operation expects a document of length %d, got %d",
+			o.BaseLength(), len(doc))
+	}
+
+	result := make([]uint16, 0, o.TargetLength())
+	pos := 0
+	for _, c := range o {
+		switch {
+		case c.Retain > 0:
+			result = append(result, doc[pos:pos+c.Retain]...)
+			pos += c.Retain
+		case c.Insert != "":
+			result = append(result, encodeText(c.Insert)...)
+		case c.Delete > 0:
+			pos += c.Delete
+		}
+	}
+
+	return result, nil
+
+}
+
+// Transform takes two operations a and b that were made concurrently on the
+// same document and returns a' and b', so that applying a then b' gives the
+// same result as applying b then a'. When both insert at the same position,
+// the text from a comes first.
+func Transform(a, b Operation) (Operation, Operation, error) {
+
+	if a.BaseLength() != b.BaseLength() {
+		return nil, nil, errors.New("both operations must have the same base length")
+	}
+
+	var aPrime, bPrime Operation
+	i, j := 0, 0
+	var c1, c2 *Component
+
+	next := func(o Operation, idx *int) *Component {
+		if *idx >= len(o) {
+			return nil
+		}
+		c := o[*idx]
+		*idx++
+		return &c
+	}
+	c1 = next(a, &i)
+	c2 = next(b, &j)
+
+	for c1 != nil || c2 != nil {
+
+		// Inserts don't depend on the other operation
+		if c1 != nil && c1.Insert != "" {
+			aPrime = aPrime.Insert(c1.Insert)
+			bPrime = bPrime.Retain(textLength(c1.Insert))
+			c1 = next(a, &i)
+			continue
+		}
+		if c2 != nil && c2.Insert != "" {
+			aPrime = aPrime.Retain(textLength(c2.Insert))
+			bPrime = bPrime.Insert(c2.Insert)
+			c2 = next(b, &j)
+			continue
+		}
+
+		if c1 == nil || c2 == nil {
+			return nil, nil, errors.New("operations do not cover the same document")
+		}
+
+		len1 := c1.Retain + c1.Delete
+		len2 := c2.Retain + c2.Delete
+		min := len1
+		if len2 < min {
+			min = len2
+		}
+
+		switch {
+		case c1.Retain > 0 && c2.Retain > 0:
+			aPrime = aPrime.Retain(min)
+			bPrime = bPrime.Retain(min)
+		case c1.Delete > 0 && c2.Retain > 0:
+			aPrime = aPrime.Delete(min)
+		case c1.Retain > 0 && c2.Delete > 0:
+			bPrime = bPrime.Delete(min)
+		}
+		// When both delete the same text there's nothing left to do
+
+		// Consume what was used from both components
+		if len1 == min {
+			c1 = next(a, &i)
+		} else if c1.Retain > 0 {
+			c1.Retain -= min
+		} else {
+			c1.Delete -= min
+		}
+		if len2 == min {
+			c2 = next(b, &j)
+		} else if c2.Retain > 0 {
+			c2.Retain -= min
+		} else {
+			c2.Delete -= min
+		}
+
+	}
+
+	return aPrime, bPrime, nil
+
+}
+
+// TransformIndex moves a position in the document (like a cursor) to where it
+// is after the operation is applied
+func (o Operation) TransformIndex(index int) int {
+
+	newIndex := index
+	for _, c := range o {
+		switch {
+		case c.Retain > 0:
+			index -= c.Retain
+		case c.Insert != "":
+			newIndex += textLength(c.Insert)
+		case c.Delete > 0:
+			if index < c.Delete {
+				newIndex -= index
+			} else {
+				newIndex -= c.Delete
+			}
+			index -= c.Delete
+		}
+		if index < 0 {
+			break
+		}
+	}
+
+	return newIndex
+
+}
+
+// MarshalJSON encodes the operation in the ot.js format
+func (o Operation) MarshalJSON() ([]byte, error) {
+	parts := make([]interface{}, len(o))
+	for i, c := range o {
+		switch {
+		case c.Retain > 0:
+			parts[i] = c.Retain
+		case c.Insert != "":
+			parts[i] = c.Insert
+		default:
+			parts[i] = -c.Delete
+		}
+	}
+	return json.Marshal(parts)
+}
+
+// UnmarshalJSON decodes an operation in the ot.js format
+func (o *Operation) UnmarshalJSON(b []byte) error {
+
+	parts := []interface{}{}
+	err := json.Unmarshal(b, &parts)
+	if err != nil {
+		return err
+	}
+
+	op := Operation{}
+	for _, p := range parts {
+		switch v := p.(type) {
+		case float64:
+			if v != float64(int(v)) {
+				return errors.New("operation lengths must be integers")
+			}
+			if v > 0 {
+				op = op.Retain(int(v))
+			} else if v < 0 {
+				op = op.Delete(int(-v))
+			}
+		case string:
+			op = op.Insert(v)
+		default:
+			return errors.New("operation components must be numbers or strings")
+		}
+	}
+
+	*o = op
+	return nil
+
+}
+
+// encodeText converts a string to UTF-16 code units
+func encodeText(s string) []uint16 {
+	return utf16.Encode([]rune(s))
+}
+
+// decodeText converts UTF-16 code units back to a string
+func decodeText(doc []uint16) string {
+	return string(utf16.Decode(doc))
+}
+
+// textLength returns the length of a string in UTF-16 code units
+func textLength(s string) int {
+	n := 0
+	for _, r := range s {
+		if r >= 0x10000 {
+			n += 2
+		} else {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,568 @@
+package collab
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"sync"
+	"time"
+)
+
+// Errors returned by the functions a Manager loads and saves pages with
+var (
+	// ErrNotFound means the page doesn't exist. Sessions are only opened for
+	// pages that do.
+	ErrNotFound = errors.New("page not found")
+
+	// ErrConflict means the page was changed, renamed or deleted since the
+	// session loaded or last saved it. It isn't saved, and the session ends.
+	ErrConflict = errors.New("the page was changed outside of the editing session")
+)
+
+// maxHistory is how many operations a session remembers. Clients that fall
+// further behind than this have to resync from a snapshot.
+const maxHistory = 1000
+
+// Message types
+const (
+	TypeInit   = "init"
+	TypeOp     = "op"
+	TypeAck    = "ack"
+	TypeCursor = "cursor"
+	TypeJoin   = "join"
+	TypeLeave  = "leave"
+	TypeError  = "error"
+)
+
+// Cursor is a client's cursor position and selection in the document
+type Cursor struct {
+	Position     int `json:"position"`
+	SelectionEnd int `json:"selection_end"`
+}
+
+// Presence describes a client that is connected to a session
+type Presence struct {
+	Client string  `json:"client"`
+	User   string  `json:"user"`
+	Cursor *Cursor `json:"cursor,omitempty"`
+}
+
+// Message is sent between the server and the clients of a session
+type Message struct {
+	Type     string     `json:"type"`
+	Session  string     `json:"session,omitempty"`
+	Revision int        `json:"revision"`
+	Seq      int        `json:"seq,omitempty"`
+	Op       Operation  `json:"op,omitempty"`
+	Contents *string    `json:"contents,omitempty"`
+	Client   string     `json:"client,omitempty"`
+	User     string     `json:"user,omitempty"`
+	Cursor   *Cursor    `json:"cursor,omitempty"`
+	Clients  []Presence `json:"clients,omitempty"`
+	Message  string     `json:"message,omitempty"`
+}
+
+// Client is a single connection to a session. Messages for the client are
+// queued on Send.
+type Client struct {
+	ID     string
+	User   string
+	Send   chan *Message
+	cursor *Cursor
+	closed bool
+}
+
+// NewClient returns a new client. If id is empty, a random one is generated.
+// Clients should reuse their id when they reconnect, so operations that are
+// sent twice are only applied once.
+func NewClient(id string, user string) (*Client, error) {
+
+	if id == "" {
+		var err error
+		id, err = randomID()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	c := Client{
+		ID:   id,
+		User: user,
+		Send: make(chan *Message, 256),
+	}
+
+	return &c, nil
+
+}
+
+// historyEntry is an operation that was applied to a session's document
+type historyEntry struct {
+	op     Operation
+	client string
+	seq    int
+}
+
+// Session is the shared state of one page being edited
+type Session struct {
+	ID   string
+	Slug string
+
+	manager *Manager
+	saveMu  sync.Mutex
+	version string
+
+	mu         sync.Mutex
+	doc        []uint16
+	base       int
+	history    []historyEntry
+	clients    map[*Client]struct{}
+	dirty      bool
+	lastEditor string
+}
+
+// Revision returns the current revision of the document
+func (s *Session) Revision() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.revision()
+}
+
+func (s *Session) revision() int {
+	return s.base + len(s.history)
+}
+
+// Leave removes a client from the session. The session is saved and closed
+// when its last client leaves.
+func (s *Session) Leave(c *Client) {
+
+	m := s.manager
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// The client may already be gone if it was dropped for falling behind
+	s.mu.Lock()
+	if _, ok := s.clients[c]; ok {
+		delete(s.clients, c)
+		s.broadcast(c, &Message{Type: TypeLeave, Revision: s.revision(), Client: c.ID, User: c.User})
+	}
+	s.closeClient(c)
+	empty := len(s.clients) == 0
+	s.mu.Unlock()
+
+	if !empty || m.sessions[s.Slug] != s {
+		return
+	}
+
+	// The manager lock is still held, so nobody can open a new session for
+	// this page and load it before the last changes are saved.
+	delete(m.sessions, s.Slug)
+	err := s.persist()
+	if err != nil {
+		log.Printf("collab: not saving %s: %s", s.Slug, err)
+	}
+
+}
+
+// Receive handles a message sent by a client
+func (s *Session) Receive(c *Client, msg *Message) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.clients[c]; !ok {
+		return
+	}
+
+	var err error
+	switch msg.Type {
+	case TypeOp:
+		err = s.applyOp(c, msg)
+	case TypeCursor:
+		err = s.moveCursor(c, msg)
+	default:
+		err = errors.New("unknown message type")
+	}
+
+	if err != nil {
+		s.send(c, &Message{Type: TypeError, Revision: s.revision(), Message: err.Error()})
+	}
+
+}
+
+// applyOp transforms a client's operation against everything that happened
+// since the revision it was made at, then applies it and broadcasts it
+func (s *Session) applyOp(c *Client, msg *Message) error {
+
+	if msg.Revision < s.base || msg.Revision > s.revision() {
+		return errors.New("revision is out of range, please resync")
+	}
+
+	// If the client already sent this operation (it reconnected before it
+	// saw the ack), just acknowledge it again.
+	for i := msg.Revision - s.base; i < len(s.history); i++ {
+		h := s.history[i]
+		if msg.Seq != 0 && h.client == c.ID && h.seq == msg.Seq {
+			s.send(c, &Message{Type: TypeAck, Revision: s.base + i + 1, Seq: msg.Seq})
+			return nil
+		}
+	}
+
+	op := msg.Op
+	for _, h := range s.history[msg.Revision-s.base:] {
+		var err error
+		op, _, err = Transform(op, h.op)
+		if err != nil {
+			return err
+		}
+	}
+
+	doc, err := op.Apply(s.doc)
+	if err != nil {
+		return err
+	}
+	s.doc = doc
+
+	s.history = append(s.history, historyEntry{op: op, client: c.ID, seq: msg.Seq})
+	if len(s.history) > maxHistory {
+		drop := len(s.history) - maxHistory
+		s.history = append([]historyEntry{}, s.history[drop:]...)
+		s.base += drop
+	}
+	s.dirty = true
+	s.lastEditor = c.User
+
+	// Everyone's cursor moves with the text
+	for other := range s.clients {
+		if other.cursor != nil {
+			other.cursor.Position = op.TransformIndex(other.cursor.Position)
+			other.cursor.SelectionEnd = op.TransformIndex(other.cursor.SelectionEnd)
+		}
+	}
+
+	rev := s.revision()
+	s.send(c, &Message{Type: TypeAck, Revision: rev, Seq: msg.Seq})
+	s.broadcast(c, &Message{Type: TypeOp, Revision: rev, Op: op, Client: c.ID, User: c.User})
+
+	return nil
+
+}
+
+// moveCursor updates a client's cursor and tells everyone else about it
+func (s *Session) moveCursor(c *Client, msg *Message) error {
+
+	if msg.Cursor == nil {
+		c.cursor = nil
+	} else {
+		if msg.Revision < s.base || msg.Revision > s.revision() {
+			return errors.New("revision is out of range, please resync")
+		}
+
+		cursor := *msg.Cursor
+		for _, h := range s.history[msg.Revision-s.base:] {
+			cursor.Position = h.op.TransformIndex(cursor.Position)
+			cursor.SelectionEnd = h.op.TransformIndex(cursor.SelectionEnd)
+		}
+		c.cursor = &cursor
+	}
+
+	s.broadcast(c, &Message{
+		Type:     TypeCursor,
+		Revision: s.revision(),
+		Client:   c.ID,
+		User:     c.User,
+		Cursor:   c.cursor,
+	})
+
+	return nil
+
+}
+
+// welcome brings a newly joined client up to date. A client that is resuming
+// a session at a revision that's still in the history is sent what it missed,
+// everyone else gets a snapshot of the document.
+func (s *Session) welcome(c *Client, session string, revision int) {
+
+	if session == s.ID && revision >= s.base && revision <= s.revision() {
+		for i, h := range s.history[revision-s.base:] {
+			rev := revision + i + 1
+			if h.client == c.ID {
+				s.send(c, &Message{Type: TypeAck, Revision: rev, Seq: h.seq})
+			} else {
+				s.send(c, &Message{Type: TypeOp, Revision: rev, Op: h.op, Client: h.client})
+			}
+		}
+		for other := range s.clients {
+			if other != c && other.cursor != nil {
+				s.send(c, &Message{
+					Type:     TypeCursor,
+					Revision: s.revision(),
+					Client:   other.ID,
+					User:     other.User,
+					Cursor:   other.cursor,
+				})
+			}
+		}
+		return
+	}
+
+	contents := decodeText(s.doc)
+	clients := []Presence{}
+	for other := range s.clients {
+		if other != c {
+			clients = append(clients, Presence{Client: other.ID, User: other.User, Cursor: other.cursor})
+		}
+	}
+
+	s.send(c, &Message{
+		Type:     TypeInit,
+		Session:  s.ID,
+		Revision: s.revision(),
+		Contents: &contents,
+		Client:   c.ID,
+		User:     c.User,
+		Clients:  clients,
+	})
+
+}
+
+// send queues a message for a client. Clients that can't keep up are
+// disconnected, they'll resync when they reconnect.
+func (s *Session) send(c *Client, msg *Message) {
+	if c.closed {
+		return
+	}
+	select {
+	case c.Send <- msg:
+	default:
+		delete(s.clients, c)
+		s.closeClient(c)
+	}
+}
+
+// broadcast queues a message for every client except the sender
+func (s *Session) broadcast(sender *Client, msg *Message) {
+	for c := range s.clients {
+		if c != sender {
+			s.send(c, msg)
+		}
+	}
+}
+
+func (s *Session) closeClient(c *Client) {
+	if !c.closed {
+		c.closed = true
+		close(c.Send)
+	}
+}
+
+// end disconnects every client, telling them why. Clients that reconnect
+// start a new session.
+func (s *Session) end(reason string) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for c := range s.clients {
+		s.send(c, &Message{Type: TypeError, Revision: s.revision(), Message: reason})
+		delete(s.clients, c)
+		s.closeClient(c)
+	}
+
+}
+
+// persist saves the document if it changed since the last time it was saved.
+// It isn't saved if the page was changed by something else in the meantime.
+func (s *Session) persist() error {
+
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+
+	s.mu.Lock()
+	if !s.dirty {
+		s.mu.Unlock()
+		return nil
+	}
+	contents := decodeText(s.doc)
+	actor := s.lastEditor
+	s.dirty = false
+	s.mu.Unlock()
+
+	version, err := s.manager.Save(s.Slug, contents, actor, s.version)
+	if err != nil {
+		if err != ErrConflict {
+			s.mu.Lock()
+			s.dirty = true
+			s.mu.Unlock()
+		}
+		return err
+	}
+	s.version = version
+
+	return nil
+
+}
+
+// Manager keeps track of the open editing sessions and saves them
+// periodically.
+//
+// Load returns the contents of a page and its version, which is anything
+// that changes whenever the page does. Save saves the contents of a page if
+// it's still at the version it was loaded or last saved at, and returns its
+// new version. It returns ErrConflict if it isn't, and never creates a page.
+type Manager struct {
+	Load             func(slug string) (contents string, version string, err error)
+	Save             func(slug string, contents string, actor string, version string) (string, error)
+	SnapshotInterval time.Duration
+
+	mu       sync.Mutex
+	sessions map[string]*Session
+	stop     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// NewManager returns a new Manager that loads and saves page contents with
+// the given functions
+func NewManager(load func(string) (string, string, error),
+	save func(string, string, string, string) (string, error)) *Manager {
+
+	return &Manager{
+		Load:             load,
+		Save:             save,
+		SnapshotInterval: 30 * time.Second,
+		sessions:         map[string]*Session{},
+	}
+
+}
+
+// Join adds a client to the session for a page, opening the session if
+// needed. If the client is resuming an earlier connection, session and
+// revision should be the last ones it saw.
+func (m *Manager) Join(slug string, c *Client, session string, revision int) (*Session, error) {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.sessions[slug]
+	if !ok {
+		contents, version, err := m.Load(slug)
+		if err != nil {
+			return nil, err
+		}
+
+		id, err := randomID()
+		if err != nil {
+			return nil, err
+		}
+
+		s = &Session{
+			ID:      id,
+			Slug:    slug,
+			manager: m,
+			version: version,
+			doc:     encodeText(contents),
+			clients: map[*Client]struct{}{},
+		}
+		m.sessions[slug] = s
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Replace an older connection of the same client
+	for other := range s.clients {
+		if other.ID == c.ID {
+			delete(s.clients, other)
+			s.closeClient(other)
+		}
+	}
+
+	s.clients[c] = struct{}{}
+	s.welcome(c, session, revision)
+	s.broadcast(c, &Message{Type: TypeJoin, Revision: s.revision(), Client: c.ID, User: c.User})
+
+	return s, nil
+
+}
+
+// Start periodically saves every open session in the background until Stop
+// is called
+func (m *Manager) Start() {
+
+	m.stop = make(chan struct{})
+	m.wg.Add(1)
+
+	go func() {
+		defer m.wg.Done()
+
+		ticker := time.NewTicker(m.SnapshotInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-m.stop:
+				return
+			case <-ticker.C:
+				m.persistAll()
+			}
+		}
+	}()
+
+}
+
+// Stop stops saving in the background and saves every open session one last
+// time
+func (m *Manager) Stop() {
+	if m.stop != nil {
+		close(m.stop)
+		m.wg.Wait()
+		m.stop = nil
+	}
+	m.persistAll()
+}
+
+func (m *Manager) persistAll() {
+
+	m.mu.Lock()
+	sessions := []*Session{}
+	for _, s := range m.sessions {
+		sessions = append(sessions, s)
+	}
+	m.mu.Unlock()
+
+	for _, s := range sessions {
+		err := s.persist()
+		if err == ErrConflict {
+			log.Printf("collab: not saving %s: %s", s.Slug, err)
+			m.end(s)
+		} else if err != nil {
+			log.Println("collab:", err)
+		}
+	}
+
+}
+
+// end closes a session whose page was changed by something else. Its edits
+// since it was last saved are dropped.
+func (m *Manager) end(s *Session) {
+
+	m.mu.Lock()
+	if m.sessions[s.Slug] == s {
+		delete(m.sessions, s.Slug)
+	}
+	m.mu.Unlock()
+
+	s.end("The page was changed outside of this editing session. Reload it " +
+		"to keep editing.")
+
+}
+
+func randomID() (string, error) {
+	b := make([]byte, 16)
+	_, err := io.ReadFull(rand.Reader, b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,174 @@
+package collab
+
+import (
+	"strconv"
+	"testing"
+)
+
+// testPages is a page store for a Manager that bumps a page's version
+// whenever it's saved
+type testPages struct {
+	contents map[string]string
+	versions map[string]int
+	saves    int
+}
+
+func newTestPages() *testPages {
+	return &testPages{
+		contents: map[string]string{},
+		versions: map[string]int{},
+	}
+}
+
+func (p *testPages) load(slug string) (string, string, error) {
+	contents, ok := p.contents[slug]
+	if !ok {
+		return "", "", ErrNotFound
+	}
+	return contents, strconv.Itoa(p.versions[slug]), nil
+}
+
+func (p *testPages) save(slug string, contents string, actor string, version string) (string, error) {
+	if _, ok := p.contents[slug]; !ok || strconv.Itoa(p.versions[slug]) != version {
+		return "", ErrConflict
+	}
+	p.contents[slug] = contents
+	p.versions[slug]++
+	p.saves++
+	return strconv.Itoa(p.versions[slug]), nil
+}
+
+// edit joins a client to the page's session and inserts text at the start
+func edit(t *testing.T, m *Manager, slug string, text string) (*Session, *Client) {
+
+	c, err := NewClient("", "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := m.Join(slug, c, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.Receive(c, &Message{
+		Type:     TypeOp,
+		Revision: s.Revision(),
+		Seq:      1,
+		Op:       Operation{}.Insert(text).Retain(len(encodeText(s.contents()))),
+	})
+
+	return s, c
+
+}
+
+func (s *Session) contents() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return decodeText(s.doc)
+}
+
+func TestJoinMissingPage(t *testing.T) {
+
+	pages := newTestPages()
+	m := NewManager(pages.load, pages.save)
+
+	c, err := NewClient("", "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = m.Join("missing", c, "", 0)
+	if err != ErrNotFound {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	if _, ok := pages.contents["missing"]; ok {
+		t.Error("the page was created")
+	}
+
+}
+
+func TestPersist(t *testing.T) {
+
+	pages := newTestPages()
+	pages.contents["page"] = "world"
+	m := NewManager(pages.load, pages.save)
+
+	s, c := edit(t, m, "page", "hello ")
+	m.persistAll()
+	if pages.contents["page"] != "hello world" {
+		t.Errorf("expected %q to be saved, got %q", "hello world", pages.contents["page"])
+	}
+
+	// The session keeps saving on top of its own saves
+	s.Receive(c, &Message{
+		Type:     TypeOp,
+		Revision: s.Revision(),
+		Seq:      2,
+		Op:       Operation{}.Retain(11).Insert("!"),
+	})
+	m.persistAll()
+	if pages.contents["page"] != "hello world!" {
+		t.Errorf("expected %q to be saved, got %q", "hello world!", pages.contents["page"])
+	}
+
+	s.Leave(c)
+	if pages.saves != 2 {
+		t.Errorf("expected 2 saves, got %d", pages.saves)
+	}
+
+}
+
+func TestPersistConflict(t *testing.T) {
+
+	cases := map[string]func(p *testPages){
+		"changed": func(p *testPages) {
+			p.contents["page"] = "changed elsewhere"
+			p.versions["page"]++
+		},
+		"deleted": func(p *testPages) {
+			delete(p.contents, "page")
+			delete(p.versions, "page")
+		},
+	}
+
+	for name, change := range cases {
+		t.Run(name, func(t *testing.T) {
+
+			pages := newTestPages()
+			pages.contents["page"] = "world"
+			m := NewManager(pages.load, pages.save)
+
+			s, c := edit(t, m, "page", "hello ")
+			change(pages)
+			m.persistAll()
+
+			if pages.saves != 0 {
+				t.Errorf("expected no saves, got %d", pages.saves)
+			}
+			if _, ok := pages.contents["page"]; ok != (name != "deleted") {
+				t.Error("the page was recreated")
+			}
+
+			// The client is told why and disconnected
+			var last *Message
+			for msg := range c.Send {
+				last = msg
+			}
+			if last == nil || last.Type != TypeError {
+				t.Errorf("expected an error message, got %+v", last)
+			}
+
+			if _, ok := m.sessions["page"]; ok {
+				t.Error("the session is still open")
+			}
+
+			s.Leave(c)
+			if pages.saves != 0 {
+				t.Errorf("expected no saves, got %d", pages.saves)
+			}
+
+		})
+	}
+
+}
@@ -0,0 +1,245 @@
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a cron schedule: "minute hour day-of-month month day-of-week".
+// Each field is *, a number, a range (1-5), a list (1,3,5) or any of those
+// with a step (*/15, 0-30/10). Days of the week are 0-7, where both 0 and 7
+// are Sunday. As with cron, when both days of the month and days of the week
+// are given, a time matches if either does.
+type Schedule struct {
+	spec string
+
+	minute, hour, dom, month, dow uint64
+
+	// Whether the day fields start with "*"
+	anyDOM, anyDOW bool
+}
+
+// Shorthands for common schedules
+var shorthands = map[string]string{
+	"@hourly":   "0 * * * *",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@weekly":   "0 0 * * 0",
+	"@monthly":  "0 0 1 * *",
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+}
+
+// field is the range of values of a field
+type field struct {
+	name     string
+	min, max int
+}
+
+var fields = []field{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+// Parse parses a cron schedule
+func Parse(spec string) (*Schedule, error) {
+
+	expanded := strings.TrimSpace(spec)
+	if s, ok := shorthands[expanded]; ok {
+		expanded = s
+	}
+
+	parts := strings.Fields(expanded)
+	if len(parts) != len(fields) {
+		return nil, fmt.Errorf("cron schedule %q should have %d fields", spec, len(fields))
+	}
+
+	bits := make([]uint64, len(fields))
+	for i, f := range fields {
+		b, err := parseField(parts[i], f)
+		if err != nil {
+			return nil, fmt.Errorf("cron schedule %q: %s", spec, err)
+		}
+		bits[i] = b
+	}
+
+	// Sunday can be 0 or 7
+	if bits[4]&(1<<7) != 0 {
+		bits[4] |= 1
+	}
+
+	return &Schedule{
+		spec:   spec,
+		minute: bits[0],
+		hour:   bits[1],
+		dom:    bits[2],
+		month:  bits[3],
+		dow:    bits[4],
+		anyDOM: strings.HasPrefix(parts[2], "*"),
+		anyDOW: strings.HasPrefix(parts[4], "*"),
+	}, nil
+
+}
+
+// parseField returns the values a field matches, as bits
+func parseField(s string, f field) (uint64, error) {
+
+	var bits uint64
+	for _, item := range strings.Split(s, ",") {
+		rng, step := item, 1
+		if i := strings.Index(item, "/"); i >= 0 {
+			n, err := strconv.Atoi(item[i+1:])
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("bad step in %s %q", f.name, item)
+			}
+			rng, step = item[:i], n
+		}
+
+		lo, hi := f.min, f.max
+		if rng != "*" {
+			var err error
+			bounds := strings.SplitN(rng, "-", 2)
+			lo, err = strconv.Atoi(bounds[0])
+			if err != nil {
+				return 0, fmt.Errorf("bad %s %q", f.name, item)
+			}
+			hi = lo
+			if len(bounds) == 2 {
+				hi, err = strconv.Atoi(bounds[1])
+				if err != nil {
+					return 0, fmt.Errorf("bad %s %q", f.name, item)
+				}
+			} else if step > 1 {
+				// 5/15 means from 5 to the end, every 15
+				hi = f.max
+			}
+		}
+		if lo < f.min || hi > f.max || lo > hi {
+			return 0, fmt.Errorf("%s %q is out of range %d-%d", f.name, item, f.min, f.max)
+		}
+
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+
+	return bits, nil
+
+}
+
+// String returns the schedule as it was given
+func (s *Schedule) String() string {
+	return s.spec
+}
+
+// Next returns the first time after t that matches the schedule, in t's
+// location. It returns the zero time if nothing matches within five years,
+// like "0 0 31 2 *".
+//
+// The schedule is matched against the wall clock. A time that's skipped when
+// the clocks go forward for daylight saving time runs at the first instant
+// after the change instead, and a time that's repeated when they go back
+// runs once.
+func (s *Schedule) Next(t time.Time) time.Time {
+
+	w := wallClock(t).Add(time.Minute)
+	limit := w.AddDate(5, 0, 0)
+
+	for {
+		w = s.nextWall(w, limit)
+		if w.IsZero() {
+			return w
+		}
+
+		next, ok := atWallClock(w, t)
+		if ok {
+			return next
+		}
+		w = w.Add(time.Minute)
+	}
+
+}
+
+// nextWall returns the first wall clock time from w (kept in UTC, where
+// there's no daylight saving time) up to limit that matches the schedule, or
+// the zero time if there isn't one
+func (s *Schedule) nextWall(w time.Time, limit time.Time) time.Time {
+
+	for w.Before(limit) {
+		switch {
+		case !has(s.month, int(w.Month())):
+			w = time.Date(w.Year(), w.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+		case !s.dayMatches(w):
+			w = time.Date(w.Year(), w.Month(), w.Day()+1, 0, 0, 0, 0, time.UTC)
+		case !has(s.hour, w.Hour()):
+			w = time.Date(w.Year(), w.Month(), w.Day(), w.Hour()+1, 0, 0, 0, time.UTC)
+		case !has(s.minute, w.Minute()):
+			w = w.Add(time.Minute)
+		default:
+			return w
+		}
+	}
+
+	return time.Time{}
+
+}
+
+// wallClock returns the wall clock time of t, to the minute, in UTC
+func wallClock(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, time.UTC)
+}
+
+// atWallClock returns the first instant after <after>, in its location, that
+// the wall clock shows w. If the clocks skip w, it's the first instant after
+// they do. It returns false if there's no such instant, when w was repeated
+// and <after> is past both times.
+func atWallClock(w time.Time, after time.Time) (time.Time, bool) {
+
+	t := time.Date(w.Year(), w.Month(), w.Day(), w.Hour(), w.Minute(), 0, 0, after.Location())
+
+	// When w is skipped, time.Date gives a time on either side of the gap,
+	// depending on the offset it uses. Move it to the end of the gap.
+	for wallClock(t).Before(w) {
+		t = t.Add(time.Minute)
+	}
+	for wallClock(t).After(w) && !wallClock(t.Add(-time.Minute)).Before(w) {
+		t = t.Add(-time.Minute)
+	}
+
+	// When w is repeated, time.Date gives one of the times. If <after> is
+	// between them, the later one is the one that's wanted.
+	if !t.After(after) {
+		_, offset := t.Zone()
+		_, afterOffset := after.Zone()
+		t = t.Add(time.Duration(offset-afterOffset) * time.Second)
+		if !t.After(after) || !wallClock(t).Equal(w) {
+			return time.Time{}, false
+		}
+	}
+
+	return t, true
+
+}
+
+// dayMatches returns true if the day of t matches the schedule
+func (s *Schedule) dayMatches(t time.Time) bool {
+
+	dom := has(s.dom, t.Day())
+	dow := has(s.dow, int(t.Weekday()))
+
+	if s.anyDOM || s.anyDOW {
+		return dom && dow
+	}
+	return dom || dow
+
+}
+
+// has returns true if the bit for v is set
+func has(bits uint64, v int) bool {
+	return bits&(1<<uint(v)) != 0
+}
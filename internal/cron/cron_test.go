@@ -0,0 +1,155 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+
+	cases := []struct {
+		spec string
+		ok   bool
+	}{
+		{"* * * * *", true},
+		{"0 3 * * *", true},
+		{"*/15 0-6,22-23 1,15 */2 1-5", true},
+		{"5/15 * * * *", true},
+		{"0 0 * * 7", true},
+		{"@daily", true},
+		{" @weekly ", true},
+		{"", false},
+		{"* * * *", false},
+		{"* * * * * *", false},
+		{"60 * * * *", false},
+		{"* 24 * * *", false},
+		{"* * 0 * *", false},
+		{"* * * 13 *", false},
+		{"* * * * 8", false},
+		{"5-1 * * * *", false},
+		{"*/0 * * * *", false},
+		{"a * * * *", false},
+		{"1-a * * * *", false},
+		{"@sometimes", false},
+	}
+
+	for _, c := range cases {
+		s, err := Parse(c.spec)
+		if c.ok && err != nil {
+			t.Errorf("Parse(%q): %s", c.spec, err)
+		}
+		if !c.ok && err == nil {
+			t.Errorf("Parse(%q) should have failed", c.spec)
+		}
+		if err == nil && s.String() != c.spec {
+			t.Errorf("Parse(%q).String() = %q", c.spec, s.String())
+		}
+	}
+
+}
+
+func TestNext(t *testing.T) {
+
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("no time zone database:", err)
+	}
+
+	at := func(loc *time.Location, s string) time.Time {
+		tm, err := time.ParseInLocation("2006-01-02 15:04:05", s, loc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tm
+	}
+
+	cases := []struct {
+		spec string
+		from time.Time
+		want time.Time
+	}{
+		{"* * * * *", at(time.UTC, "2020-01-01 10:00:30"), at(time.UTC, "2020-01-01 10:01:00")},
+		{"0 3 * * *", at(time.UTC, "2020-01-01 03:00:00"), at(time.UTC, "2020-01-02 03:00:00")},
+		{"*/15 * * * *", at(time.UTC, "2020-01-01 10:07:00"), at(time.UTC, "2020-01-01 10:15:00")},
+		{"0 0 1 * *", at(time.UTC, "2020-01-31 12:00:00"), at(time.UTC, "2020-02-01 00:00:00")},
+		{"0 0 29 2 *", at(time.UTC, "2020-03-01 00:00:00"), at(time.UTC, "2024-02-29 00:00:00")},
+		{"0 0 31 2 *", at(time.UTC, "2020-01-01 00:00:00"), time.Time{}},
+		{"0 0 * * 0", at(time.UTC, "2020-01-01 00:00:00"), at(time.UTC, "2020-01-05 00:00:00")},
+		{"0 0 * * 7", at(time.UTC, "2020-01-01 00:00:00"), at(time.UTC, "2020-01-05 00:00:00")},
+		{"0 0 31 12 *", at(time.UTC, "2020-06-01 00:00:00"), at(time.UTC, "2020-12-31 00:00:00")},
+
+		// Either the day of the month or the day of the week
+		{"0 0 13 * 5", at(time.UTC, "2020-01-01 00:00:00"), at(time.UTC, "2020-01-03 00:00:00")},
+		{"0 0 13 * 5", at(time.UTC, "2020-01-03 00:00:00"), at(time.UTC, "2020-01-10 00:00:00")},
+		{"0 0 13 * 5", at(time.UTC, "2020-01-10 00:00:00"), at(time.UTC, "2020-01-13 00:00:00")},
+
+		// The clocks go forward from 02:00 to 03:00 on 2020-03-08. Times in
+		// between run at 03:00, and the day isn't skipped.
+		{"30 2 * * *", at(ny, "2020-03-07 02:30:00"), at(ny, "2020-03-08 03:00:00")},
+		{"30 2 * * *", at(ny, "2020-03-08 03:00:00"), at(ny, "2020-03-09 02:30:00")},
+		{"0 3 * * *", at(ny, "2020-03-07 03:00:00"), at(ny, "2020-03-08 03:00:00")},
+		{"0 * * * *", at(ny, "2020-03-08 01:00:00"), at(ny, "2020-03-08 03:00:00")},
+		{"15 * * * *", at(ny, "2020-03-08 01:15:00"), at(ny, "2020-03-08 03:00:00")},
+		{"15 * * * *", at(ny, "2020-03-08 03:00:00"), at(ny, "2020-03-08 03:15:00")},
+
+		// The clocks go back from 02:00 to 01:00 on 2020-11-01. Times in the
+		// repeated hour only run the first time.
+		{"30 1 * * *", at(ny, "2020-10-31 01:30:00"), time.Date(2020, 11, 1, 5, 30, 0, 0, time.UTC)},
+		{"30 1 * * *", time.Date(2020, 11, 1, 5, 30, 0, 0, time.UTC).In(ny), at(ny, "2020-11-02 01:30:00")},
+		{"0 2 * * *", at(ny, "2020-10-31 02:00:00"), at(ny, "2020-11-01 02:00:00")},
+		{"0 0 * * *", at(ny, "2020-10-31 12:00:00"), at(ny, "2020-11-01 00:00:00")},
+		{"0 0 * * *", at(ny, "2020-11-01 00:00:00"), at(ny, "2020-11-02 00:00:00")},
+		{"30 * * * *", time.Date(2020, 11, 1, 5, 30, 0, 0, time.UTC).In(ny), at(ny, "2020-11-01 02:30:00")},
+
+		// Starting during the repeated hour runs the rest of it
+		{"45 1 * * *", time.Date(2020, 11, 1, 6, 10, 0, 0, time.UTC).In(ny), time.Date(2020, 11, 1, 6, 45, 0, 0, time.UTC)},
+	}
+
+	for _, c := range cases {
+		s, err := Parse(c.spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := s.Next(c.from)
+		if !got.Equal(c.want) {
+			t.Errorf("Next(%q, %s) = %s, expected %s", c.spec, c.from, got, c.want)
+		}
+	}
+
+}
+
+func TestNextRunsDailyThroughDST(t *testing.T) {
+
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("no time zone database:", err)
+	}
+
+	// Every schedule runs exactly once a day over both changes
+	for _, spec := range []string{"0 0 * * *", "30 1 * * *", "30 2 * * *", "0 3 * * *"} {
+		s, err := Parse(spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		days := map[string]int{}
+		next := time.Date(2019, 12, 31, 12, 0, 0, 0, ny)
+		for {
+			next = s.Next(next)
+			if next.Year() > 2020 {
+				break
+			}
+			days[next.Format("2006-01-02")]++
+		}
+
+		if len(days) != 366 {
+			t.Errorf("%q ran on %d days in 2020", spec, len(days))
+		}
+		for day, n := range days {
+			if n != 1 {
+				t.Errorf("%q ran %d times on %s", spec, n, day)
+			}
+		}
+	}
+
+}
@@ -1,15 +1,26 @@
 package datastore
 
 import (
+	"encoding/binary"
 	"fmt"
 	"time"
 
+	"github.com/idrum4316/devpad-server/internal/storage"
 	bolt "go.etcd.io/bbolt"
 )
 
 const (
-	pagesBucket = "Pages"
-	usersBucket = "Users"
+	pagesBucket      = "Pages"
+	usersBucket      = "Users"
+	feedTokensBucket = "FeedTokens"
+	webhooksBucket   = "Webhooks"
+	deliveriesBucket = "WebhookDeliveries"
+	queueBucket      = "WebhookQueue"
+	eventsBucket     = "Events"
+	outboxBucket     = "IndexOutbox"
+
+	savedSearchesBucket = "SavedSearches"
+	notificationsBucket = "Notifications"
 )
 
 // Datastore is where user accounts and page metadata is stored
@@ -17,6 +28,13 @@ type Datastore struct {
 	db *bolt.DB
 }
 
+// Make sure Datastore implements everything it should
+var (
+	_ storage.Store       = (*Datastore)(nil)
+	_ storage.PageBatcher = (*Datastore)(nil)
+	_ storage.Outbox      = (*Datastore)(nil)
+)
+
 // New returns a new, already opened Datastore instance at <path>
 func New(path string) (*Datastore, error) {
 
@@ -28,7 +46,11 @@ func New(path string) (*Datastore, error) {
 	store := Datastore{
 		db: db,
 	}
-	store.initialize()
+	err = store.initialize()
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
 
 	return &store, nil
 
@@ -37,14 +59,25 @@ func New(path string) (*Datastore, error) {
 // Initialize the buckets that are needed for future transactions
 func (d *Datastore) initialize() (err error) {
 
+	buckets := []string{
+		usersBucket,
+		feedTokensBucket,
+		pagesBucket,
+		webhooksBucket,
+		deliveriesBucket,
+		queueBucket,
+		eventsBucket,
+		outboxBucket,
+		savedSearchesBucket,
+		notificationsBucket,
+	}
+
 	err = d.db.Update(func(tx *bolt.Tx) error {
-		_, err := tx.CreateBucketIfNotExists([]byte(usersBucket))
-		if err != nil {
-			return fmt.Errorf("create bucket: %s", err)
-		}
-		_, err = tx.CreateBucketIfNotExists([]byte(pagesBucket))
-		if err != nil {
-			return fmt.Errorf("create bucket: %s", err)
+		for _, name := range buckets {
+			_, err := tx.CreateBucketIfNotExists([]byte(name))
+			if err != nil {
+				return fmt.Errorf("create bucket: %s", err)
+			}
 		}
 		return nil
 	})
@@ -57,3 +90,23 @@ func (d *Datastore) initialize() (err error) {
 func (d *Datastore) Close() {
 	d.db.Close()
 }
+
+// itob encodes a sequence number as a sortable bolt key
+func itob(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return b
+}
+
+// SnapshotTo writes a consistent copy of the database to a new file at path.
+// It's copied in a read transaction, so the store can keep being used.
+func (d *Datastore) SnapshotTo(path string) error {
+	return d.db.View(func(tx *bolt.Tx) error {
+		return tx.CopyFile(path, 0600)
+	})
+}
+
+// btoi decodes a bolt key made by itob
+func btoi(b []byte) uint64 {
+	return binary.BigEndian.Uint64(b)
+}
@@ -0,0 +1,30 @@
+package datastore
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/idrum4316/devpad-server/internal/storage"
+	"github.com/idrum4316/devpad-server/internal/storage/storagetest"
+)
+
+func newTestStore(t *testing.T) *Datastore {
+	d, err := New(filepath.Join(t.TempDir(), "devpad.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(d.Close)
+	return d
+}
+
+func TestConformance(t *testing.T) {
+	storagetest.TestPageStore(t, func(t *testing.T) storage.PageStore {
+		return newTestStore(t)
+	})
+	storagetest.TestUserStore(t, func(t *testing.T) storage.UserStore {
+		return newTestStore(t)
+	})
+	storagetest.TestMetaStore(t, func(t *testing.T) storage.MetaStore {
+		return newTestStore(t)
+	})
+}
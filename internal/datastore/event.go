@@ -0,0 +1,137 @@
+package datastore
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/idrum4316/devpad-server/internal/event"
+	bolt "go.etcd.io/bbolt"
+)
+
+// AppendEvent saves an event at the end of the event log. It assigns the
+// event the next ID in the log.
+func (d *Datastore) AppendEvent(e *event.Event) error {
+
+	err := d.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(eventsBucket))
+
+		id, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		e.ID = id
+
+		eventBytes, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+
+		return b.Put(itob(id), eventBytes)
+	})
+
+	return err
+
+}
+
+// EventsSince returns up to <limit> events with an ID greater than <id>, in
+// the order they happened.
+func (d *Datastore) EventsSince(id uint64, limit int) ([]*event.Event, error) {
+
+	events := []*event.Event{}
+
+	err := d.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket([]byte(eventsBucket)).Cursor()
+
+		for k, v := c.Seek(itob(id + 1)); k != nil && len(events) < limit; k, v = c.Next() {
+			e := event.Event{}
+			err := json.Unmarshal(v, &e)
+			if err != nil {
+				return err
+			}
+			events = append(events, &e)
+		}
+
+		return nil
+	})
+
+	return events, err
+
+}
+
+// EventsBefore returns up to <limit> events with an ID less than <id> that
+// match the filter, newest first. An <id> of 0 starts at the newest event.
+// The filter can end the scan early by returning stop, for example once the
+// events are older than it cares about.
+func (d *Datastore) EventsBefore(id uint64, limit int,
+	match func(e *event.Event) (include bool, stop bool)) ([]*event.Event, error) {
+
+	events := []*event.Event{}
+
+	err := d.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket([]byte(eventsBucket)).Cursor()
+
+		var k, v []byte
+		if id == 0 {
+			k, v = c.Last()
+		} else {
+			// Seek lands on <id> itself (or the one after it if it's
+			// missing), so step back once.
+			k, v = c.Seek(itob(id))
+			if k == nil {
+				k, v = c.Last()
+			} else {
+				k, v = c.Prev()
+			}
+		}
+
+		for ; k != nil && len(events) < limit; k, v = c.Prev() {
+			e := event.Event{}
+			err := json.Unmarshal(v, &e)
+			if err != nil {
+				return err
+			}
+			include, stop := match(&e)
+			if stop {
+				break
+			}
+			if include {
+				events = append(events, &e)
+			}
+		}
+
+		return nil
+	})
+
+	return events, err
+
+}
+
+// TrimEvents deletes the events that happened before <before>. The log is in
+// time order, so it stops at the first event that's newer.
+func (d *Datastore) TrimEvents(before time.Time) error {
+
+	err := d.db.Update(func(tx *bolt.Tx) error {
+		c := tx.Bucket([]byte(eventsBucket)).Cursor()
+
+		for k, v := c.First(); k != nil; k, v = c.First() {
+			e := event.Event{}
+			err := json.Unmarshal(v, &e)
+			if err != nil {
+				return err
+			}
+			if !e.Timestamp.Before(before) {
+				return nil
+			}
+
+			err = c.Delete()
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	return err
+
+}
@@ -0,0 +1,77 @@
+package datastore
+
+import (
+	"github.com/idrum4316/devpad-server/internal/storage"
+	bolt "go.etcd.io/bbolt"
+)
+
+// enqueueIndexJobs queues the pages to be indexed again, as part of the
+// transaction that changed them
+func enqueueIndexJobs(tx *bolt.Tx, ids ...string) error {
+
+	b := tx.Bucket([]byte(outboxBucket))
+	for _, id := range ids {
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		err = b.Put(itob(seq), []byte(id))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+
+}
+
+// PendingIndexJobs returns up to <limit> of the oldest queued index jobs
+func (d *Datastore) PendingIndexJobs(limit int) ([]*storage.Job, error) {
+
+	jobs := []*storage.Job{}
+
+	err := d.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket([]byte(outboxBucket)).Cursor()
+		for k, v := c.First(); k != nil && len(jobs) < limit; k, v = c.Next() {
+			jobs = append(jobs, &storage.Job{
+				Seq:    btoi(k),
+				PageID: string(v),
+			})
+		}
+		return nil
+	})
+
+	return jobs, err
+
+}
+
+// CompleteIndexJobs removes index jobs from the queue once they're applied
+func (d *Datastore) CompleteIndexJobs(jobs []*storage.Job) error {
+
+	err := d.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(outboxBucket))
+		for _, job := range jobs {
+			err := b.Delete(itob(job.Seq))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	return err
+
+}
+
+// CountIndexJobs returns how many index jobs are queued
+func (d *Datastore) CountIndexJobs() (int, error) {
+
+	count := 0
+	err := d.db.View(func(tx *bolt.Tx) error {
+		count = tx.Bucket([]byte(outboxBucket)).Stats().KeyN
+		return nil
+	})
+
+	return count, err
+
+}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/idrum4316/devpad-server/internal/page"
+	"github.com/idrum4316/devpad-server/internal/storage"
 	bolt "go.etcd.io/bbolt"
 )
 
@@ -22,41 +23,175 @@ func (d *Datastore) UpdatePage(p *page.Page, pageID string) error {
 	err = d.db.Update(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(pagesBucket))
 		err := b.Put([]byte(pageID), pageBytes)
-		return err
+		if err != nil {
+			return err
+		}
+		return enqueueIndexJobs(tx, pageID)
 	})
 
 	return err
 }
 
-// RenamePage will delete the old page and insert the new one
-func (d *Datastore) RenamePage(oldID string, newID string) error {
+// UpdatePageIf updates a page in the datastore if check accepts the page
+// that's there, in the same transaction
+func (d *Datastore) UpdatePageIf(p *page.Page, pageID string,
+	check func(current *page.Page) error) (*page.Page, error) {
 
-	// It's all done in one transaction so that any error will roll the
-	// transaction back.
+	var pageBytes []byte
 	err := d.db.Update(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(pagesBucket))
 
-		// Make sure the new ID is available
-		v := b.Get([]byte(newID))
-		if v != nil {
-			return fmt.Errorf("page %s already exists", newID)
+		var current *page.Page
+		if v := b.Get([]byte(pageID)); v != nil {
+			current = &page.Page{}
+			err := json.Unmarshal(v, current)
+			if err != nil {
+				return err
+			}
+		}
+		err := check(current)
+		if err != nil {
+			return err
 		}
 
-		// Get the old page
-		oldPage := b.Get([]byte(oldID))
-		if oldPage == nil {
-			return fmt.Errorf("could not find page %s", oldID)
+		p.Metadata.Modified = time.Now()
+		pageBytes, err = json.Marshal(p)
+		if err != nil {
+			return err
 		}
 
-		// Insert the page into the new location
-		err := b.Put([]byte(newID), oldPage)
+		err = b.Put([]byte(pageID), pageBytes)
 		if err != nil {
 			return err
 		}
+		return enqueueIndexJobs(tx, pageID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	saved := page.Page{}
+	err = json.Unmarshal(pageBytes, &saved)
+	if err != nil {
+		return nil, err
+	}
+
+	return &saved, nil
+
+}
+
+// PutPages writes pages as they are, keeping their modification times. It's
+// all done in one transaction, so either every page is written or none are.
+func (d *Datastore) PutPages(pages map[string]*page.Page) error {
+
+	err := d.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(pagesBucket))
+		for id, p := range pages {
+			pageBytes, err := json.Marshal(p)
+			if err != nil {
+				return err
+			}
+			err = b.Put([]byte(id), pageBytes)
+			if err != nil {
+				return err
+			}
+			err = enqueueIndexJobs(tx, id)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	return err
+
+}
+
+// RenamePage will delete the old page and insert the new one
+func (d *Datastore) RenamePage(oldID string, newID string) error {
+
+	// It's all done in one transaction so that any error will roll the
+	// transaction back.
+	err := d.db.Update(func(tx *bolt.Tx) error {
+		return renamePage(tx, oldID, newID)
+	})
+
+	return err
+
+}
+
+// renamePage moves a page to a new ID within a transaction
+func renamePage(tx *bolt.Tx, oldID string, newID string) error {
+
+	b := tx.Bucket([]byte(pagesBucket))
+
+	// Make sure the new ID is available
+	v := b.Get([]byte(newID))
+	if v != nil {
+		return fmt.Errorf("page %s already exists", newID)
+	}
+
+	// Get the old page
+	oldPage := b.Get([]byte(oldID))
+	if oldPage == nil {
+		return fmt.Errorf("could not find page %s", oldID)
+	}
+
+	// Insert the page into the new location
+	err := b.Put([]byte(newID), oldPage)
+	if err != nil {
+		return err
+	}
 
-		// Remove the old page location
-		err = b.Delete([]byte(oldID))
+	// Remove the old page location
+	err = b.Delete([]byte(oldID))
+	if err != nil {
 		return err
+	}
+
+	return enqueueIndexJobs(tx, oldID, newID)
+
+}
+
+// ApplyPageOps makes a batch of page changes in one transaction
+func (d *Datastore) ApplyPageOps(ops []*storage.PageOp) error {
+
+	err := d.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(pagesBucket))
+
+		for _, op := range ops {
+			switch op.Type {
+			case storage.OpPut:
+				pageBytes, err := json.Marshal(op.Page)
+				if err != nil {
+					return err
+				}
+				err = b.Put([]byte(op.ID), pageBytes)
+				if err != nil {
+					return err
+				}
+			case storage.OpDelete:
+				err := b.Delete([]byte(op.ID))
+				if err != nil {
+					return err
+				}
+			case storage.OpRename:
+				err := renamePage(tx, op.ID, op.NewID)
+				if err != nil {
+					return err
+				}
+				continue
+			default:
+				return fmt.Errorf("unknown page operation %q", op.Type)
+			}
+
+			err := enqueueIndexJobs(tx, op.ID)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
 	})
 
 	return err
@@ -69,7 +204,10 @@ func (d *Datastore) DeletePage(id string) error {
 	err := d.db.Update(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(pagesBucket))
 		err := b.Delete([]byte(id))
-		return err
+		if err != nil {
+			return err
+		}
+		return enqueueIndexJobs(tx, id)
 	})
 	return err
 
@@ -108,3 +246,24 @@ func (d *Datastore) GetPage(id string) (*page.Page, error) {
 	return &p, nil
 
 }
+
+// ForEachPage calls fn for every page in the datastore. If fn returns an
+// error, iteration stops and the error is returned. fn runs inside a read
+// transaction, so it must not write to the datastore.
+func (d *Datastore) ForEachPage(fn func(id string, p *page.Page) error) error {
+
+	err := d.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(pagesBucket))
+		return b.ForEach(func(k, v []byte) error {
+			p := page.Page{}
+			err := json.Unmarshal(v, &p)
+			if err != nil {
+				return err
+			}
+			return fn(string(k), &p)
+		})
+	})
+
+	return err
+
+}
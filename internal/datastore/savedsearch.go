@@ -0,0 +1,254 @@
+package datastore
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/idrum4316/devpad-server/internal/savedsearch"
+	bolt "go.etcd.io/bbolt"
+)
+
+// ListSavedSearches returns the saved searches of a user, or everyone's if
+// owner is ""
+func (d *Datastore) ListSavedSearches(owner string) ([]*savedsearch.SavedSearch, error) {
+
+	searches := []*savedsearch.SavedSearch{}
+
+	err := d.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(savedSearchesBucket))
+		return b.ForEach(func(k, v []byte) error {
+			s := savedsearch.SavedSearch{}
+			err := json.Unmarshal(v, &s)
+			if err != nil {
+				return err
+			}
+			if owner == "" || s.Owner == owner {
+				searches = append(searches, &s)
+			}
+			return nil
+		})
+	})
+
+	return searches, err
+
+}
+
+// GetSavedSearch returns a saved search, or nil if it doesn't exist
+func (d *Datastore) GetSavedSearch(id string) (*savedsearch.SavedSearch, error) {
+
+	var searchBytes []byte
+
+	err := d.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket([]byte(savedSearchesBucket)).Get([]byte(id))
+		if v != nil {
+			searchBytes = append([]byte{}, v...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if searchBytes == nil {
+		return nil, nil
+	}
+
+	s := savedsearch.SavedSearch{}
+	err = json.Unmarshal(searchBytes, &s)
+	if err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+
+}
+
+// PutSavedSearch creates or replaces a saved search
+func (d *Datastore) PutSavedSearch(s *savedsearch.SavedSearch) error {
+
+	searchBytes, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	err = d.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(savedSearchesBucket))
+		return b.Put([]byte(s.ID), searchBytes)
+	})
+
+	return err
+
+}
+
+// UpdateSavedSearch changes a saved search with update, in one transaction,
+// and returns it as it was saved. Nothing is saved, and nil is returned, if
+// the search doesn't exist.
+func (d *Datastore) UpdateSavedSearch(id string,
+	update func(s *savedsearch.SavedSearch)) (*savedsearch.SavedSearch, error) {
+
+	var updated *savedsearch.SavedSearch
+
+	err := d.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(savedSearchesBucket))
+		v := b.Get([]byte(id))
+		if v == nil {
+			return nil
+		}
+
+		s := savedsearch.SavedSearch{}
+		err := json.Unmarshal(v, &s)
+		if err != nil {
+			return err
+		}
+		update(&s)
+		s.ID = id
+
+		searchBytes, err := json.Marshal(&s)
+		if err != nil {
+			return err
+		}
+		err = b.Put([]byte(id), searchBytes)
+		if err != nil {
+			return err
+		}
+
+		updated = &s
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return updated, nil
+
+}
+
+// DeleteSavedSearch deletes a saved search. The notifications already sent
+// for it are kept.
+func (d *Datastore) DeleteSavedSearch(id string) error {
+
+	err := d.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(savedSearchesBucket))
+		return b.Delete([]byte(id))
+	})
+	return err
+
+}
+
+// RecordMatches sets when a saved search was last checked and saves the
+// notifications for what matched, assigning each of them an ID
+func (d *Datastore) RecordMatches(searchID string, checked time.Time,
+	notes []*savedsearch.Notification) error {
+
+	err := d.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(savedSearchesBucket))
+		v := b.Get([]byte(searchID))
+		if v == nil {
+			return nil
+		}
+
+		s := savedsearch.SavedSearch{}
+		err := json.Unmarshal(v, &s)
+		if err != nil {
+			return err
+		}
+		s.Checked = checked
+
+		searchBytes, err := json.Marshal(&s)
+		if err != nil {
+			return err
+		}
+		err = b.Put([]byte(searchID), searchBytes)
+		if err != nil {
+			return err
+		}
+
+		nb := tx.Bucket([]byte(notificationsBucket))
+		for _, n := range notes {
+			id, err := nb.NextSequence()
+			if err != nil {
+				return err
+			}
+			n.ID = id
+
+			noteBytes, err := json.Marshal(n)
+			if err != nil {
+				return err
+			}
+
+			err = nb.Put(itob(id), noteBytes)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	return err
+
+}
+
+// ListNotifications returns up to <limit> of a user's notifications, newest
+// first
+func (d *Datastore) ListNotifications(owner string, limit int) ([]*savedsearch.Notification, error) {
+
+	notes := []*savedsearch.Notification{}
+
+	err := d.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket([]byte(notificationsBucket)).Cursor()
+
+		for k, v := c.Last(); k != nil && len(notes) < limit; k, v = c.Prev() {
+			n := savedsearch.Notification{}
+			err := json.Unmarshal(v, &n)
+			if err != nil {
+				return err
+			}
+
+			if n.Owner == owner {
+				notes = append(notes, &n)
+			}
+		}
+
+		return nil
+	})
+
+	return notes, err
+
+}
+
+// DeleteNotifications deletes all of a user's notifications
+func (d *Datastore) DeleteNotifications(owner string) error {
+
+	err := d.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(notificationsBucket))
+
+		keys := [][]byte{}
+		err := b.ForEach(func(k, v []byte) error {
+			n := savedsearch.Notification{}
+			err := json.Unmarshal(v, &n)
+			if err != nil {
+				return err
+			}
+			if n.Owner == owner {
+				keys = append(keys, append([]byte{}, k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, k := range keys {
+			err = b.Delete(k)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	return err
+
+}
@@ -1,6 +1,7 @@
 package datastore
 
 import (
+	"crypto/subtle"
 	"encoding/json"
 	"errors"
 
@@ -69,9 +70,7 @@ func (d *Datastore) CreateUser(u *user.User) error {
 	}
 
 	err = d.db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(usersBucket))
-		err := b.Put([]byte(u.ID), userBytes)
-		return err
+		return putUser(tx, u.ID, userBytes, u.FeedToken)
 	})
 
 	return err
@@ -95,9 +94,7 @@ func (d *Datastore) UpdateUser(u *user.User) error {
 	}
 
 	err = d.db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(usersBucket))
-		err := b.Put([]byte(u.ID), userBytes)
-		return err
+		return putUser(tx, u.ID, userBytes, u.FeedToken)
 	})
 
 	return err
@@ -107,9 +104,12 @@ func (d *Datastore) UpdateUser(u *user.User) error {
 func (d *Datastore) DeleteUser(id string) error {
 
 	err := d.db.Update(func(tx *bolt.Tx) error {
+		err := unindexFeedToken(tx, id)
+		if err != nil {
+			return err
+		}
 		b := tx.Bucket([]byte(usersBucket))
-		err := b.Delete([]byte(id))
-		return err
+		return b.Delete([]byte(id))
 	})
 	return err
 
@@ -148,3 +148,99 @@ func (d *Datastore) GetUser(id string) (*user.User, error) {
 	return &u, nil
 
 }
+
+// GetUserByFeedToken returns the user a feed token belongs to, or nil if the
+// token isn't valid. Users are looked up by the hash of their token.
+func (d *Datastore) GetUserByFeedToken(token string) (*user.User, error) {
+
+	hash := user.HashFeedToken(token)
+	var userBytes []byte
+
+	err := d.db.View(func(tx *bolt.Tx) error {
+		id := tx.Bucket([]byte(feedTokensBucket)).Get(hash)
+		if id == nil {
+			return nil
+		}
+		if v := tx.Bucket([]byte(usersBucket)).Get(id); v != nil {
+			userBytes = append([]byte{}, v...)
+		}
+		return nil
+	})
+	if err != nil || userBytes == nil {
+		return nil, err
+	}
+
+	u := user.User{}
+	err = json.Unmarshal(userBytes, &u)
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare(u.FeedToken, hash) != 1 {
+		return nil, nil
+	}
+
+	return &u, nil
+
+}
+
+// putUser saves a user, and keeps the index of feed token hashes in step
+// with it
+func putUser(tx *bolt.Tx, id string, userBytes []byte, feedToken []byte) error {
+
+	err := unindexFeedToken(tx, id)
+	if err != nil {
+		return err
+	}
+
+	if len(feedToken) > 0 {
+		err = tx.Bucket([]byte(feedTokensBucket)).Put(feedToken, []byte(id))
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Bucket([]byte(usersBucket)).Put([]byte(id), userBytes)
+
+}
+
+// unindexFeedToken removes a user's current feed token from the index
+func unindexFeedToken(tx *bolt.Tx, id string) error {
+
+	v := tx.Bucket([]byte(usersBucket)).Get([]byte(id))
+	if v == nil {
+		return nil
+	}
+
+	old := user.User{}
+	err := json.Unmarshal(v, &old)
+	if err != nil {
+		return err
+	}
+	if len(old.FeedToken) == 0 {
+		return nil
+	}
+
+	return tx.Bucket([]byte(feedTokensBucket)).Delete(old.FeedToken)
+
+}
+
+// ForEachUser calls fn for every user in the datastore. If fn returns an
+// error, iteration stops and the error is returned. fn runs inside a read
+// transaction, so it must not write to the datastore.
+func (d *Datastore) ForEachUser(fn func(u *user.User) error) error {
+
+	err := d.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(usersBucket))
+		return b.ForEach(func(k, v []byte) error {
+			u := user.User{}
+			err := json.Unmarshal(v, &u)
+			if err != nil {
+				return err
+			}
+			return fn(&u)
+		})
+	})
+
+	return err
+
+}
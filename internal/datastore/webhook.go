@@ -0,0 +1,338 @@
+package datastore
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/idrum4316/devpad-server/internal/webhook"
+	bolt "go.etcd.io/bbolt"
+)
+
+// CreateWebhook saves a new webhook in the datastore
+func (d *Datastore) CreateWebhook(w *webhook.Webhook) error {
+
+	hookBytes, err := json.Marshal(w)
+	if err != nil {
+		return err
+	}
+
+	err = d.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(webhooksBucket))
+		if b.Get([]byte(w.ID)) != nil {
+			return errors.New("webhook already exists")
+		}
+		return b.Put([]byte(w.ID), hookBytes)
+	})
+
+	return err
+
+}
+
+// GetWebhook returns a webhook from the datastore, or nil if it doesn't exist
+func (d *Datastore) GetWebhook(id string) (*webhook.Webhook, error) {
+
+	var hookBytes []byte
+
+	err := d.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(webhooksBucket))
+		v := b.Get([]byte(id))
+		if v != nil {
+			hookBytes = append([]byte{}, v...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if hookBytes == nil {
+		return nil, nil
+	}
+
+	w := webhook.Webhook{}
+	err = json.Unmarshal(hookBytes, &w)
+	if err != nil {
+		return nil, err
+	}
+
+	return &w, nil
+
+}
+
+// ListWebhooks returns every webhook in the datastore
+func (d *Datastore) ListWebhooks() ([]*webhook.Webhook, error) {
+
+	hooks := []*webhook.Webhook{}
+
+	err := d.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(webhooksBucket))
+		return b.ForEach(func(k, v []byte) error {
+			w := webhook.Webhook{}
+			err := json.Unmarshal(v, &w)
+			if err != nil {
+				return err
+			}
+			hooks = append(hooks, &w)
+			return nil
+		})
+	})
+
+	return hooks, err
+
+}
+
+// DeleteWebhook deletes a webhook from the datastore, along with its
+// deliveries. Any that were still queued are never attempted.
+func (d *Datastore) DeleteWebhook(id string) error {
+
+	err := d.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(webhooksBucket))
+		err := b.Delete([]byte(id))
+		if err != nil {
+			return err
+		}
+
+		deliveries := tx.Bucket([]byte(deliveriesBucket))
+		hook := deliveries.Bucket([]byte(id))
+		if hook == nil {
+			return nil
+		}
+
+		q := tx.Bucket([]byte(queueBucket))
+		err = hook.ForEach(func(k, v []byte) error {
+			return q.Delete(k)
+		})
+		if err != nil {
+			return err
+		}
+
+		return deliveries.DeleteBucket([]byte(id))
+	})
+	return err
+
+}
+
+// EnqueueDeliveries saves new deliveries and adds them to the retry queue. It
+// assigns an ID to each of them.
+//
+// Deliveries are kept in a bucket for each webhook, under the deliveries
+// bucket, so a webhook's deliveries can be listed and pruned without reading
+// everyone else's. The queue maps the IDs of pending deliveries to the
+// webhook they're for.
+func (d *Datastore) EnqueueDeliveries(deliveries []*webhook.Delivery) error {
+
+	err := d.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(deliveriesBucket))
+		q := tx.Bucket([]byte(queueBucket))
+
+		for _, del := range deliveries {
+			id, err := b.NextSequence()
+			if err != nil {
+				return err
+			}
+			del.ID = id
+
+			delBytes, err := json.Marshal(del)
+			if err != nil {
+				return err
+			}
+
+			hook, err := b.CreateBucketIfNotExists([]byte(del.WebhookID))
+			if err != nil {
+				return err
+			}
+
+			err = hook.Put(itob(id), delBytes)
+			if err != nil {
+				return err
+			}
+
+			err = q.Put(itob(id), []byte(del.WebhookID))
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	return err
+
+}
+
+// DueDeliveries returns up to <limit> queued deliveries whose next attempt is
+// at or before <now>.
+func (d *Datastore) DueDeliveries(now time.Time, limit int) ([]*webhook.Delivery, error) {
+
+	due := []*webhook.Delivery{}
+
+	err := d.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(deliveriesBucket))
+		c := tx.Bucket([]byte(queueBucket)).Cursor()
+
+		for k, hookID := c.First(); k != nil && len(due) < limit; k, hookID = c.Next() {
+			hook := b.Bucket(hookID)
+			if hook == nil {
+				continue
+			}
+			v := hook.Get(k)
+			if v == nil {
+				continue
+			}
+
+			del := webhook.Delivery{}
+			err := json.Unmarshal(v, &del)
+			if err != nil {
+				return err
+			}
+
+			if !del.NextAttempt.After(now) {
+				due = append(due, &del)
+			}
+		}
+
+		return nil
+	})
+
+	return due, err
+
+}
+
+// UpdateDelivery saves the delivery and removes it from the retry queue once
+// it is no longer pending. Deliveries for webhooks that have been deleted are
+// only taken off the queue.
+func (d *Datastore) UpdateDelivery(del *webhook.Delivery) error {
+
+	delBytes, err := json.Marshal(del)
+	if err != nil {
+		return err
+	}
+
+	err = d.db.Update(func(tx *bolt.Tx) error {
+		q := tx.Bucket([]byte(queueBucket))
+
+		hook := tx.Bucket([]byte(deliveriesBucket)).Bucket([]byte(del.WebhookID))
+		if hook == nil || hook.Get(itob(del.ID)) == nil {
+			return q.Delete(itob(del.ID))
+		}
+
+		err := hook.Put(itob(del.ID), delBytes)
+		if err != nil {
+			return err
+		}
+
+		if del.Status != webhook.StatusPending {
+			return q.Delete(itob(del.ID))
+		}
+		return nil
+	})
+
+	return err
+
+}
+
+// ListDeliveries returns up to <limit> deliveries for a webhook, newest first
+func (d *Datastore) ListDeliveries(webhookID string, limit int) ([]*webhook.Delivery, error) {
+
+	deliveries := []*webhook.Delivery{}
+
+	err := d.db.View(func(tx *bolt.Tx) error {
+		hook := tx.Bucket([]byte(deliveriesBucket)).Bucket([]byte(webhookID))
+		if hook == nil {
+			return nil
+		}
+
+		c := hook.Cursor()
+		for k, v := c.Last(); k != nil && len(deliveries) < limit; k, v = c.Prev() {
+			del := webhook.Delivery{}
+			err := json.Unmarshal(v, &del)
+			if err != nil {
+				return err
+			}
+			deliveries = append(deliveries, &del)
+		}
+
+		return nil
+	})
+
+	return deliveries, err
+
+}
+
+// PruneDeliveries deletes the finished deliveries of every webhook that were
+// last updated before <before>, and all but the newest <keep> of the rest.
+// Pending deliveries are left alone, unless what they were queued for is
+// gone.
+func (d *Datastore) PruneDeliveries(before time.Time, keep int) error {
+
+	err := d.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(deliveriesBucket))
+		q := tx.Bucket([]byte(queueBucket))
+
+		// Keys can't be deleted while they're being iterated over
+		orphans := [][]byte{}
+		err := q.ForEach(func(k, hookID []byte) error {
+			hook := b.Bucket(hookID)
+			if hook == nil || hook.Get(k) == nil {
+				orphans = append(orphans, append([]byte{}, k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range orphans {
+			err := q.Delete(k)
+			if err != nil {
+				return err
+			}
+		}
+
+		hookIDs := [][]byte{}
+		err = b.ForEach(func(k, v []byte) error {
+			if v == nil {
+				hookIDs = append(hookIDs, append([]byte{}, k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, hookID := range hookIDs {
+			hook := b.Bucket(hookID)
+			finished := 0
+			expired := [][]byte{}
+			c := hook.Cursor()
+			for k, v := c.Last(); k != nil; k, v = c.Prev() {
+				if q.Get(k) != nil {
+					continue
+				}
+
+				del := webhook.Delivery{}
+				err := json.Unmarshal(v, &del)
+				if err != nil {
+					return err
+				}
+
+				finished++
+				if finished > keep || del.Updated.Before(before) {
+					expired = append(expired, append([]byte{}, k...))
+				}
+			}
+
+			for _, k := range expired {
+				err := hook.Delete(k)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+
+	return err
+
+}
@@ -0,0 +1,179 @@
+package epub
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Book is an EPUB 3 book made of HTML chapters
+type Book struct {
+	Title      string
+	Language   string
+	Identifier string
+	Modified   time.Time
+
+	// A stylesheet that every chapter uses
+	CSS string
+
+	Chapters []*Chapter
+}
+
+// Chapter is a chapter of a book. Body is an HTML fragment, which is turned
+// into XHTML when the book is written. Language is the chapter's language,
+// if it differs from the book's.
+type Chapter struct {
+	Title    string
+	Language string
+	Body     []byte
+}
+
+// heading is a heading in a chapter, for the table of contents
+type heading struct {
+	Level int
+	ID    string
+	Title string
+}
+
+// chapterDoc is a chapter as it's written to the book
+type chapterDoc struct {
+	File     string
+	Title    string
+	Language string
+	Body     string
+	Headings []heading
+}
+
+// bookFile is a file of the book that is made from a template
+type bookFile struct {
+	name string
+	tmpl string
+	data interface{}
+}
+
+// ChapterFile returns the file name of the i'th chapter, so links between
+// chapters can be made before the book is written
+func ChapterFile(i int) string {
+	return fmt.Sprintf("chapter-%04d.xhtml", i+1)
+}
+
+// NewIdentifier returns a random urn:uuid identifier for a book
+func NewIdentifier() (string, error) {
+
+	b := make([]byte, 16)
+	_, err := io.ReadFull(rand.Reader, b)
+	if err != nil {
+		return "", err
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+
+	return fmt.Sprintf("urn:uuid:%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+
+}
+
+// Write writes the book to w as an EPUB file. The table of contents lists
+// every chapter with the headings in it.
+func (b *Book) Write(w io.Writer) error {
+
+	docs := []*chapterDoc{}
+	for i, c := range b.Chapters {
+		body, headings, err := toXHTML(c.Body, i)
+		if err != nil {
+			return fmt.Errorf("chapter %q: %s", c.Title, err)
+		}
+
+		// The table of contents already has the chapter title in it
+		if len(headings) > 0 && headings[0].Title == c.Title {
+			headings = headings[1:]
+		}
+
+		language := c.Language
+		if language == "" {
+			language = b.Language
+		}
+
+		docs = append(docs, &chapterDoc{
+			File:     ChapterFile(i),
+			Title:    c.Title,
+			Language: language,
+			Body:     string(body),
+			Headings: headings,
+		})
+	}
+
+	data := map[string]interface{}{
+		"Book":     b,
+		"Chapters": docs,
+		"Modified": b.Modified.UTC().Format("2006-01-02T15:04:05Z"),
+	}
+
+	zw := zip.NewWriter(w)
+
+	// The mimetype has to come first, and can't be compressed
+	f, err := zw.CreateHeader(&zip.FileHeader{
+		Name:     "mimetype",
+		Method:   zip.Store,
+		Modified: b.Modified,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(f, "application/epub+zip")
+	if err != nil {
+		return err
+	}
+
+	files := []bookFile{
+		{"META-INF/container.xml", "container", data},
+		{"OEBPS/content.opf", "opf", data},
+		{"OEBPS/nav.xhtml", "nav", data},
+		{"OEBPS/toc.ncx", "ncx", data},
+	}
+	for _, doc := range docs {
+		files = append(files, bookFile{"OEBPS/" + doc.File, "chapter", map[string]interface{}{
+			"Book":    b,
+			"Chapter": doc,
+		}})
+	}
+
+	for _, file := range files {
+		buf := bytes.Buffer{}
+		err = templates.ExecuteTemplate(&buf, file.tmpl, file.data)
+		if err != nil {
+			return err
+		}
+
+		f, err = zw.CreateHeader(&zip.FileHeader{
+			Name:     file.name,
+			Method:   zip.Deflate,
+			Modified: b.Modified,
+		})
+		if err != nil {
+			return err
+		}
+		_, err = f.Write(buf.Bytes())
+		if err != nil {
+			return err
+		}
+	}
+
+	f, err = zw.CreateHeader(&zip.FileHeader{
+		Name:     "OEBPS/style.css",
+		Method:   zip.Deflate,
+		Modified: b.Modified,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(f, b.CSS)
+	if err != nil {
+		return err
+	}
+
+	return zw.Close()
+
+}
@@ -0,0 +1,104 @@
+package epub
+
+import (
+	"text/template"
+)
+
+var templates = template.Must(template.New("").Funcs(template.FuncMap{
+	"esc": xmlEscape,
+	"inc": func(i int) int { return i + 1 },
+}).Parse(`
+{{define "container"}}<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>
+{{end}}
+
+{{define "opf"}}<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="book-id" xml:lang="{{esc .Book.Language}}">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:identifier id="book-id">{{esc .Book.Identifier}}</dc:identifier>
+    <dc:title>{{esc .Book.Title}}</dc:title>
+    <dc:language>{{esc .Book.Language}}</dc:language>
+    <meta property="dcterms:modified">{{.Modified}}</meta>
+  </metadata>
+  <manifest>
+    <item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>
+    <item id="ncx" href="toc.ncx" media-type="application/x-dtbncx+xml"/>
+    <item id="style" href="style.css" media-type="text/css"/>
+{{- range $i, $c := .Chapters}}
+    <item id="chapter-{{inc $i}}" href="{{$c.File}}" media-type="application/xhtml+xml"/>
+{{- end}}
+  </manifest>
+  <spine toc="ncx">
+{{- range $i, $c := .Chapters}}
+    <itemref idref="chapter-{{inc $i}}"/>
+{{- end}}
+  </spine>
+</package>
+{{end}}
+
+{{define "nav"}}<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" xml:lang="{{esc .Book.Language}}" lang="{{esc .Book.Language}}">
+<head>
+<title>{{esc .Book.Title}}</title>
+<link rel="stylesheet" type="text/css" href="style.css"/>
+</head>
+<body>
+<nav epub:type="toc" id="toc">
+<h1>{{esc .Book.Title}}</h1>
+<ol>
+{{- range .Chapters}}
+<li><a href="{{.File}}">{{esc .Title}}</a>
+{{- if .Headings}}
+<ol>
+{{- $file := .File}}
+{{- range .Headings}}
+<li><a href="{{$file}}#{{.ID}}">{{esc .Title}}</a></li>
+{{- end}}
+</ol>
+{{- end}}
+</li>
+{{- end}}
+</ol>
+</nav>
+</body>
+</html>
+{{end}}
+
+{{define "ncx"}}<?xml version="1.0" encoding="UTF-8"?>
+<ncx xmlns="http://www.daisy.org/z3986/2005/ncx/" version="2005-1">
+<head>
+<meta name="dtb:uid" content="{{esc .Book.Identifier}}"/>
+<meta name="dtb:depth" content="1"/>
+<meta name="dtb:totalPageCount" content="0"/>
+<meta name="dtb:maxPageNumber" content="0"/>
+</head>
+<docTitle><text>{{esc .Book.Title}}</text></docTitle>
+<navMap>
+{{- range $i, $c := .Chapters}}
+<navPoint id="nav-{{inc $i}}">
+<navLabel><text>{{esc $c.Title}}</text></navLabel>
+<content src="{{$c.File}}"/>
+</navPoint>
+{{- end}}
+</navMap>
+</ncx>
+{{end}}
+
+{{define "chapter"}}<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xml:lang="{{esc .Chapter.Language}}" lang="{{esc .Chapter.Language}}">
+<head>
+<title>{{esc .Chapter.Title}}</title>
+<link rel="stylesheet" type="text/css" href="style.css"/>
+</head>
+<body>
+{{.Chapter.Body}}
+</body>
+</html>
+{{end}}
+`))
@@ -0,0 +1,295 @@
+package epub
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+var (
+	chapterLink = regexp.MustCompile(`^chapter-\d+\.xhtml(#.*)?$`)
+	xmlName     = regexp.MustCompile(`^[a-zA-Z_][-a-zA-Z0-9_.]*$`)
+
+	xmlEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;")
+)
+
+// Elements that are left out of a book, along with what's in them
+var droppedElements = map[atom.Atom]bool{
+	atom.Script:   true,
+	atom.Style:    true,
+	atom.Iframe:   true,
+	atom.Object:   true,
+	atom.Embed:    true,
+	atom.Noscript: true,
+}
+
+// Elements that can't have anything in them
+var voidElements = map[atom.Atom]bool{
+	atom.Area:   true,
+	atom.Br:     true,
+	atom.Col:    true,
+	atom.Hr:     true,
+	atom.Img:    true,
+	atom.Input:  true,
+	atom.Source: true,
+	atom.Track:  true,
+	atom.Wbr:    true,
+}
+
+// xhtmlWriter turns HTML into XHTML
+type xhtmlWriter struct {
+	buf      bytes.Buffer
+	chapter  int
+	headings []heading
+	ids      map[string]bool
+}
+
+// toXHTML turns an HTML fragment into well-formed XHTML, as EPUB requires.
+// Headings are given IDs so the table of contents can link to them. Links
+// that don't lead anywhere inside the book or to another site are removed,
+// and images become links to them, since everything shown in a book has to
+// be inside of it.
+func toXHTML(fragment []byte, chapter int) ([]byte, []heading, error) {
+
+	body := &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body}
+	nodes, err := html.ParseFragment(bytes.NewReader(fragment), body)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	w := xhtmlWriter{
+		chapter: chapter,
+		ids:     map[string]bool{},
+	}
+	for _, n := range nodes {
+		w.collectIDs(n)
+	}
+	for _, n := range nodes {
+		w.write(n)
+	}
+
+	return w.buf.Bytes(), w.headings, nil
+
+}
+
+// collectIDs remembers the IDs that are already used
+func (w *xhtmlWriter) collectIDs(n *html.Node) {
+	for _, attr := range n.Attr {
+		if attr.Key == "id" {
+			w.ids[attr.Val] = true
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		w.collectIDs(c)
+	}
+}
+
+// write writes a node and everything in it
+func (w *xhtmlWriter) write(n *html.Node) {
+
+	switch n.Type {
+	case html.TextNode:
+		w.buf.WriteString(xmlEscape(n.Data))
+		return
+	case html.ElementNode:
+	default:
+		return
+	}
+
+	if droppedElements[n.DataAtom] {
+		return
+	}
+
+	attrs := n.Attr
+	switch n.DataAtom {
+	case atom.H1, atom.H2, atom.H3:
+		attrs = w.addHeading(n)
+
+	case atom.A:
+		attrs = filterAttrs(attrs, func(a html.Attribute) bool {
+			return a.Key != "href" || isBookLink(a.Val)
+		})
+
+	case atom.Img:
+		w.writeImageLink(n)
+		return
+	}
+
+	w.buf.WriteString("<" + n.Data)
+	for _, attr := range attrs {
+		if attr.Namespace != "" || !xmlName.MatchString(attr.Key) {
+			continue
+		}
+		fmt.Fprintf(&w.buf, ` %s="%s"`, attr.Key, xmlEscape(attr.Val))
+	}
+
+	if voidElements[n.DataAtom] {
+		w.buf.WriteString("/>")
+		return
+	}
+	w.buf.WriteString(">")
+
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		w.write(c)
+	}
+
+	w.buf.WriteString("</" + n.Data + ">")
+
+}
+
+// addHeading adds a heading to the table of contents, giving it an ID if it
+// doesn't have one, and returns its attributes
+func (w *xhtmlWriter) addHeading(n *html.Node) []html.Attribute {
+
+	attrs := n.Attr
+	id := ""
+	for _, attr := range attrs {
+		if attr.Key == "id" {
+			id = attr.Val
+		}
+	}
+
+	title := strings.Join(strings.Fields(textContent(n)), " ")
+
+	// IDs are made the same way Markdown heading IDs are, so links to
+	// #some-heading keep working
+	if id == "" {
+		base := anchorName(title)
+		if base == "" {
+			base = fmt.Sprintf("chapter-%d-heading", w.chapter+1)
+		}
+		id = base
+		for i := 1; w.ids[id]; i++ {
+			id = fmt.Sprintf("%s-%d", base, i)
+		}
+		w.ids[id] = true
+		attrs = append(append([]html.Attribute{}, attrs...), html.Attribute{Key: "id", Val: id})
+	}
+
+	if title != "" {
+		w.headings = append(w.headings, heading{
+			Level: int(n.Data[1] - '0'),
+			ID:    id,
+			Title: title,
+		})
+	}
+
+	return attrs
+
+}
+
+// writeImageLink writes a link to an image in place of the image
+func (w *xhtmlWriter) writeImageLink(n *html.Node) {
+
+	src, alt := "", ""
+	for _, attr := range n.Attr {
+		switch attr.Key {
+		case "src":
+			src = attr.Val
+		case "alt":
+			alt = attr.Val
+		}
+	}
+
+	text := alt
+	if text == "" {
+		text = "image"
+	}
+
+	if isBookLink(src) && !strings.HasPrefix(src, "#") && !chapterLink.MatchString(src) {
+		fmt.Fprintf(&w.buf, `<a href="%s">%s</a>`, xmlEscape(src), xmlEscape(text))
+	} else {
+		w.buf.WriteString(xmlEscape(text))
+	}
+
+}
+
+// isBookLink returns true if a link leads somewhere from inside the book:
+// another site, a chapter or a place in the same chapter
+func isBookLink(href string) bool {
+
+	if strings.HasPrefix(href, "#") || chapterLink.MatchString(href) {
+		return true
+	}
+
+	u, err := url.Parse(href)
+	if err != nil {
+		return false
+	}
+
+	switch u.Scheme {
+	case "http", "https", "mailto":
+		return true
+	}
+	return false
+
+}
+
+// filterAttrs returns the attributes keep returns true for
+func filterAttrs(attrs []html.Attribute, keep func(a html.Attribute) bool) []html.Attribute {
+	kept := []html.Attribute{}
+	for _, a := range attrs {
+		if keep(a) {
+			kept = append(kept, a)
+		}
+	}
+	return kept
+}
+
+// anchorName turns heading text into an ID: lowercase letters and numbers,
+// with everything else between them becoming a dash
+func anchorName(text string) string {
+
+	var name []rune
+	dash := false
+	for _, r := range text {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsNumber(r):
+			if dash && len(name) > 0 {
+				name = append(name, '-')
+			}
+			dash = false
+			name = append(name, unicode.ToLower(r))
+		default:
+			dash = true
+		}
+	}
+
+	return string(name)
+
+}
+
+// textContent returns all of the text in a node
+func textContent(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	s := ""
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		s += textContent(c)
+	}
+	return s
+}
+
+// xmlEscape escapes text for XML, leaving out characters XML doesn't allow
+func xmlEscape(s string) string {
+
+	s = strings.Map(func(r rune) rune {
+		if r < 0x20 && r != '\t' && r != '\n' && r != '\r' {
+			return -1
+		}
+		if r == 0xFFFE || r == 0xFFFF {
+			return -1
+		}
+		return r
+	}, s)
+
+	return xmlEscaper.Replace(s)
+
+}
@@ -0,0 +1,167 @@
+package event
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// subscriberBuffer is how many events a subscriber can fall behind before it
+// is dropped
+const subscriberBuffer = 64
+
+// Log is the persistent, ordered storage for published events. TrimEvents
+// deletes the events that happened before <before>.
+type Log interface {
+	AppendEvent(e *Event) error
+	EventsSince(id uint64, limit int) ([]*Event, error)
+	TrimEvents(before time.Time) error
+}
+
+// Broker saves events to the log and fans them out to live subscribers. While
+// it's started, events older than Retention are trimmed from the log every
+// TrimInterval. A Retention of 0 keeps every event.
+type Broker struct {
+	Retention    time.Duration
+	TrimInterval time.Duration
+
+	log Log
+
+	// Publishers take turns, so events are logged and sent out in the same
+	// order. Subscribers only wait for events to be sent out, not logged.
+	publish     sync.Mutex
+	mu          sync.Mutex
+	subscribers map[*Subscription]struct{}
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// Subscription receives every event published after it was created. C is
+// closed when the subscription is cancelled, or when the subscriber falls too
+// far behind. A dropped subscriber can catch up from the log.
+type Subscription struct {
+	C      chan *Event
+	broker *Broker
+}
+
+// NewBroker returns a new Broker that saves events to l
+func NewBroker(l Log) *Broker {
+	return &Broker{
+		Retention:    90 * 24 * time.Hour,
+		TrimInterval: time.Hour,
+		log:          l,
+		subscribers:  map[*Subscription]struct{}{},
+	}
+}
+
+// Publish assigns the next ID to the event, saves it in the log and sends it
+// to every subscriber. Events are delivered in ID order. The timestamp is set
+// here as well, so the log is in time order too.
+func (b *Broker) Publish(e *Event) error {
+
+	b.publish.Lock()
+	defer b.publish.Unlock()
+
+	e.Timestamp = time.Now()
+	err := b.log.AppendEvent(e)
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for s := range b.subscribers {
+		select {
+		case s.C <- e:
+		default:
+			delete(b.subscribers, s)
+			close(s.C)
+		}
+	}
+
+	return nil
+
+}
+
+// Start trims the log in the background until Stop is called
+func (b *Broker) Start() {
+
+	b.stop = make(chan struct{})
+	b.wg.Add(1)
+
+	go func() {
+		defer b.wg.Done()
+
+		ticker := time.NewTicker(b.TrimInterval)
+		defer ticker.Stop()
+
+		for {
+			err := b.Trim()
+			if err != nil {
+				log.Println("event:", err)
+			}
+
+			select {
+			case <-b.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+}
+
+// Stop stops trimming the log and waits for it to finish
+func (b *Broker) Stop() {
+	if b.stop == nil {
+		return
+	}
+	close(b.stop)
+	b.wg.Wait()
+	b.stop = nil
+}
+
+// Trim deletes the events older than the retention period from the log
+func (b *Broker) Trim() error {
+	if b.Retention <= 0 {
+		return nil
+	}
+	return b.log.TrimEvents(time.Now().Add(-b.Retention))
+}
+
+// Since returns up to <limit> logged events with an ID greater than <id>
+func (b *Broker) Since(id uint64, limit int) ([]*Event, error) {
+	return b.log.EventsSince(id, limit)
+}
+
+// Subscribe returns a new subscription to published events
+func (b *Broker) Subscribe() *Subscription {
+
+	s := &Subscription{
+		C:      make(chan *Event, subscriberBuffer),
+		broker: b,
+	}
+
+	b.mu.Lock()
+	b.subscribers[s] = struct{}{}
+	b.mu.Unlock()
+
+	return s
+
+}
+
+// Cancel stops the subscription and closes its channel
+func (s *Subscription) Cancel() {
+
+	b := s.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.subscribers[s]; ok {
+		delete(b.subscribers, s)
+		close(s.C)
+	}
+
+}
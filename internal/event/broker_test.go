@@ -0,0 +1,93 @@
+package event
+
+import (
+	"testing"
+	"time"
+)
+
+// slowLog is an event log whose appends wait until they're released
+type slowLog struct {
+	release chan struct{}
+	trimmed time.Time
+	nextID  uint64
+}
+
+func (l *slowLog) AppendEvent(e *Event) error {
+	<-l.release
+	l.nextID++
+	e.ID = l.nextID
+	return nil
+}
+
+func (l *slowLog) EventsSince(id uint64, limit int) ([]*Event, error) {
+	return []*Event{}, nil
+}
+
+func (l *slowLog) TrimEvents(before time.Time) error {
+	l.trimmed = before
+	return nil
+}
+
+func TestSubscribeWhilePublishing(t *testing.T) {
+
+	l := &slowLog{release: make(chan struct{})}
+	b := NewBroker(l)
+
+	published := make(chan error)
+	go func() {
+		published <- b.Publish(New(PageCreated, "someone"))
+	}()
+
+	// Subscribing and cancelling don't wait for the event to be logged
+	subscribed := make(chan *Subscription)
+	go func() {
+		s := b.Subscribe()
+		s.Cancel()
+		subscribed <- b.Subscribe()
+	}()
+
+	var s *Subscription
+	select {
+	case s = <-subscribed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("subscribing waited for the event log")
+	}
+
+	close(l.release)
+	err := <-published
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := <-s.C
+	if e.ID != 1 || e.Type != PageCreated {
+		t.Fatalf("unexpected event %+v", e)
+	}
+	s.Cancel()
+
+}
+
+func TestTrim(t *testing.T) {
+
+	l := &slowLog{}
+	b := NewBroker(l)
+
+	b.Retention = 0
+	err := b.Trim()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !l.trimmed.IsZero() {
+		t.Fatal("the log was trimmed without a retention period")
+	}
+
+	b.Retention = time.Hour
+	err = b.Trim()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(l.trimmed); d < time.Hour || d > time.Hour+time.Minute {
+		t.Fatalf("expected events older than an hour to be trimmed, got %s", d)
+	}
+
+}
@@ -0,0 +1,86 @@
+package event
+
+import (
+	"strings"
+	"time"
+)
+
+// NamespaceSeparator separates a page's namespace from the rest of its slug,
+// as in "ops:deploy-checklist".
+const NamespaceSeparator = ":"
+
+// The event types that can be published
+const (
+	PageCreated = "page.created"
+	PageUpdated = "page.updated"
+	PageDeleted = "page.deleted"
+	PageRenamed = "page.renamed"
+	UserCreated = "user.created"
+)
+
+// Types is a list of every known event type
+var Types = []string{
+	PageCreated,
+	PageUpdated,
+	PageDeleted,
+	PageRenamed,
+	UserCreated,
+}
+
+// Event describes a change that happened to a page or a user
+type Event struct {
+	ID        uint64    `json:"id"`
+	Type      string    `json:"type"`
+	Timestamp time.Time `json:"timestamp"`
+	Actor     string    `json:"actor,omitempty"`
+	Slug      string    `json:"slug,omitempty"`
+	OldSlug   string    `json:"old_slug,omitempty"`
+	Title     string    `json:"title,omitempty"`
+	Tags      []string  `json:"tags,omitempty"`
+	UserID    string    `json:"user_id,omitempty"`
+}
+
+// IsPageEvent returns true if the event describes a change to a page
+func (e *Event) IsPageEvent() bool {
+	return e.Type == PageCreated || e.Type == PageUpdated ||
+		e.Type == PageDeleted || e.Type == PageRenamed
+}
+
+// Namespace returns the namespace of the page the event is about, or an
+// empty string if its slug doesn't have one
+func (e *Event) Namespace() string {
+	i := strings.Index(e.Slug, NamespaceSeparator)
+	if i < 0 {
+		return ""
+	}
+	return e.Slug[:i]
+}
+
+// HasTag returns true if the page the event is about has the tag
+func (e *Event) HasTag(tag string) bool {
+	for _, t := range e.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// New returns a new event of type t, timestamped with the current time
+func New(t string, actor string) *Event {
+	return &Event{
+		Type:      t,
+		Timestamp: time.Now(),
+		Actor:     actor,
+	}
+}
+
+// IsValidType returns true if t is a known event type
+func IsValidType(t string) bool {
+	for _, known := range Types {
+		if t == known {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,555 @@
+package filestore
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/idrum4316/devpad-server/internal/page"
+	"github.com/idrum4316/devpad-server/internal/storage"
+)
+
+// Extension is the file extension of page files
+const Extension = ".md"
+
+// writtenExpiry is how long the store remembers a change it made whose event
+// never reached the watcher
+const writtenExpiry = time.Minute
+
+// FileStore keeps every page as a Markdown file with TOML front matter. A
+// namespaced slug like "ops:deploy" is stored as ops/deploy.md.
+type FileStore struct {
+	dir string
+
+	// Writes hold a read lock, so they can be paused while a snapshot is
+	// made
+	writeMu sync.RWMutex
+
+	// Writes are made one at a time, so nothing can change a page between
+	// UpdatePageIf checking it and writing it
+	pageMu sync.Mutex
+
+	// What the store itself last wrote to each file, so the watcher can
+	// tell our own changes apart from external ones. It's only kept while
+	// a watcher is running, until the watcher sees the change.
+	mu       sync.Mutex
+	watching bool
+	written  map[string]*writtenFile
+}
+
+// writtenFile is a hash of what the store wrote to a file (nil if it deleted
+// the file) and when
+type writtenFile struct {
+	hash []byte
+	at   time.Time
+}
+
+// Make sure FileStore implements everything it should
+var _ storage.PageStore = (*FileStore)(nil)
+
+// New returns a FileStore that keeps pages under dir, creating it if needed
+func New(dir string) (*FileStore, error) {
+
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	fs := FileStore{
+		dir:     abs,
+		written: map[string]*writtenFile{},
+	}
+
+	return &fs, nil
+
+}
+
+// Dir returns the directory the pages are kept in
+func (f *FileStore) Dir() string {
+	return f.dir
+}
+
+// UpdatePage writes a page to its file, creating it if it doesn't exist
+func (f *FileStore) UpdatePage(p *page.Page, pageID string) error {
+
+	f.writeMu.RLock()
+	defer f.writeMu.RUnlock()
+	f.pageMu.Lock()
+	defer f.pageMu.Unlock()
+
+	path, err := f.pathFor(pageID)
+	if err != nil {
+		return err
+	}
+
+	p.Metadata.Modified = time.Now()
+
+	b, err := p.MarshalMarkdown()
+	if err != nil {
+		return err
+	}
+
+	return f.writeFile(path, b)
+
+}
+
+// UpdatePageIf writes a page to its file if check accepts the page that's
+// there. Changes made to the file outside of the store can still come in
+// between.
+func (f *FileStore) UpdatePageIf(p *page.Page, pageID string,
+	check func(current *page.Page) error) (*page.Page, error) {
+
+	f.writeMu.RLock()
+	defer f.writeMu.RUnlock()
+	f.pageMu.Lock()
+	defer f.pageMu.Unlock()
+
+	path, err := f.pathFor(pageID)
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := readPage(path)
+	if err != nil {
+		return nil, err
+	}
+	err = check(current)
+	if err != nil {
+		return nil, err
+	}
+
+	p.Metadata.Modified = time.Now()
+
+	b, err := p.MarshalMarkdown()
+	if err != nil {
+		return nil, err
+	}
+
+	err = f.writeFile(path, b)
+	if err != nil {
+		return nil, err
+	}
+
+	return readPage(path)
+
+}
+
+// PutPages writes pages to their files as they are. The files' own times are
+// set to the pages' modification times, so they aren't taken for hand edits.
+func (f *FileStore) PutPages(pages map[string]*page.Page) error {
+
+	f.writeMu.RLock()
+	defer f.writeMu.RUnlock()
+	f.pageMu.Lock()
+	defer f.pageMu.Unlock()
+
+	for id, p := range pages {
+		path, err := f.pathFor(id)
+		if err != nil {
+			return err
+		}
+
+		b, err := p.MarshalMarkdown()
+		if err != nil {
+			return err
+		}
+
+		err = f.writeFile(path, b)
+		if err != nil {
+			return err
+		}
+
+		if !p.Metadata.Modified.IsZero() {
+			err = os.Chtimes(path, p.Metadata.Modified, p.Metadata.Modified)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+
+}
+
+// RenamePage moves a page to a new file
+func (f *FileStore) RenamePage(oldID string, newID string) error {
+
+	f.writeMu.RLock()
+	defer f.writeMu.RUnlock()
+	f.pageMu.Lock()
+	defer f.pageMu.Unlock()
+
+	oldPath, err := f.pathFor(oldID)
+	if err != nil {
+		return err
+	}
+
+	newPath, err := f.pathFor(newID)
+	if err != nil {
+		return err
+	}
+
+	// Make sure the new ID is available
+	if _, err := os.Stat(newPath); err == nil {
+		return fmt.Errorf("page %s already exists", newID)
+	}
+
+	b, err := ioutil.ReadFile(oldPath)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("could not find page %s", oldID)
+	}
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(newPath), 0700)
+	if err != nil {
+		return err
+	}
+
+	f.remember(newPath, b)
+	f.remember(oldPath, nil)
+	err = os.Rename(oldPath, newPath)
+	if err != nil {
+		return err
+	}
+
+	f.removeEmptyDirs(filepath.Dir(oldPath))
+	return nil
+
+}
+
+// DeletePage removes a page's file
+func (f *FileStore) DeletePage(id string) error {
+
+	f.writeMu.RLock()
+	defer f.writeMu.RUnlock()
+	f.pageMu.Lock()
+	defer f.pageMu.Unlock()
+
+	path, err := f.pathFor(id)
+	if err != nil {
+		return err
+	}
+
+	f.remember(path, nil)
+	err = os.Remove(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	f.removeEmptyDirs(filepath.Dir(path))
+	return nil
+
+}
+
+// GetPage reads a page from its file
+func (f *FileStore) GetPage(id string) (*page.Page, error) {
+
+	path, err := f.pathFor(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return readPage(path)
+
+}
+
+// ForEachPage calls fn for every page file under the directory. If fn returns
+// an error, iteration stops and the error is returned.
+func (f *FileStore) ForEachPage(fn func(id string, p *page.Page) error) error {
+
+	return filepath.Walk(f.dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		// Skip hidden directories, like a .git directory
+		if info.IsDir() {
+			if path != f.dir && strings.HasPrefix(info.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		id, ok := f.idFor(path)
+		if !ok {
+			return nil
+		}
+
+		p, err := readPage(path)
+		if err != nil {
+			return fmt.Errorf("%s: %s", path, err)
+		}
+		if p == nil {
+			return nil
+		}
+
+		return fn(id, p)
+	})
+
+}
+
+// SnapshotTo copies every page file to dir, laid out the same way. Pages
+// can't be changed while the copy is made. If with isn't nil, it's called
+// first while they can't, so other stores can be snapshotted at the same
+// point.
+func (f *FileStore) SnapshotTo(dir string, with func() error) error {
+
+	f.writeMu.Lock()
+	defer f.writeMu.Unlock()
+
+	if with != nil {
+		err := with()
+		if err != nil {
+			return err
+		}
+	}
+
+	return filepath.Walk(f.dir, func(path string, info os.FileInfo, err error) error {
+
+		// Files can still be removed by hand while the copy is made
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		// Skip hidden directories, like a .git directory
+		if info.IsDir() {
+			if path != f.dir && strings.HasPrefix(info.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		// Only pages are copied, not temporary files or anything else
+		if _, ok := f.idFor(path); !ok || !info.Mode().IsRegular() {
+			return nil
+		}
+
+		b, err := ioutil.ReadFile(path)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(f.dir, path)
+		if err != nil {
+			return err
+		}
+		dest := filepath.Join(dir, rel)
+
+		err = os.MkdirAll(filepath.Dir(dest), 0700)
+		if err != nil {
+			return err
+		}
+
+		err = ioutil.WriteFile(dest, b, 0600)
+		if err != nil {
+			return err
+		}
+
+		return os.Chtimes(dest, info.ModTime(), info.ModTime())
+
+	})
+
+}
+
+// pathFor returns the file a page is kept in. Slugs that would end up
+// outside of the directory are refused.
+func (f *FileStore) pathFor(id string) (string, error) {
+
+	if id == "" {
+		return "", errors.New("page id can't be empty")
+	}
+
+	parts := strings.Split(id, ":")
+	for _, part := range parts {
+		if part == "" || part == "." || part == ".." ||
+			strings.ContainsAny(part, `/\`) || strings.HasPrefix(part, ".") {
+			return "", fmt.Errorf("page id %q can't be stored as a file", id)
+		}
+	}
+
+	return filepath.Join(f.dir, filepath.Join(parts...)+Extension), nil
+
+}
+
+// idFor returns the page id of a file, or false if the file isn't a page
+func (f *FileStore) idFor(path string) (string, bool) {
+
+	rel, err := filepath.Rel(f.dir, path)
+	if err != nil || !strings.HasSuffix(rel, Extension) {
+		return "", false
+	}
+
+	rel = strings.TrimSuffix(rel, Extension)
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+		if part == "" || strings.HasPrefix(part, ".") {
+			return "", false
+		}
+	}
+
+	return strings.Replace(rel, string(filepath.Separator), ":", -1), true
+
+}
+
+// writeFile writes a file atomically, so readers (and the watcher) never see
+// it half written
+func (f *FileStore) writeFile(path string, b []byte) error {
+
+	err := os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return err
+	}
+
+	_, err = tmp.Write(b)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	f.remember(path, b)
+	err = os.Rename(tmp.Name(), path)
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+
+	return err
+
+}
+
+// remember records what the store wrote to a file, for the watcher. A nil b
+// means the file was removed. Changes the watcher never saw are forgotten
+// after a while.
+func (f *FileStore) remember(path string, b []byte) {
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if !f.watching {
+		return
+	}
+
+	now := time.Now()
+	for p, w := range f.written {
+		if now.Sub(w.at) > writtenExpiry {
+			delete(f.written, p)
+		}
+	}
+
+	w := writtenFile{at: now}
+	if b != nil {
+		h := sha256.Sum256(b)
+		w.hash = h[:]
+	}
+	f.written[path] = &w
+
+}
+
+// isOwnChange returns true if a file is exactly as the store left it. The
+// change is forgotten once it's been seen.
+func (f *FileStore) isOwnChange(path string, b []byte, exists bool) bool {
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	w, ok := f.written[path]
+	if !ok {
+		return false
+	}
+
+	own := w.hash == nil
+	if exists {
+		h := sha256.Sum256(b)
+		own = w.hash != nil && string(w.hash) == string(h[:])
+	}
+	if own {
+		delete(f.written, path)
+	}
+
+	return own
+
+}
+
+// setWatching starts or stops remembering the store's own changes
+func (f *FileStore) setWatching(watching bool) {
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.watching = watching
+	f.written = map[string]*writtenFile{}
+
+}
+
+// removeEmptyDirs removes empty namespace directories left behind by a
+// rename or delete
+func (f *FileStore) removeEmptyDirs(dir string) {
+	for dir != f.dir && strings.HasPrefix(dir, f.dir) {
+		if os.Remove(dir) != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+// readPage reads a page file, returning nil if it doesn't exist. If the file
+// was changed after the modification time in its front matter (someone edited
+// it by hand), the file's own time is used.
+func readPage(path string) (*page.Page, error) {
+
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := page.ParseMarkdown(b)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.ModTime().After(p.Metadata.Modified.Add(time.Second)) {
+		p.Metadata.Modified = info.ModTime()
+	}
+
+	return p, nil
+
+}
@@ -0,0 +1,179 @@
+package filestore
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/idrum4316/devpad-server/internal/page"
+	"github.com/idrum4316/devpad-server/internal/storage"
+	"github.com/idrum4316/devpad-server/internal/storage/storagetest"
+)
+
+func TestConformance(t *testing.T) {
+	storagetest.TestPageStore(t, func(t *testing.T) storage.PageStore {
+		s, err := New(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	})
+}
+
+func TestSnapshotTo(t *testing.T) {
+
+	s, err := New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := page.New()
+	p.Contents = "deploying"
+	err = s.UpdatePage(p, "ops:deploy")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Neither hidden folders nor temporary files are pages
+	for _, name := range []string{".git/config", "ops/.tmp-123", "notes.txt"} {
+		path := filepath.Join(s.Dir(), filepath.FromSlash(name))
+		err = os.MkdirAll(filepath.Dir(path), 0700)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(path, []byte("x"), 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dir := t.TempDir()
+	called := false
+	err = s.SnapshotTo(dir, func() error {
+		called = true
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !called {
+		t.Error("with wasn't called")
+	}
+
+	copied := []string{}
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			rel, _ := filepath.Rel(dir, path)
+			copied = append(copied, filepath.ToSlash(rel))
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(copied) != 1 || copied[0] != "ops/deploy.md" {
+		t.Fatalf("expected only ops/deploy.md to be copied, got %v", copied)
+	}
+
+	got, err := readPage(filepath.Join(dir, "ops", "deploy.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got == nil || got.Contents != "deploying" {
+		t.Errorf("expected the page to be copied, got %+v", got)
+	}
+
+}
+
+func TestWatchForgetsOwnChanges(t *testing.T) {
+
+	s, err := New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changed := make(chan string, 10)
+	w, err := s.Watch(func(id string, p *page.Page) {
+		changed <- id
+	}, func(err error) {
+		t.Error(err)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	p := page.New()
+	p.Contents = "deploying"
+	err = s.UpdatePage(p, "ops:deploy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.UpdatePage(p, "old")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.RenamePage("old", "new")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.DeletePage("new")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Changes made by something else are still reported
+	err = ioutil.WriteFile(filepath.Join(s.Dir(), "external"+Extension), []byte("edited"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case id := <-changed:
+		if id != "external" {
+			t.Errorf("expected only external to be reported, got %s", id)
+		}
+	case <-time.After(10 * settleTime):
+		t.Fatal("the external change wasn't reported")
+	}
+
+	// Give the store's own changes time to settle too
+	time.Sleep(2 * settleTime)
+
+	s.mu.Lock()
+	for path := range s.written {
+		if id, _ := s.idFor(path); id != "external" {
+			t.Errorf("%s is still remembered", id)
+		}
+	}
+	s.mu.Unlock()
+
+	select {
+	case id := <-changed:
+		t.Errorf("%s was reported", id)
+	default:
+	}
+
+}
+
+func TestOnlyRemembersWhileWatching(t *testing.T) {
+
+	s, err := New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.UpdatePage(page.New(), "deploy")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.mu.Lock()
+	n := len(s.written)
+	s.mu.Unlock()
+	if n != 0 {
+		t.Errorf("expected nothing to be remembered, got %d files", n)
+	}
+
+}
@@ -0,0 +1,227 @@
+package filestore
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/idrum4316/devpad-server/internal/page"
+)
+
+// settleTime is how long a file has to stay unchanged before a change is
+// reported. Editors often write a file in several steps.
+const settleTime = 500 * time.Millisecond
+
+// ChangeFunc is called when a page file is changed outside of the store. p is
+// nil if the page was removed.
+type ChangeFunc func(id string, p *page.Page)
+
+// Watcher reports changes that are made to the page files by anything other
+// than the store, such as a text editor.
+type Watcher struct {
+	store    *FileStore
+	watcher  *fsnotify.Watcher
+	onChange ChangeFunc
+	onError  func(error)
+
+	mu      sync.Mutex
+	pending map[string]*time.Timer
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// Watch starts watching the store's directory (and everything below it) for
+// changes
+func (f *FileStore) Watch(onChange ChangeFunc, onError func(error)) (*Watcher, error) {
+
+	fw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	w := Watcher{
+		store:    f,
+		watcher:  fw,
+		onChange: onChange,
+		onError:  onError,
+		pending:  map[string]*time.Timer{},
+		done:     make(chan struct{}),
+	}
+
+	err = w.addTree(f.dir)
+	if err != nil {
+		fw.Close()
+		return nil, err
+	}
+	f.setWatching(true)
+
+	w.wg.Add(1)
+	go w.run()
+
+	return &w, nil
+
+}
+
+// Close stops watching for changes
+func (w *Watcher) Close() error {
+
+	close(w.done)
+	err := w.watcher.Close()
+	w.wg.Wait()
+
+	w.mu.Lock()
+	for _, t := range w.pending {
+		t.Stop()
+	}
+	w.mu.Unlock()
+
+	w.store.setWatching(false)
+
+	return err
+
+}
+
+func (w *Watcher) run() {
+
+	defer w.wg.Done()
+
+	for {
+		select {
+		case <-w.done:
+			return
+
+		case e, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			w.handle(e)
+
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			w.onError(err)
+		}
+	}
+
+}
+
+// handle looks at a single file system event
+func (w *Watcher) handle(e fsnotify.Event) {
+
+	// New namespace directories have to be watched too, along with any
+	// pages that were moved in with them.
+	if e.Op&fsnotify.Create != 0 {
+		info, err := os.Stat(e.Name)
+		if err == nil && info.IsDir() {
+			err = w.addTree(e.Name)
+			if err != nil {
+				w.onError(err)
+			}
+			_ = filepath.Walk(e.Name, func(path string, info os.FileInfo, err error) error {
+				if err == nil && !info.IsDir() {
+					w.schedule(path)
+				}
+				return nil
+			})
+			return
+		}
+	}
+
+	if _, ok := w.store.idFor(e.Name); ok {
+		w.schedule(e.Name)
+	}
+
+}
+
+// schedule reports a change once the file has settled
+func (w *Watcher) schedule(path string) {
+
+	if _, ok := w.store.idFor(path); !ok {
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if t, ok := w.pending[path]; ok {
+		t.Reset(settleTime)
+		return
+	}
+
+	w.pending[path] = time.AfterFunc(settleTime, func() {
+		w.mu.Lock()
+		delete(w.pending, path)
+		w.mu.Unlock()
+
+		select {
+		case <-w.done:
+			return
+		default:
+		}
+
+		w.report(path)
+	})
+
+}
+
+// report calls onChange for a settled file, unless the store made the change
+func (w *Watcher) report(path string) {
+
+	id, _ := w.store.idFor(path)
+
+	b, err := ioutil.ReadFile(path)
+	exists := err == nil
+	if err != nil && !os.IsNotExist(err) {
+		w.onError(err)
+		return
+	}
+
+	if w.store.isOwnChange(path, b, exists) {
+		return
+	}
+
+	// Remember this version, so an event that arrives late for the same
+	// change isn't reported twice. It's forgotten when that event comes.
+	if exists {
+		w.store.remember(path, b)
+	} else {
+		w.store.remember(path, nil)
+	}
+
+	if !exists {
+		w.onChange(id, nil)
+		return
+	}
+
+	p, err := readPage(path)
+	if err != nil {
+		w.onError(err)
+		return
+	}
+
+	w.onChange(id, p)
+
+}
+
+// addTree watches a directory and all of its subdirectories
+func (w *Watcher) addTree(root string) error {
+
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		if path != root && strings.HasPrefix(info.Name(), ".") {
+			return filepath.SkipDir
+		}
+		return w.watcher.Add(path)
+	})
+
+}
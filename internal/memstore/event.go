@@ -0,0 +1,118 @@
+package memstore
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/idrum4316/devpad-server/internal/event"
+)
+
+// AppendEvent saves an event at the end of the event log. It assigns the
+// event the next ID in the log.
+func (m *MemStore) AppendEvent(e *event.Event) error {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e.ID = m.trimmedEvents + uint64(len(m.events)) + 1
+
+	eventBytes, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	m.events = append(m.events, eventBytes)
+	return nil
+
+}
+
+// EventsSince returns up to <limit> events with an ID greater than <id>, in
+// the order they happened.
+func (m *MemStore) EventsSince(id uint64, limit int) ([]*event.Event, error) {
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	// Events with an ID greater than <id> start here
+	start := uint64(0)
+	if id > m.trimmedEvents {
+		start = id - m.trimmedEvents
+	}
+
+	events := []*event.Event{}
+	for i := start; i < uint64(len(m.events)) && len(events) < limit; i++ {
+		e := event.Event{}
+		err := json.Unmarshal(m.events[i], &e)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, &e)
+	}
+
+	return events, nil
+
+}
+
+// EventsBefore returns up to <limit> events with an ID less than <id> that
+// match the filter, newest first. An <id> of 0 starts at the newest event.
+// The filter can end the scan early by returning stop.
+func (m *MemStore) EventsBefore(id uint64, limit int,
+	match func(e *event.Event) (include bool, stop bool)) ([]*event.Event, error) {
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	start := uint64(len(m.events))
+	if id != 0 {
+		if id <= m.trimmedEvents {
+			return []*event.Event{}, nil
+		}
+		if id-1-m.trimmedEvents < start {
+			start = id - 1 - m.trimmedEvents
+		}
+	}
+
+	events := []*event.Event{}
+	for i := start; i > 0 && len(events) < limit; i-- {
+		e := event.Event{}
+		err := json.Unmarshal(m.events[i-1], &e)
+		if err != nil {
+			return nil, err
+		}
+
+		include, stop := match(&e)
+		if stop {
+			break
+		}
+		if include {
+			events = append(events, &e)
+		}
+	}
+
+	return events, nil
+
+}
+
+// TrimEvents deletes the events that happened before <before>
+func (m *MemStore) TrimEvents(before time.Time) error {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n := 0
+	for ; n < len(m.events); n++ {
+		e := event.Event{}
+		err := json.Unmarshal(m.events[n], &e)
+		if err != nil {
+			return err
+		}
+		if !e.Timestamp.Before(before) {
+			break
+		}
+	}
+
+	m.events = append([][]byte{}, m.events[n:]...)
+	m.trimmedEvents += uint64(n)
+	return nil
+
+}
@@ -0,0 +1,68 @@
+package memstore
+
+import (
+	"sync"
+
+	"github.com/idrum4316/devpad-server/internal/storage"
+)
+
+// MemStore keeps pages, users and everything else in memory. Nothing is
+// saved, so it's meant for tests and throwaway servers. Values are kept
+// encoded as JSON, like the bolt Datastore does, so callers never share
+// memory with the store.
+type MemStore struct {
+	mu sync.RWMutex
+
+	pages map[string][]byte
+	users map[string][]byte
+
+	// Pages waiting to be indexed, by job sequence number
+	outbox    map[uint64]string
+	outboxSeq uint64
+
+	// User IDs by the hash of their feed token
+	feedTokens map[string]string
+
+	webhooks    map[string][]byte
+	deliveries  map[string]map[uint64][]byte
+	queue       map[uint64]string
+	deliverySeq uint64
+
+	// Trimmed events are dropped from the front, so an event's ID is its
+	// index plus the number trimmed, plus one
+	events        [][]byte
+	trimmedEvents uint64
+
+	savedSearches   map[string][]byte
+	notifications   map[uint64][]byte
+	notificationSeq uint64
+}
+
+// Make sure MemStore implements everything it should
+var (
+	_ storage.Store       = (*MemStore)(nil)
+	_ storage.PageBatcher = (*MemStore)(nil)
+	_ storage.Outbox      = (*MemStore)(nil)
+)
+
+// New returns a new, empty MemStore
+func New() *MemStore {
+	return &MemStore{
+		pages:      map[string][]byte{},
+		outbox:     map[uint64]string{},
+		users:      map[string][]byte{},
+		feedTokens: map[string]string{},
+		webhooks:   map[string][]byte{},
+		deliveries: map[string]map[uint64][]byte{},
+		queue:      map[uint64]string{},
+		events:     [][]byte{},
+
+		savedSearches: map[string][]byte{},
+		notifications: map[uint64][]byte{},
+	}
+}
+
+// Close does nothing. It's here so MemStore can be used in place of the bolt
+// Datastore.
+func (m *MemStore) Close() {
+}
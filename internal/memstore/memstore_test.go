@@ -0,0 +1,20 @@
+package memstore
+
+import (
+	"testing"
+
+	"github.com/idrum4316/devpad-server/internal/storage"
+	"github.com/idrum4316/devpad-server/internal/storage/storagetest"
+)
+
+func TestConformance(t *testing.T) {
+	storagetest.TestPageStore(t, func(t *testing.T) storage.PageStore {
+		return New()
+	})
+	storagetest.TestUserStore(t, func(t *testing.T) storage.UserStore {
+		return New()
+	})
+	storagetest.TestMetaStore(t, func(t *testing.T) storage.MetaStore {
+		return New()
+	})
+}
@@ -0,0 +1,66 @@
+package memstore
+
+import (
+	"sort"
+
+	"github.com/idrum4316/devpad-server/internal/storage"
+)
+
+// enqueueIndexJobs queues the pages to be indexed again. The store must be
+// locked for writing.
+func (m *MemStore) enqueueIndexJobs(ids ...string) {
+	for _, id := range ids {
+		m.outboxSeq++
+		m.outbox[m.outboxSeq] = id
+	}
+}
+
+// PendingIndexJobs returns up to <limit> of the oldest queued index jobs
+func (m *MemStore) PendingIndexJobs(limit int) ([]*storage.Job, error) {
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	seqs := []uint64{}
+	for seq := range m.outbox {
+		seqs = append(seqs, seq)
+	}
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+
+	jobs := []*storage.Job{}
+	for _, seq := range seqs {
+		if len(jobs) >= limit {
+			break
+		}
+		jobs = append(jobs, &storage.Job{
+			Seq:    seq,
+			PageID: m.outbox[seq],
+		})
+	}
+
+	return jobs, nil
+
+}
+
+// CompleteIndexJobs removes index jobs from the queue once they're applied
+func (m *MemStore) CompleteIndexJobs(jobs []*storage.Job) error {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, job := range jobs {
+		delete(m.outbox, job.Seq)
+	}
+	return nil
+
+}
+
+// CountIndexJobs returns how many index jobs are queued
+func (m *MemStore) CountIndexJobs() (int, error) {
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return len(m.outbox), nil
+
+}
@@ -0,0 +1,229 @@
+package memstore
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/idrum4316/devpad-server/internal/page"
+	"github.com/idrum4316/devpad-server/internal/storage"
+)
+
+// UpdatePage updates a page in the store
+func (m *MemStore) UpdatePage(p *page.Page, pageID string) error {
+
+	p.Metadata.Modified = time.Now()
+
+	pageBytes, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.pages[pageID] = pageBytes
+	m.enqueueIndexJobs(pageID)
+	return nil
+
+}
+
+// UpdatePageIf updates a page in the store if check accepts the page that's
+// there
+func (m *MemStore) UpdatePageIf(p *page.Page, pageID string,
+	check func(current *page.Page) error) (*page.Page, error) {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var current *page.Page
+	if v, ok := m.pages[pageID]; ok {
+		current = &page.Page{}
+		err := json.Unmarshal(v, current)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err := check(current)
+	if err != nil {
+		return nil, err
+	}
+
+	p.Metadata.Modified = time.Now()
+	pageBytes, err := json.Marshal(p)
+	if err != nil {
+		return nil, err
+	}
+
+	saved := page.Page{}
+	err = json.Unmarshal(pageBytes, &saved)
+	if err != nil {
+		return nil, err
+	}
+
+	m.pages[pageID] = pageBytes
+	m.enqueueIndexJobs(pageID)
+	return &saved, nil
+
+}
+
+// PutPages writes pages as they are, keeping their modification times
+func (m *MemStore) PutPages(pages map[string]*page.Page) error {
+
+	encoded := map[string][]byte{}
+	for id, p := range pages {
+		pageBytes, err := json.Marshal(p)
+		if err != nil {
+			return err
+		}
+		encoded[id] = pageBytes
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id, pageBytes := range encoded {
+		m.pages[id] = pageBytes
+		m.enqueueIndexJobs(id)
+	}
+	return nil
+
+}
+
+// RenamePage moves a page to a new id
+func (m *MemStore) RenamePage(oldID string, newID string) error {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.pages[newID]; ok {
+		return fmt.Errorf("page %s already exists", newID)
+	}
+
+	pageBytes, ok := m.pages[oldID]
+	if !ok {
+		return fmt.Errorf("could not find page %s", oldID)
+	}
+
+	m.pages[newID] = pageBytes
+	delete(m.pages, oldID)
+	m.enqueueIndexJobs(oldID, newID)
+	return nil
+
+}
+
+// ApplyPageOps makes a batch of page changes at once. If one of them fails,
+// none of them are made.
+func (m *MemStore) ApplyPageOps(ops []*storage.PageOp) error {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Changes are made to a copy, which replaces the pages once they all
+	// succeed
+	pages := make(map[string][]byte, len(m.pages))
+	for id, pageBytes := range m.pages {
+		pages[id] = pageBytes
+	}
+	changed := []string{}
+
+	for _, op := range ops {
+		switch op.Type {
+		case storage.OpPut:
+			pageBytes, err := json.Marshal(op.Page)
+			if err != nil {
+				return err
+			}
+			pages[op.ID] = pageBytes
+			changed = append(changed, op.ID)
+		case storage.OpDelete:
+			delete(pages, op.ID)
+			changed = append(changed, op.ID)
+		case storage.OpRename:
+			if _, ok := pages[op.NewID]; ok {
+				return fmt.Errorf("page %s already exists", op.NewID)
+			}
+			pageBytes, ok := pages[op.ID]
+			if !ok {
+				return fmt.Errorf("could not find page %s", op.ID)
+			}
+			pages[op.NewID] = pageBytes
+			delete(pages, op.ID)
+			changed = append(changed, op.ID, op.NewID)
+		default:
+			return fmt.Errorf("unknown page operation %q", op.Type)
+		}
+	}
+
+	m.pages = pages
+	m.enqueueIndexJobs(changed...)
+	return nil
+
+}
+
+// DeletePage deletes a page from the store
+func (m *MemStore) DeletePage(id string) error {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.pages, id)
+	m.enqueueIndexJobs(id)
+	return nil
+
+}
+
+// GetPage returns a page from the store
+func (m *MemStore) GetPage(id string) (*page.Page, error) {
+
+	m.mu.RLock()
+	pageBytes, ok := m.pages[id]
+	m.mu.RUnlock()
+
+	if !ok {
+		return nil, nil
+	}
+
+	p := page.Page{}
+	err := json.Unmarshal(pageBytes, &p)
+	if err != nil {
+		return nil, err
+	}
+
+	return &p, nil
+
+}
+
+// ForEachPage calls fn for every page in the store, in id order. If fn
+// returns an error, iteration stops and the error is returned.
+func (m *MemStore) ForEachPage(fn func(id string, p *page.Page) error) error {
+
+	// Copy the pages first, so fn is free to modify the store
+	m.mu.RLock()
+	ids := make([]string, 0, len(m.pages))
+	pages := map[string][]byte{}
+	for id, pageBytes := range m.pages {
+		ids = append(ids, id)
+		pages[id] = pageBytes
+	}
+	m.mu.RUnlock()
+
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		p := page.Page{}
+		err := json.Unmarshal(pages[id], &p)
+		if err != nil {
+			return err
+		}
+
+		err = fn(id, &p)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+
+}
@@ -0,0 +1,221 @@
+package memstore
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/idrum4316/devpad-server/internal/savedsearch"
+)
+
+// ListSavedSearches returns the saved searches of a user, or everyone's if
+// owner is "", in id order
+func (m *MemStore) ListSavedSearches(owner string) ([]*savedsearch.SavedSearch, error) {
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	ids := []string{}
+	for id := range m.savedSearches {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	searches := []*savedsearch.SavedSearch{}
+	for _, id := range ids {
+		s := savedsearch.SavedSearch{}
+		err := json.Unmarshal(m.savedSearches[id], &s)
+		if err != nil {
+			return nil, err
+		}
+		if owner == "" || s.Owner == owner {
+			searches = append(searches, &s)
+		}
+	}
+
+	return searches, nil
+
+}
+
+// GetSavedSearch returns a saved search, or nil if it doesn't exist
+func (m *MemStore) GetSavedSearch(id string) (*savedsearch.SavedSearch, error) {
+
+	m.mu.RLock()
+	searchBytes, ok := m.savedSearches[id]
+	m.mu.RUnlock()
+
+	if !ok {
+		return nil, nil
+	}
+
+	s := savedsearch.SavedSearch{}
+	err := json.Unmarshal(searchBytes, &s)
+	if err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+
+}
+
+// PutSavedSearch creates or replaces a saved search
+func (m *MemStore) PutSavedSearch(s *savedsearch.SavedSearch) error {
+
+	searchBytes, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.savedSearches[s.ID] = searchBytes
+	return nil
+
+}
+
+// UpdateSavedSearch changes a saved search with update, under the store's
+// lock, and returns it as it was saved. Nothing is saved, and nil is
+// returned, if the search doesn't exist.
+func (m *MemStore) UpdateSavedSearch(id string,
+	update func(s *savedsearch.SavedSearch)) (*savedsearch.SavedSearch, error) {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	searchBytes, ok := m.savedSearches[id]
+	if !ok {
+		return nil, nil
+	}
+
+	s := savedsearch.SavedSearch{}
+	err := json.Unmarshal(searchBytes, &s)
+	if err != nil {
+		return nil, err
+	}
+	update(&s)
+	s.ID = id
+
+	searchBytes, err = json.Marshal(&s)
+	if err != nil {
+		return nil, err
+	}
+	m.savedSearches[id] = searchBytes
+
+	return &s, nil
+
+}
+
+// DeleteSavedSearch deletes a saved search. The notifications already sent
+// for it are kept.
+func (m *MemStore) DeleteSavedSearch(id string) error {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.savedSearches, id)
+	return nil
+
+}
+
+// RecordMatches sets when a saved search was last checked and saves the
+// notifications for what matched, assigning each of them an ID
+func (m *MemStore) RecordMatches(searchID string, checked time.Time,
+	notes []*savedsearch.Notification) error {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	searchBytes, ok := m.savedSearches[searchID]
+	if !ok {
+		return nil
+	}
+
+	s := savedsearch.SavedSearch{}
+	err := json.Unmarshal(searchBytes, &s)
+	if err != nil {
+		return err
+	}
+	s.Checked = checked
+
+	searchBytes, err = json.Marshal(&s)
+	if err != nil {
+		return err
+	}
+
+	// Encode everything before changing anything, so a failure leaves the
+	// store as it was
+	encoded := [][]byte{}
+	for i, n := range notes {
+		n.ID = m.notificationSeq + uint64(i) + 1
+		noteBytes, err := json.Marshal(n)
+		if err != nil {
+			return err
+		}
+		encoded = append(encoded, noteBytes)
+	}
+
+	m.savedSearches[searchID] = searchBytes
+	for i, noteBytes := range encoded {
+		m.notifications[notes[i].ID] = noteBytes
+	}
+	m.notificationSeq += uint64(len(notes))
+
+	return nil
+
+}
+
+// ListNotifications returns up to <limit> of a user's notifications, newest
+// first
+func (m *MemStore) ListNotifications(owner string, limit int) ([]*savedsearch.Notification, error) {
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	ids := []uint64{}
+	for id := range m.notifications {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] > ids[j] })
+
+	notes := []*savedsearch.Notification{}
+	for _, id := range ids {
+		if len(notes) >= limit {
+			break
+		}
+
+		n := savedsearch.Notification{}
+		err := json.Unmarshal(m.notifications[id], &n)
+		if err != nil {
+			return nil, err
+		}
+
+		if n.Owner == owner {
+			notes = append(notes, &n)
+		}
+	}
+
+	return notes, nil
+
+}
+
+// DeleteNotifications deletes all of a user's notifications
+func (m *MemStore) DeleteNotifications(owner string) error {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id, noteBytes := range m.notifications {
+		n := savedsearch.Notification{}
+		err := json.Unmarshal(noteBytes, &n)
+		if err != nil {
+			return err
+		}
+		if n.Owner == owner {
+			delete(m.notifications, id)
+		}
+	}
+
+	return nil
+
+}
@@ -0,0 +1,197 @@
+package memstore
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"sort"
+
+	"github.com/idrum4316/devpad-server/internal/user"
+)
+
+// CountUsers returns the number of users in the store
+func (m *MemStore) CountUsers() (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.users), nil
+}
+
+// UserExists returns a false if the user doesn't exist in the store
+func (m *MemStore) UserExists(id string) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	_, ok := m.users[id]
+	return ok, nil
+}
+
+// CreateUser creates a new user in the store
+func (m *MemStore) CreateUser(u *user.User) error {
+
+	userBytes, err := json.Marshal(u)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[u.ID]; ok {
+		return errors.New("user already exists")
+	}
+
+	return m.putUser(u, userBytes)
+
+}
+
+// UpdateUser updates a user in the store
+func (m *MemStore) UpdateUser(u *user.User) error {
+
+	userBytes, err := json.Marshal(u)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[u.ID]; !ok {
+		return errors.New("user does not exist")
+	}
+
+	return m.putUser(u, userBytes)
+
+}
+
+// DeleteUser deletes a user from the store
+func (m *MemStore) DeleteUser(id string) error {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	err := m.unindexFeedToken(id)
+	if err != nil {
+		return err
+	}
+
+	delete(m.users, id)
+	return nil
+
+}
+
+// GetUser returns a user from the store
+func (m *MemStore) GetUser(id string) (*user.User, error) {
+
+	m.mu.RLock()
+	userBytes, ok := m.users[id]
+	m.mu.RUnlock()
+
+	if !ok {
+		return nil, nil
+	}
+
+	u := user.User{}
+	err := json.Unmarshal(userBytes, &u)
+	if err != nil {
+		return nil, err
+	}
+
+	return &u, nil
+
+}
+
+// GetUserByFeedToken returns the user a feed token belongs to, or nil if the
+// token isn't valid
+func (m *MemStore) GetUserByFeedToken(token string) (*user.User, error) {
+
+	hash := user.HashFeedToken(token)
+
+	m.mu.RLock()
+	userBytes, ok := m.users[m.feedTokens[string(hash)]]
+	m.mu.RUnlock()
+
+	if !ok {
+		return nil, nil
+	}
+
+	u := user.User{}
+	err := json.Unmarshal(userBytes, &u)
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare(u.FeedToken, hash) != 1 {
+		return nil, nil
+	}
+
+	return &u, nil
+
+}
+
+// putUser saves a user and indexes its feed token. The caller must hold the
+// lock.
+func (m *MemStore) putUser(u *user.User, userBytes []byte) error {
+
+	err := m.unindexFeedToken(u.ID)
+	if err != nil {
+		return err
+	}
+
+	if len(u.FeedToken) > 0 {
+		m.feedTokens[string(u.FeedToken)] = u.ID
+	}
+	m.users[u.ID] = userBytes
+	return nil
+
+}
+
+// unindexFeedToken removes a user's current feed token from the index. The
+// caller must hold the lock.
+func (m *MemStore) unindexFeedToken(id string) error {
+
+	userBytes, ok := m.users[id]
+	if !ok {
+		return nil
+	}
+
+	old := user.User{}
+	err := json.Unmarshal(userBytes, &old)
+	if err != nil {
+		return err
+	}
+
+	delete(m.feedTokens, string(old.FeedToken))
+	return nil
+
+}
+
+// ForEachUser calls fn for every user in the store, in id order. If fn
+// returns an error, iteration stops and the error is returned.
+func (m *MemStore) ForEachUser(fn func(u *user.User) error) error {
+
+	// Copy the users first, so fn is free to modify the store
+	m.mu.RLock()
+	ids := make([]string, 0, len(m.users))
+	users := map[string][]byte{}
+	for id, userBytes := range m.users {
+		ids = append(ids, id)
+		users[id] = userBytes
+	}
+	m.mu.RUnlock()
+
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		u := user.User{}
+		err := json.Unmarshal(users[id], &u)
+		if err != nil {
+			return err
+		}
+
+		err = fn(&u)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+
+}
@@ -0,0 +1,264 @@
+package memstore
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/idrum4316/devpad-server/internal/webhook"
+)
+
+// CreateWebhook saves a new webhook in the store
+func (m *MemStore) CreateWebhook(w *webhook.Webhook) error {
+
+	hookBytes, err := json.Marshal(w)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.webhooks[w.ID]; ok {
+		return errors.New("webhook already exists")
+	}
+
+	m.webhooks[w.ID] = hookBytes
+	return nil
+
+}
+
+// GetWebhook returns a webhook from the store, or nil if it doesn't exist
+func (m *MemStore) GetWebhook(id string) (*webhook.Webhook, error) {
+
+	m.mu.RLock()
+	hookBytes, ok := m.webhooks[id]
+	m.mu.RUnlock()
+
+	if !ok {
+		return nil, nil
+	}
+
+	w := webhook.Webhook{}
+	err := json.Unmarshal(hookBytes, &w)
+	if err != nil {
+		return nil, err
+	}
+
+	return &w, nil
+
+}
+
+// ListWebhooks returns every webhook in the store, in id order
+func (m *MemStore) ListWebhooks() ([]*webhook.Webhook, error) {
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	ids := []string{}
+	for id := range m.webhooks {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	hooks := []*webhook.Webhook{}
+	for _, id := range ids {
+		w := webhook.Webhook{}
+		err := json.Unmarshal(m.webhooks[id], &w)
+		if err != nil {
+			return nil, err
+		}
+		hooks = append(hooks, &w)
+	}
+
+	return hooks, nil
+
+}
+
+// DeleteWebhook deletes a webhook from the store, along with its
+// deliveries. Any that were still queued are never attempted.
+func (m *MemStore) DeleteWebhook(id string) error {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.webhooks, id)
+	for delID := range m.deliveries[id] {
+		delete(m.queue, delID)
+	}
+	delete(m.deliveries, id)
+	return nil
+
+}
+
+// EnqueueDeliveries saves new deliveries and adds them to the retry queue. It
+// assigns an ID to each of them.
+func (m *MemStore) EnqueueDeliveries(deliveries []*webhook.Delivery) error {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, del := range deliveries {
+		m.deliverySeq++
+		del.ID = m.deliverySeq
+
+		delBytes, err := json.Marshal(del)
+		if err != nil {
+			return err
+		}
+
+		if m.deliveries[del.WebhookID] == nil {
+			m.deliveries[del.WebhookID] = map[uint64][]byte{}
+		}
+		m.deliveries[del.WebhookID][del.ID] = delBytes
+		m.queue[del.ID] = del.WebhookID
+	}
+
+	return nil
+
+}
+
+// DueDeliveries returns up to <limit> queued deliveries whose next attempt is
+// at or before <now>, oldest first.
+func (m *MemStore) DueDeliveries(now time.Time, limit int) ([]*webhook.Delivery, error) {
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	ids := []uint64{}
+	for id := range m.queue {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	due := []*webhook.Delivery{}
+	for _, id := range ids {
+		if len(due) >= limit {
+			break
+		}
+
+		delBytes, ok := m.deliveries[m.queue[id]][id]
+		if !ok {
+			continue
+		}
+
+		del := webhook.Delivery{}
+		err := json.Unmarshal(delBytes, &del)
+		if err != nil {
+			return nil, err
+		}
+
+		if !del.NextAttempt.After(now) {
+			due = append(due, &del)
+		}
+	}
+
+	return due, nil
+
+}
+
+// UpdateDelivery saves the delivery and removes it from the retry queue once
+// it is no longer pending. Deliveries for webhooks that have been deleted are
+// only taken off the queue.
+func (m *MemStore) UpdateDelivery(del *webhook.Delivery) error {
+
+	delBytes, err := json.Marshal(del)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	hook := m.deliveries[del.WebhookID]
+	if _, ok := hook[del.ID]; !ok {
+		delete(m.queue, del.ID)
+		return nil
+	}
+
+	hook[del.ID] = delBytes
+	if del.Status != webhook.StatusPending {
+		delete(m.queue, del.ID)
+	}
+
+	return nil
+
+}
+
+// ListDeliveries returns up to <limit> deliveries for a webhook, newest first
+func (m *MemStore) ListDeliveries(webhookID string, limit int) ([]*webhook.Delivery, error) {
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	hook := m.deliveries[webhookID]
+	deliveries := []*webhook.Delivery{}
+	for _, id := range newestFirst(hook) {
+		if len(deliveries) >= limit {
+			break
+		}
+
+		del := webhook.Delivery{}
+		err := json.Unmarshal(hook[id], &del)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, &del)
+	}
+
+	return deliveries, nil
+
+}
+
+// PruneDeliveries deletes the finished deliveries of every webhook that were
+// last updated before <before>, and all but the newest <keep> of the rest.
+// Pending deliveries are left alone, unless what they were queued for is
+// gone.
+func (m *MemStore) PruneDeliveries(before time.Time, keep int) error {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id, hookID := range m.queue {
+		if _, ok := m.deliveries[hookID][id]; !ok {
+			delete(m.queue, id)
+		}
+	}
+
+	for _, hook := range m.deliveries {
+		finished := 0
+		for _, id := range newestFirst(hook) {
+			if _, ok := m.queue[id]; ok {
+				continue
+			}
+
+			del := webhook.Delivery{}
+			err := json.Unmarshal(hook[id], &del)
+			if err != nil {
+				return err
+			}
+
+			finished++
+			if finished > keep || del.Updated.Before(before) {
+				delete(hook, id)
+			}
+		}
+	}
+
+	return nil
+
+}
+
+// newestFirst returns the IDs of a webhook's deliveries, newest first
+func newestFirst(hook map[uint64][]byte) []uint64 {
+
+	ids := []uint64{}
+	for id := range hook {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] > ids[j] })
+
+	return ids
+
+}
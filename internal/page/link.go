@@ -0,0 +1,60 @@
+package page
+
+import (
+	"net/url"
+	"path"
+	"strings"
+)
+
+// LinkTargets returns the slugs a link on the page 'from' could be pointing
+// to, most likely first, and the fragment of the link (including the '#').
+// A page can be linked to by its slug ("ops:deploy"), its API path
+// ("/api/pages/ops:deploy") or its Markdown file (../ops/deploy.md, as in an
+// imported folder of docs). Links to other sites have no targets.
+func LinkTargets(dest string, from string) ([]string, string) {
+
+	target, fragment := dest, ""
+	if i := strings.Index(dest, "#"); i >= 0 {
+		target, fragment = dest[:i], dest[i:]
+	}
+	if target == "" {
+		return nil, fragment
+	}
+
+	targets := []string{}
+
+	// A slug on its own would parse as a URL scheme, so it's tried first
+	if unescaped, err := url.PathUnescape(target); err == nil {
+		targets = append(targets, unescaped)
+	}
+
+	u, err := url.Parse(target)
+	if err != nil || u.Scheme != "" || u.Host != "" {
+		return targets, fragment
+	}
+
+	p := u.Path
+	if strings.HasPrefix(p, "/") {
+		p = strings.TrimPrefix(strings.TrimPrefix(p, "/"), "api/pages/")
+		targets = append(targets, p)
+	} else {
+		// Relative to the folder the page would be in as a file
+		dir := ""
+		if i := strings.LastIndex(from, ":"); i >= 0 {
+			dir = strings.Replace(from[:i], ":", "/", -1)
+		}
+		p = path.Join(dir, p)
+	}
+
+	ext := path.Ext(p)
+	switch ext {
+	case ".md", ".markdown", ".html":
+		p = strings.TrimSuffix(p, ext)
+	}
+	if !strings.HasPrefix(p, "../") {
+		targets = append(targets, strings.Replace(p, "/", ":", -1))
+	}
+
+	return targets, fragment
+
+}
@@ -0,0 +1,118 @@
+package page
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// frontMatterDelimiter starts and ends the TOML front matter of a Markdown
+// file
+const frontMatterDelimiter = "+++"
+
+// frontMatter is the metadata that is written at the top of a Markdown file
+type frontMatter struct {
+	Title    string    `toml:"title"`
+	Tags     []string  `toml:"tags"`
+	Language string    `toml:"language,omitempty"`
+	Modified time.Time `toml:"modified"`
+}
+
+// MarshalMarkdown returns the page as a Markdown file, with its metadata in
+// TOML front matter
+func (p *Page) MarshalMarkdown() ([]byte, error) {
+
+	fm := frontMatter{
+		Title:    p.Metadata.Title,
+		Tags:     p.Metadata.Tags,
+		Language: p.Metadata.Language,
+		Modified: p.Metadata.Modified.UTC(),
+	}
+	if fm.Tags == nil {
+		fm.Tags = []string{}
+	}
+
+	buf := bytes.Buffer{}
+	buf.WriteString(frontMatterDelimiter + "\n")
+	err := toml.NewEncoder(&buf).Encode(fm)
+	if err != nil {
+		return nil, err
+	}
+	buf.WriteString(frontMatterDelimiter + "\n")
+	buf.WriteString(p.Contents)
+
+	return buf.Bytes(), nil
+
+}
+
+// ParseMarkdown reads a Markdown file. The TOML front matter is optional, a
+// file without it becomes a page with no metadata.
+func ParseMarkdown(b []byte) (*Page, error) {
+
+	p := New()
+
+	meta, contents, ok := splitFrontMatter(b)
+	if !ok {
+		p.Contents = string(b)
+		return p, nil
+	}
+
+	fm := frontMatter{}
+	_, err := toml.Decode(string(meta), &fm)
+	if err != nil {
+		return nil, err
+	}
+
+	p.Contents = string(contents)
+	p.Metadata.Title = fm.Title
+	p.Metadata.Language = fm.Language
+	p.Metadata.Modified = fm.Modified
+	if fm.Tags != nil {
+		p.Metadata.Tags = fm.Tags
+	}
+
+	return p, nil
+
+}
+
+// HasFrontMatter returns true if a Markdown file starts with TOML front matter
+func HasFrontMatter(b []byte) bool {
+	_, _, ok := splitFrontMatter(b)
+	return ok
+}
+
+// splitFrontMatter separates the front matter from the rest of the file
+func splitFrontMatter(b []byte) ([]byte, []byte, bool) {
+
+	// Byte order marks and Windows line endings are common enough in hand
+	// edited files
+	b = bytes.TrimPrefix(b, []byte("\xef\xbb\xbf"))
+	start := []byte(frontMatterDelimiter + "\n")
+	if bytes.HasPrefix(b, []byte(frontMatterDelimiter+"\r\n")) {
+		start = []byte(frontMatterDelimiter + "\r\n")
+	}
+	if !bytes.HasPrefix(b, start) {
+		return nil, nil, false
+	}
+	rest := b[len(start):]
+
+	// Find the closing delimiter at the start of a line
+	offset := 0
+	for {
+		i := bytes.Index(rest[offset:], []byte(frontMatterDelimiter))
+		if i < 0 {
+			return nil, nil, false
+		}
+		i += offset
+		if i == 0 || rest[i-1] == '\n' {
+			meta := rest[:i]
+			contents := rest[i+len(frontMatterDelimiter):]
+			contents = bytes.TrimPrefix(contents, []byte("\r"))
+			contents = bytes.TrimPrefix(contents, []byte("\n"))
+			return meta, contents, true
+		}
+		offset = i + len(frontMatterDelimiter)
+	}
+
+}
@@ -10,10 +10,12 @@ type Page struct {
 	Metadata Metadata `json:"metadata"`
 }
 
-// Metadata contains the metadata for the page
+// Metadata contains the metadata for the page. Language is a tag like "de"
+// or "pt-BR", and empty for pages in English.
 type Metadata struct {
 	Title    string    `json:"title"`
 	Tags     []string  `json:"tags"`
+	Language string    `json:"language,omitempty"`
 	Modified time.Time `json:"modified"`
 }
 
@@ -0,0 +1,86 @@
+package render
+
+import (
+	"io"
+
+	"github.com/Depado/bfchroma"
+	"github.com/alecthomas/chroma/formatters/html"
+	"github.com/alecthomas/chroma/styles"
+	"github.com/microcosm-cc/bluemonday"
+	bf "gopkg.in/russross/blackfriday.v2"
+)
+
+// The chroma style code blocks are highlighted with
+const chromaStyle = "tango"
+
+// Options change how Markdown is rendered
+type Options struct {
+	// Add a table of contents made from the headings
+	TOC bool
+
+	// Sanitize the HTML. Code blocks aren't highlighted when it's set.
+	Sanitize bool
+
+	// Highlight code with CSS classes instead of inline styles. The classes
+	// are defined by the stylesheet from WriteCSS.
+	Classes bool
+
+	// If set, the destination of every link is replaced with what it returns
+	Link func(dest string) string
+}
+
+// Markdown renders Markdown to HTML
+func Markdown(md []byte, opts Options) []byte {
+
+	renderer := bf.NewHTMLRenderer(bf.HTMLRendererParameters{
+		Flags: bf.CommonHTMLFlags,
+	})
+
+	if opts.TOC {
+		renderer.Flags |= bf.TOC
+	}
+
+	var r bf.Renderer = renderer
+	if !opts.Sanitize {
+		chromaOpts := []bfchroma.Option{
+			bfchroma.Extend(renderer),
+			bfchroma.WithoutAutodetect(),
+			bfchroma.Style(chromaStyle),
+		}
+		if opts.Classes {
+			chromaOpts = append(chromaOpts, bfchroma.ChromaOptions(html.WithClasses()))
+		}
+		r = bfchroma.NewRenderer(chromaOpts...)
+	}
+
+	if opts.Link != nil {
+		r = &linkRenderer{Renderer: r, link: opts.Link}
+	}
+
+	out := bf.Run(md, bf.WithRenderer(r))
+	if opts.Sanitize {
+		out = bluemonday.UGCPolicy().SanitizeBytes(out)
+	}
+
+	return out
+
+}
+
+// WriteCSS writes the stylesheet for code highlighted with CSS classes
+func WriteCSS(w io.Writer) error {
+	return html.New(html.WithClasses()).WriteCSS(w, styles.Get(chromaStyle))
+}
+
+// linkRenderer rewrites link destinations before they're rendered
+type linkRenderer struct {
+	bf.Renderer
+	link func(dest string) string
+}
+
+// RenderNode rewrites the destination of links, then renders the node
+func (r *linkRenderer) RenderNode(w io.Writer, node *bf.Node, entering bool) bf.WalkStatus {
+	if entering && node.Type == bf.Link {
+		node.LinkData.Destination = []byte(r.link(string(node.LinkData.Destination)))
+	}
+	return r.Renderer.RenderNode(w, node, entering)
+}
@@ -0,0 +1,216 @@
+package savedsearch
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// Store is the persistent storage for saved searches and the notifications
+// sent for them. Owner "" lists every user's saved searches. UpdateSavedSearch
+// changes a stored search with update in one go, so it doesn't undo a
+// RecordMatches made meanwhile, and returns nil if the search doesn't exist.
+// RecordMatches moves a saved search's Checked time and saves its
+// notifications in one go, and does nothing if the search has been deleted.
+type Store interface {
+	ListSavedSearches(owner string) ([]*SavedSearch, error)
+	GetSavedSearch(id string) (*SavedSearch, error)
+	PutSavedSearch(s *SavedSearch) error
+	UpdateSavedSearch(id string, update func(s *SavedSearch)) (*SavedSearch, error)
+	DeleteSavedSearch(id string) error
+	RecordMatches(searchID string, checked time.Time, n []*Notification) error
+	ListNotifications(owner string, limit int) ([]*Notification, error)
+	DeleteNotifications(owner string) error
+}
+
+// Match is a page that matches a saved search
+type Match struct {
+	Slug     string
+	Title    string
+	Modified time.Time
+}
+
+// MatchFunc returns the pages that match a saved search and were changed
+// from <since> up to (but not including) <until>
+type MatchFunc func(s *SavedSearch, since time.Time, until time.Time) ([]*Match, error)
+
+// Notifier periodically runs the subscribed searches against the pages that
+// changed since they were last checked, and notifies their owners about the
+// pages that match.
+//
+// Flush, if set, is called before every check to make pending changes
+// searchable. A change can still become searchable a little after the time
+// it's recorded at, so every check also looks back Overlap before where the
+// last one ended. Pages that were already notified about (at the same
+// modification time) aren't notified about again.
+type Notifier struct {
+	Store    Store
+	Match    MatchFunc
+	Flush    func() error
+	Interval time.Duration
+	Overlap  time.Duration
+
+	// What was matched in the overlap of the last check, by search ID
+	seen map[string]map[matchKey]struct{}
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// matchKey identifies a version of a matching page
+type matchKey struct {
+	slug     string
+	modified int64
+}
+
+// NewNotifier returns a new Notifier with default values set
+func NewNotifier(s Store, match MatchFunc) *Notifier {
+	return &Notifier{
+		Store:    s,
+		Match:    match,
+		Interval: time.Minute,
+		Overlap:  time.Minute,
+		seen:     map[string]map[matchKey]struct{}{},
+	}
+}
+
+// Start checks the subscriptions in the background until Stop is called
+func (n *Notifier) Start() {
+
+	n.stop = make(chan struct{})
+	n.wg.Add(1)
+
+	go func() {
+		defer n.wg.Done()
+
+		ticker := time.NewTicker(n.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-n.stop:
+				return
+			case <-ticker.C:
+			}
+
+			_, err := n.Check()
+			if err != nil {
+				log.Println("subscriptions:", err)
+			}
+		}
+	}()
+
+}
+
+// Stop stops checking subscriptions and waits for a check in progress to
+// finish
+func (n *Notifier) Stop() {
+	if n.stop == nil {
+		return
+	}
+	close(n.stop)
+	n.wg.Wait()
+	n.stop = nil
+}
+
+// Check runs every subscribed search against the pages changed since it was
+// last checked, and returns the number of notifications that were made. A
+// search that fails is logged and skipped, and checked again next time.
+func (n *Notifier) Check() (int, error) {
+
+	// Pending changes are made searchable before the end of the window is
+	// taken, so the ones made before it aren't left out
+	if n.Flush != nil {
+		err := n.Flush()
+		if err != nil {
+			return 0, err
+		}
+	}
+	now := time.Now()
+
+	searches, err := n.Store.ListSavedSearches("")
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	failed := 0
+	seen := map[string]map[matchKey]struct{}{}
+	for _, s := range searches {
+		if !s.Subscribed {
+			continue
+		}
+
+		c, err := n.check(s, now, seen)
+		if err != nil {
+			log.Printf("subscriptions: checking %s: %s", s.ID, err)
+			if last, ok := n.seen[s.ID]; ok {
+				seen[s.ID] = last
+			}
+			failed++
+			continue
+		}
+		count += c
+	}
+	n.seen = seen
+
+	if failed > 0 {
+		return count, fmt.Errorf("%d subscribed searches couldn't be checked", failed)
+	}
+
+	return count, nil
+
+}
+
+// check runs a subscribed search against the pages changed since it was last
+// checked, up to <until>, and adds what it matched in the overlap to seen
+func (n *Notifier) check(s *SavedSearch, until time.Time,
+	seen map[string]map[matchKey]struct{}) (int, error) {
+
+	// Without the matches of the last check (the first time a search is
+	// checked since starting), looking back would notify about them again
+	last, ok := n.seen[s.ID]
+	since := s.Checked
+	if ok {
+		since = since.Add(-n.Overlap)
+	}
+
+	matches, err := n.Match(s, since, until)
+	if err != nil {
+		return 0, err
+	}
+
+	next := map[matchKey]struct{}{}
+	overlapStart := until.Add(-n.Overlap)
+
+	notes := []*Notification{}
+	for _, m := range matches {
+		key := matchKey{slug: m.Slug, modified: m.Modified.UnixNano()}
+		if !m.Modified.Before(overlapStart) {
+			next[key] = struct{}{}
+		}
+		if _, ok := last[key]; ok {
+			continue
+		}
+
+		notes = append(notes, &Notification{
+			Owner:      s.Owner,
+			SearchID:   s.ID,
+			SearchName: s.Name,
+			Slug:       m.Slug,
+			Title:      m.Title,
+			Modified:   m.Modified,
+			Created:    until,
+		})
+	}
+
+	err = n.Store.RecordMatches(s.ID, until, notes)
+	if err != nil {
+		return 0, err
+	}
+	seen[s.ID] = next
+
+	return len(notes), nil
+
+}
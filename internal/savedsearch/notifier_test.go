@@ -0,0 +1,171 @@
+package savedsearch
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// testStore keeps saved searches and notifications in memory
+type testStore struct {
+	searches []*SavedSearch
+	notes    []*Notification
+}
+
+func (s *testStore) ListSavedSearches(owner string) ([]*SavedSearch, error) {
+	return s.searches, nil
+}
+
+func (s *testStore) GetSavedSearch(id string) (*SavedSearch, error) {
+	for _, ss := range s.searches {
+		if ss.ID == id {
+			return ss, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *testStore) PutSavedSearch(ss *SavedSearch) error {
+	s.searches = append(s.searches, ss)
+	return nil
+}
+
+func (s *testStore) UpdateSavedSearch(id string, update func(ss *SavedSearch)) (*SavedSearch, error) {
+	ss, _ := s.GetSavedSearch(id)
+	if ss != nil {
+		update(ss)
+	}
+	return ss, nil
+}
+
+func (s *testStore) DeleteSavedSearch(id string) error {
+	return nil
+}
+
+func (s *testStore) RecordMatches(searchID string, checked time.Time, n []*Notification) error {
+	ss, _ := s.GetSavedSearch(searchID)
+	ss.Checked = checked
+	s.notes = append(s.notes, n...)
+	return nil
+}
+
+func (s *testStore) ListNotifications(owner string, limit int) ([]*Notification, error) {
+	return s.notes, nil
+}
+
+func (s *testStore) DeleteNotifications(owner string) error {
+	return nil
+}
+
+// testIndex is a search index that pages become searchable in when it's
+// flushed
+type testIndex struct {
+	pending  []*Match
+	indexed  []*Match
+	failing  map[string]bool
+	searches int
+}
+
+func (i *testIndex) flush() error {
+	i.indexed = append(i.indexed, i.pending...)
+	i.pending = nil
+	return nil
+}
+
+func (i *testIndex) match(s *SavedSearch, since time.Time, until time.Time) ([]*Match, error) {
+	i.searches++
+	if i.failing[s.ID] {
+		return nil, errors.New("search failed")
+	}
+	matches := []*Match{}
+	for _, m := range i.indexed {
+		if !m.Modified.Before(since) && m.Modified.Before(until) {
+			matches = append(matches, m)
+		}
+	}
+	return matches, nil
+}
+
+func newTestNotifier(searches ...string) (*Notifier, *testStore, *testIndex) {
+
+	store := &testStore{}
+	for _, id := range searches {
+		store.searches = append(store.searches, &SavedSearch{ID: id, Subscribed: true})
+	}
+
+	index := &testIndex{failing: map[string]bool{}}
+	n := NewNotifier(store, index.match)
+	n.Flush = index.flush
+
+	return n, store, index
+
+}
+
+func TestCheckFlushesFirst(t *testing.T) {
+
+	n, store, index := newTestNotifier("a")
+	index.pending = append(index.pending, &Match{Slug: "page", Modified: time.Now()})
+
+	count, err := n.Check()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 || len(store.notes) != 1 {
+		t.Errorf("expected 1 notification, got %d", len(store.notes))
+	}
+
+}
+
+func TestCheckOverlap(t *testing.T) {
+
+	n, store, index := newTestNotifier("a")
+	modified := time.Now().Add(-time.Second)
+	index.indexed = append(index.indexed, &Match{Slug: "early", Modified: modified})
+
+	_, err := n.Check()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A page changed before the last check that only became searchable
+	// after it is still found, and the one found last time isn't repeated
+	index.indexed = append(index.indexed, &Match{Slug: "late", Modified: modified})
+
+	_, err = n.Check()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	slugs := []string{}
+	for _, note := range store.notes {
+		slugs = append(slugs, note.Slug)
+	}
+	if len(slugs) != 2 || slugs[0] != "early" || slugs[1] != "late" {
+		t.Errorf("expected notifications for early and late, got %v", slugs)
+	}
+
+}
+
+func TestCheckContinuesAfterFailure(t *testing.T) {
+
+	n, store, index := newTestNotifier("a", "b", "c")
+	index.failing["b"] = true
+	index.indexed = append(index.indexed, &Match{Slug: "page", Modified: time.Now()})
+
+	count, err := n.Check()
+	if err == nil {
+		t.Error("expected an error")
+	}
+	if index.searches != 3 {
+		t.Errorf("expected all 3 searches to run, got %d", index.searches)
+	}
+	if count != 2 || len(store.notes) != 2 {
+		t.Errorf("expected 2 notifications, got %d", len(store.notes))
+	}
+
+	failed, _ := store.GetSavedSearch("b")
+	if !failed.Checked.IsZero() {
+		t.Error("the failed search was marked as checked")
+	}
+
+}
@@ -0,0 +1,62 @@
+package savedsearch
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"time"
+)
+
+// SavedSearch is a search a user has saved so it can be run again. When the
+// user is subscribed to it, they're notified about pages that match it as
+// they're created or changed.
+type SavedSearch struct {
+	ID         string    `json:"id"`
+	Owner      string    `json:"owner"`
+	Name       string    `json:"name"`
+	Query      string    `json:"query"`
+	Tags       []string  `json:"tags"`
+	Sort       []string  `json:"sort"`
+	Subscribed bool      `json:"subscribed"`
+	Created    time.Time `json:"created"`
+
+	// Pages changed before this have been checked for the subscription
+	Checked time.Time `json:"checked"`
+}
+
+// Notification tells a user that a page matches one of their subscribed
+// searches
+type Notification struct {
+	ID         uint64    `json:"id"`
+	Owner      string    `json:"owner"`
+	SearchID   string    `json:"search_id"`
+	SearchName string    `json:"search_name"`
+	Slug       string    `json:"slug"`
+	Title      string    `json:"title"`
+	Modified   time.Time `json:"modified"`
+	Created    time.Time `json:"created"`
+}
+
+// New returns a new saved search with a random ID
+func New(owner string, name string) (*SavedSearch, error) {
+
+	b := make([]byte, 16)
+	_, err := io.ReadFull(rand.Reader, b)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	s := SavedSearch{
+		ID:      hex.EncodeToString(b),
+		Owner:   owner,
+		Name:    name,
+		Tags:    []string{},
+		Sort:    []string{},
+		Created: now,
+		Checked: now,
+	}
+
+	return &s, nil
+
+}
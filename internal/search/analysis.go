@@ -0,0 +1,235 @@
+package search
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/blevesearch/bleve/analysis"
+	"github.com/blevesearch/bleve/analysis/analyzer/custom"
+	"github.com/blevesearch/bleve/analysis/lang/en"
+	"github.com/blevesearch/bleve/analysis/token/lowercase"
+	"github.com/blevesearch/bleve/analysis/token/porter"
+	"github.com/blevesearch/bleve/analysis/token/stop"
+	"github.com/blevesearch/bleve/analysis/tokenizer/unicode"
+	"github.com/blevesearch/bleve/analysis/tokenmap"
+	"github.com/blevesearch/bleve/mapping"
+	"github.com/blevesearch/bleve/registry"
+)
+
+// The contents are analyzed as English, with the configured synonyms and
+// stop words
+const (
+	contentsAnalyzer  = "contents"
+	contentsStopMap   = "contents_stop_words"
+	contentsStop      = "contents_stop"
+	contentsSynonyms  = "contents_synonyms"
+	synonymFilterName = "devpad_synonyms"
+)
+
+// analysisKey is where the fingerprint of the analysis an index was built
+// with is kept in it
+var analysisKey = []byte("devpad_analysis")
+
+// Analysis is what can be configured about how the contents of pages are
+// analyzed: groups of words that mean the same thing, and the words left out
+// of the index. StopWords replaces the English stop words, unless it's nil.
+type Analysis struct {
+	Synonyms  [][]string `json:"synonyms"`
+	StopWords []string   `json:"stop_words"`
+}
+
+// Check makes sure every synonym is a single word, since the contents are
+// split into words before synonyms are looked up
+func (a *Analysis) Check() error {
+
+	tokenizer := unicode.NewUnicodeTokenizer()
+	for _, group := range a.Synonyms {
+		if len(group) < 2 {
+			return fmt.Errorf("synonyms %q: a group needs at least two words", group)
+		}
+		for _, word := range group {
+			if len(tokenizer.Tokenize([]byte(word))) != 1 {
+				return fmt.Errorf("synonym %q isn't a single word", word)
+			}
+		}
+	}
+
+	return nil
+
+}
+
+// Fingerprint identifies the analysis, so an index built with different
+// synonyms or stop words can be found
+func (a *Analysis) Fingerprint() string {
+
+	// Marshalling this can't fail
+	j, _ := json.Marshal(a.normalized())
+	sum := sha256.Sum256(j)
+	return hex.EncodeToString(sum[:])
+
+}
+
+// normalized returns the analysis with its words lowercased, the way they
+// are compared with the contents
+func (a *Analysis) normalized() *Analysis {
+
+	n := Analysis{Synonyms: [][]string{}}
+	for _, group := range a.Synonyms {
+		words := []string{}
+		for _, word := range group {
+			words = append(words, strings.ToLower(strings.TrimSpace(word)))
+		}
+		n.Synonyms = append(n.Synonyms, words)
+	}
+
+	if a.StopWords != nil {
+		n.StopWords = []string{}
+		for _, word := range a.StopWords {
+			n.StopWords = append(n.StopWords, strings.ToLower(strings.TrimSpace(word)))
+		}
+	}
+
+	return &n
+
+}
+
+// addContentsAnalyzer adds the analyzer for the contents to the mapping. It's
+// the English analyzer, with synonyms added before words are stemmed so
+// "kubernetes" and "k8s" end up the same whichever is typed.
+func addContentsAnalyzer(m *mapping.IndexMappingImpl, a *Analysis) error {
+
+	a = a.normalized()
+	filters := []interface{}{en.PossessiveName, lowercase.Name}
+
+	if a.StopWords == nil {
+		filters = append(filters, en.StopName)
+	} else if len(a.StopWords) > 0 {
+		tokens := []interface{}{}
+		for _, word := range a.StopWords {
+			tokens = append(tokens, word)
+		}
+		err := m.AddCustomTokenMap(contentsStopMap, map[string]interface{}{
+			"type":   tokenmap.Name,
+			"tokens": tokens,
+		})
+		if err != nil {
+			return err
+		}
+		err = m.AddCustomTokenFilter(contentsStop, map[string]interface{}{
+			"type":           stop.Name,
+			"stop_token_map": contentsStopMap,
+		})
+		if err != nil {
+			return err
+		}
+		filters = append(filters, contentsStop)
+	}
+
+	if len(a.Synonyms) > 0 {
+		groups := []interface{}{}
+		for _, group := range a.Synonyms {
+			words := []interface{}{}
+			for _, word := range group {
+				words = append(words, word)
+			}
+			groups = append(groups, words)
+		}
+		err := m.AddCustomTokenFilter(contentsSynonyms, map[string]interface{}{
+			"type":     synonymFilterName,
+			"synonyms": groups,
+		})
+		if err != nil {
+			return err
+		}
+		filters = append(filters, contentsSynonyms)
+	}
+
+	filters = append(filters, porter.Name)
+
+	return m.AddCustomAnalyzer(contentsAnalyzer, map[string]interface{}{
+		"type":          custom.Name,
+		"tokenizer":     unicode.Name,
+		"token_filters": filters,
+	})
+
+}
+
+// synonymFilter adds the synonyms of every word after it, at the same
+// position, so searching for any of them finds the others
+type synonymFilter struct {
+	synonyms map[string][]string
+}
+
+func (f *synonymFilter) Filter(input analysis.TokenStream) analysis.TokenStream {
+
+	output := make(analysis.TokenStream, 0, len(input))
+	for _, token := range input {
+		output = append(output, token)
+		for _, synonym := range f.synonyms[string(token.Term)] {
+			output = append(output, &analysis.Token{
+				Start:    token.Start,
+				End:      token.End,
+				Term:     []byte(synonym),
+				Position: token.Position,
+				Type:     token.Type,
+			})
+		}
+	}
+
+	return output
+
+}
+
+// newSynonymFilter builds the synonym filter from its config, which is kept
+// in the index mapping: "synonyms" is a list of groups of words
+func newSynonymFilter(config map[string]interface{}, cache *registry.Cache) (analysis.TokenFilter, error) {
+
+	groups, ok := config["synonyms"].([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("must specify synonyms")
+	}
+
+	synonyms := map[string][]string{}
+	for _, g := range groups {
+		group, ok := g.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("synonyms must be lists of words")
+		}
+
+		words := []string{}
+		for _, w := range group {
+			word, ok := w.(string)
+			if !ok {
+				return nil, fmt.Errorf("synonyms must be lists of words")
+			}
+			words = append(words, word)
+		}
+
+		for _, word := range words {
+			for _, other := range words {
+				if other != word && !contains(synonyms[word], other) {
+					synonyms[word] = append(synonyms[word], other)
+				}
+			}
+		}
+	}
+
+	return &synonymFilter{synonyms: synonyms}, nil
+
+}
+
+func contains(words []string, word string) bool {
+	for _, w := range words {
+		if w == word {
+			return true
+		}
+	}
+	return false
+}
+
+func init() {
+	registry.RegisterTokenFilter(synonymFilterName, newSynonymFilter)
+}
@@ -0,0 +1,88 @@
+package search
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/blevesearch/bleve"
+	"github.com/blevesearch/bleve/search/query"
+)
+
+// Units of time a relative date can be counted in
+var dateUnits = map[string]time.Duration{
+	"h": time.Hour,
+	"d": 24 * time.Hour,
+	"w": 7 * 24 * time.Hour,
+}
+
+// relativeDate matches dates relative to now, like "now-14d"
+var relativeDate = regexp.MustCompile(`^now(?:-(\d+)([hdw]))?$`)
+
+// ParseDate reads a date as an RFC 3339 time, as a day (2006-01-02), which
+// starts at midnight in the server's time zone, or relative to now, as "now"
+// or a number of hours, days or weeks before it ("now-12h", "now-14d",
+// "now-2w")
+func ParseDate(s string, now time.Time) (time.Time, error) {
+
+	if m := relativeDate.FindStringSubmatch(s); m != nil {
+		if m[1] == "" {
+			return now, nil
+		}
+		n, err := strconv.Atoi(m[1])
+		if err == nil {
+			return now.Add(-time.Duration(n) * dateUnits[m[2]]), nil
+		}
+	}
+
+	t, err := time.Parse(time.RFC3339, s)
+	if err == nil {
+		return t, nil
+	}
+
+	t, err = time.ParseInLocation("2006-01-02", s, now.Location())
+	if err == nil {
+		return t, nil
+	}
+
+	return time.Time{}, fmt.Errorf("%q isn't a date like 2006-01-02, "+
+		"2006-01-02T15:04:05Z or now-14d", s)
+
+}
+
+// NewModifiedQuery matches pages modified at or after <after> and before
+// <before>. Either can be zero to leave that end of the range open.
+func NewModifiedQuery(after, before time.Time) query.Query {
+
+	inclusiveStart, inclusiveEnd := true, false
+	q := bleve.NewDateRangeInclusiveQuery(after, before, &inclusiveStart, &inclusiveEnd)
+	q.SetField("metadata.modified")
+
+	return q
+
+}
+
+// NewModifiedFacet counts the pages modified today, this week (since Monday,
+// or the 1st if the month started later), this month, and before that. The
+// ranges include the ones before them, so each count is what filtering on it
+// from then on would find.
+func NewModifiedFacet(now time.Time) *bleve.FacetRequest {
+
+	y, m, d := now.Date()
+	today := time.Date(y, m, d, 0, 0, 0, 0, now.Location())
+	week := today.AddDate(0, 0, -((int(today.Weekday()) + 6) % 7))
+	month := time.Date(y, m, 1, 0, 0, 0, 0, now.Location())
+	if week.Before(month) {
+		week = month
+	}
+
+	facet := bleve.NewFacetRequest("metadata.modified", 4)
+	facet.AddDateTimeRange("today", today, time.Time{})
+	facet.AddDateTimeRange("this_week", week, time.Time{})
+	facet.AddDateTimeRange("this_month", month, time.Time{})
+	facet.AddDateTimeRange("older", time.Time{}, month)
+
+	return facet
+
+}
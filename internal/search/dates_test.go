@@ -0,0 +1,37 @@
+package search
+
+import (
+	"testing"
+	"time"
+)
+
+func TestModifiedFacetRanges(t *testing.T) {
+
+	day := func(month time.Month, d int) time.Time {
+		return time.Date(2020, month, d, 0, 0, 0, 0, time.UTC)
+	}
+
+	cases := []struct {
+		now  time.Time
+		week time.Time
+	}{
+		// A Wednesday, with Monday in the same month
+		{day(10, 14).Add(15 * time.Hour), day(10, 12)},
+		// A Friday in a month that started on Thursday
+		{day(10, 2).Add(15 * time.Hour), day(10, 1)},
+	}
+
+	for _, c := range cases {
+		starts := map[string]time.Time{}
+		for _, r := range NewModifiedFacet(c.now).DateTimeRanges {
+			starts[r.Name] = r.Start
+		}
+		if !starts["this_week"].Equal(c.week) {
+			t.Errorf("on %s, expected this week to start on %s, got %s", c.now, c.week, starts["this_week"])
+		}
+		if starts["this_week"].Before(starts["this_month"]) {
+			t.Errorf("on %s, this week starts before this month", c.now)
+		}
+	}
+
+}
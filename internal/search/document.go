@@ -0,0 +1,77 @@
+package search
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/idrum4316/devpad-server/internal/page"
+)
+
+// document is what's indexed for a page: the page with HTML tags removed from
+// its contents, the contents again under the analyzer for the page's
+// language, its title and slug for suggestions, and a hash of the page as
+// it's stored, so pages that are out of date in the index can be found
+type document struct {
+	Contents    string            `json:"contents"`
+	Localized   map[string]string `json:"localized,omitempty"`
+	Metadata    page.Metadata     `json:"metadata"`
+	Suggest     string            `json:"suggest"`
+	ContentHash string            `json:"content_hash"`
+}
+
+// slugSeparators split a slug into words for suggestions
+var slugSeparators = strings.NewReplacer(":", " ", "/", " ", "-", " ", "_", " ", ".", " ")
+
+// newDocument returns the document that is indexed for a page
+func newDocument(id string, p *page.Page) *document {
+
+	d := document{
+		Contents: htmlPolicy.Sanitize(p.Contents),
+		Metadata: p.Metadata,
+
+		// The slug is there whole and split into words, so both
+		// "ops:dep" and "dep" find ops:deploy
+		Suggest:     p.Metadata.Title + "\n" + id + "\n" + slugSeparators.Replace(id),
+		ContentHash: ContentHash(p),
+	}
+
+	if analyzer := languageAnalyzer(p.Metadata.Language); analyzer != "" {
+		d.Localized = map[string]string{analyzer: d.Contents}
+	}
+
+	return &d
+
+}
+
+// ContentHash returns a hash of everything about a page that is indexed. The
+// modification time only counts to the second, since that's all page files
+// keep of it.
+func ContentHash(p *page.Page) string {
+
+	tags := p.Metadata.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+
+	// Marshalling these can't fail
+	j, _ := json.Marshal(struct {
+		Title    string   `json:"title"`
+		Tags     []string `json:"tags"`
+		Language string   `json:"language,omitempty"`
+		Modified string   `json:"modified"`
+		Contents string   `json:"contents"`
+	}{
+		Title:    p.Metadata.Title,
+		Tags:     tags,
+		Language: p.Metadata.Language,
+		Modified: p.Metadata.Modified.UTC().Format(time.RFC3339),
+		Contents: p.Contents,
+	})
+
+	sum := sha256.Sum256(j)
+	return hex.EncodeToString(sum[:])
+
+}
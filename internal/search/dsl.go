@@ -0,0 +1,810 @@
+package search
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/blevesearch/bleve"
+	"github.com/blevesearch/bleve/search/query"
+)
+
+// Limits on a JSON search, so one request can't tie up the index
+const (
+	dslMaxSize    = 1000
+	dslMaxDepth   = 16
+	dslMaxClauses = 1024
+)
+
+// Fields a JSON search can name, by the names it accepts for them
+var dslFields = map[string]string{
+	"contents":          "contents",
+	"title":             "metadata.title",
+	"metadata.title":    "metadata.title",
+	"tags":              "metadata.tags",
+	"metadata.tags":     "metadata.tags",
+	"modified":          "metadata.modified",
+	"metadata.modified": "metadata.modified",
+}
+
+// Fields text clauses search when neither they nor the search name any. Each
+// field is searched with its own analyzer, which the catch-all field can't do.
+var dslDefaultBoosts = map[string]float64{
+	"contents":       1,
+	"metadata.title": 1,
+	"metadata.tags":  1,
+}
+
+// Fields that can be sorted on, besides the score and the slug
+var dslSortFields = map[string]bool{
+	"metadata.title":    true,
+	"metadata.modified": true,
+}
+
+// DSLError is a problem with a JSON search. Path points at the part of the
+// request that's wrong, like "query.bool.must[1].fuzzy.fuzziness".
+type DSLError struct {
+	Path    string `json:"path,omitempty"`
+	Message string `json:"message"`
+}
+
+func (e *DSLError) Error() string {
+	if e.Path == "" {
+		return e.Message
+	}
+	return e.Path + ": " + e.Message
+}
+
+// ParseDSL translates a search written as JSON into a bleve search request.
+// The request looks like:
+//
+//	{
+//	  "query": {"bool": {
+//	    "must": [{"match": {"text": "deploy", "operator": "and"}}],
+//	    "should": [{"phrase": {"text": "blue green", "field": "contents"}}],
+//	    "must_not": [{"term": {"term": "archived", "field": "tags"}}]
+//	  }},
+//	  "boosts": {"title": 3, "contents": 1},
+//	  "facets": {"tags": {"field": "tags", "size": 10}},
+//	  "size": 10, "from": 0, "sort": ["-_score"], "highlight": true
+//	}
+//
+// Clauses are bool, match, phrase, fuzzy, prefix, regexp, term, modified
+// (with "after" and "before" dates) and match_all. Text clauses without a
+// field search every field in "boosts", weighted by them, or the contents,
+// title and tags if there are none. The contents are searched in every
+// language. Facets count terms in a field, or pages in "ranges" of
+// modification dates.
+func ParseDSL(b []byte, now time.Time) (*bleve.SearchRequest, error) {
+
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.UseNumber()
+
+	var v interface{}
+	err := decoder.Decode(&v)
+	if err != nil {
+		return nil, &DSLError{Message: fmt.Sprintf("unable to decode JSON: %s", err)}
+	}
+
+	p := dslParser{now: now}
+	return p.request(v)
+
+}
+
+// dslParser translates a decoded JSON search, keeping track of how much it
+// has seen
+type dslParser struct {
+	now     time.Time
+	boosts  map[string]float64
+	clauses int
+}
+
+// request translates the top level of a search
+func (p *dslParser) request(v interface{}) (*bleve.SearchRequest, error) {
+
+	obj, err := object("", v, "query", "boosts", "facets", "size", "from", "sort", "highlight")
+	if err != nil {
+		return nil, err
+	}
+
+	// Boosts have to be known before the clauses that use them
+	p.boosts = dslDefaultBoosts
+	if b, ok := obj["boosts"]; ok {
+		p.boosts, err = p.boostMap("boosts", b)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var q query.Query = bleve.NewMatchAllQuery()
+	if c, ok := obj["query"]; ok {
+		q, err = p.clause("query", c, 0)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	req := bleve.NewSearchRequest(q)
+	req.Fields = []string{"contents", "metadata.title", "metadata.tags", "metadata.modified"}
+
+	req.Size, err = intField("size", obj, 10, 0, dslMaxSize)
+	if err != nil {
+		return nil, err
+	}
+	req.From, err = intField("from", obj, 0, 0, -1)
+	if err != nil {
+		return nil, err
+	}
+
+	if s, ok := obj["sort"]; ok {
+		order, err := sortOrder("sort", s)
+		if err != nil {
+			return nil, err
+		}
+		req.SortBy(order)
+	}
+
+	highlight := true
+	if h, ok := obj["highlight"]; ok {
+		highlight, ok = h.(bool)
+		if !ok {
+			return nil, &DSLError{"highlight", "must be true or false"}
+		}
+	}
+	if highlight {
+		req.Highlight = bleve.NewHighlight()
+	}
+
+	if f, ok := obj["facets"]; ok {
+		facets, err := p.facets("facets", f)
+		if err != nil {
+			return nil, err
+		}
+		for name, facet := range facets {
+			req.AddFacet(name, facet)
+		}
+	}
+
+	return req, nil
+
+}
+
+// clause translates one query clause, which is an object with a single key
+// naming its kind
+func (p *dslParser) clause(path string, v interface{}, depth int) (query.Query, error) {
+
+	p.clauses++
+	if p.clauses > dslMaxClauses {
+		return nil, &DSLError{path, fmt.Sprintf("a search can't have more than %d clauses", dslMaxClauses)}
+	}
+	if depth > dslMaxDepth {
+		return nil, &DSLError{path, fmt.Sprintf("clauses can't be nested more than %d deep", dslMaxDepth)}
+	}
+
+	obj, ok := v.(map[string]interface{})
+	if !ok || len(obj) != 1 {
+		return nil, &DSLError{path, "must be an object with one of bool, match, phrase, " +
+			"fuzzy, prefix, regexp, term, modified or match_all"}
+	}
+
+	var kind string
+	var body interface{}
+	for kind, body = range obj {
+	}
+	path += "." + kind
+
+	switch kind {
+	case "bool":
+		return p.boolClause(path, body, depth)
+	case "match":
+		return p.matchClause(path, body)
+	case "phrase":
+		return p.phraseClause(path, body)
+	case "fuzzy":
+		return p.fuzzyClause(path, body)
+	case "prefix":
+		return p.prefixClause(path, body)
+	case "regexp":
+		return p.regexpClause(path, body)
+	case "term":
+		return p.termClause(path, body)
+	case "modified":
+		return p.modifiedClause(path, body)
+	case "match_all":
+		_, err := object(path, body)
+		if err != nil {
+			return nil, err
+		}
+		return bleve.NewMatchAllQuery(), nil
+	}
+
+	return nil, &DSLError{path, "unknown clause"}
+
+}
+
+// boolClause combines clauses that must, should and must not match
+func (p *dslParser) boolClause(path string, v interface{}, depth int) (query.Query, error) {
+
+	obj, err := object(path, v, "must", "should", "must_not", "min_should", "boost")
+	if err != nil {
+		return nil, err
+	}
+
+	list := func(key string) ([]query.Query, error) {
+		raw, ok := obj[key]
+		if !ok {
+			return nil, nil
+		}
+		items, ok := raw.([]interface{})
+		if !ok {
+			return nil, &DSLError{path + "." + key, "must be a list of clauses"}
+		}
+		queries := []query.Query{}
+		for n, item := range items {
+			q, err := p.clause(fmt.Sprintf("%s.%s[%d]", path, key, n), item, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			queries = append(queries, q)
+		}
+		return queries, nil
+	}
+
+	must, err := list("must")
+	if err != nil {
+		return nil, err
+	}
+	should, err := list("should")
+	if err != nil {
+		return nil, err
+	}
+	mustNot, err := list("must_not")
+	if err != nil {
+		return nil, err
+	}
+	if len(must)+len(should)+len(mustNot) == 0 {
+		return nil, &DSLError{path, "needs at least one of must, should or must_not"}
+	}
+
+	// Without any clauses that must match, at least one that should does
+	minShould := 0
+	if len(must) == 0 && len(should) > 0 {
+		minShould = 1
+	}
+	minShould, err = intField(path+".min_should", obj, minShould, 0, len(should))
+	if err != nil {
+		return nil, err
+	}
+
+	q := bleve.NewBooleanQuery()
+	q.AddMust(must...)
+	q.AddShould(should...)
+	q.AddMustNot(mustNot...)
+	q.SetMinShould(float64(minShould))
+
+	// A clause that only excludes pages excludes them from all of them
+	if len(must) == 0 && len(should) == 0 {
+		q.AddMust(bleve.NewMatchAllQuery())
+	}
+
+	return q, p.boost(path, obj, q)
+
+}
+
+// matchClause matches the words of a text, analyzed like the field is
+func (p *dslParser) matchClause(path string, v interface{}) (query.Query, error) {
+
+	obj, err := object(path, v, "text", "field", "operator", "fuzziness", "boost")
+	if err != nil {
+		return nil, err
+	}
+	text, err := stringField(path, obj, "text", true)
+	if err != nil {
+		return nil, err
+	}
+
+	var operator query.MatchQueryOperator = query.MatchQueryOperatorOr
+	op, err := stringField(path, obj, "operator", false)
+	if err != nil {
+		return nil, err
+	}
+	switch op {
+	case "", "or":
+	case "and":
+		operator = query.MatchQueryOperatorAnd
+	default:
+		return nil, &DSLError{path + ".operator", "must be \"and\" or \"or\""}
+	}
+
+	fuzziness, err := intField(path+".fuzziness", obj, 0, 0, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.fielded(path, obj, func(field string) query.Query {
+		q := bleve.NewMatchQuery(text)
+		q.SetField(field)
+		q.SetOperator(operator)
+		q.SetFuzziness(fuzziness)
+		return q
+	})
+
+}
+
+// phraseClause matches the words of a text next to each other, in order
+func (p *dslParser) phraseClause(path string, v interface{}) (query.Query, error) {
+
+	obj, err := object(path, v, "text", "field", "boost")
+	if err != nil {
+		return nil, err
+	}
+	text, err := stringField(path, obj, "text", true)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.fielded(path, obj, func(field string) query.Query {
+		q := bleve.NewMatchPhraseQuery(text)
+		q.SetField(field)
+		return q
+	})
+
+}
+
+// fuzzyClause matches terms within an edit distance of a term
+func (p *dslParser) fuzzyClause(path string, v interface{}) (query.Query, error) {
+
+	obj, err := object(path, v, "term", "field", "fuzziness", "prefix", "boost")
+	if err != nil {
+		return nil, err
+	}
+	term, err := stringField(path, obj, "term", true)
+	if err != nil {
+		return nil, err
+	}
+	fuzziness, err := intField(path+".fuzziness", obj, 1, 1, 2)
+	if err != nil {
+		return nil, err
+	}
+	prefix, err := intField(path+".prefix", obj, 0, 0, -1)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.fielded(path, obj, func(field string) query.Query {
+		q := bleve.NewFuzzyQuery(term)
+		q.SetField(field)
+		q.SetFuzziness(fuzziness)
+		q.SetPrefix(prefix)
+		return q
+	})
+
+}
+
+// prefixClause matches terms that start with a prefix
+func (p *dslParser) prefixClause(path string, v interface{}) (query.Query, error) {
+
+	obj, err := object(path, v, "prefix", "field", "boost")
+	if err != nil {
+		return nil, err
+	}
+	prefix, err := stringField(path, obj, "prefix", true)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.fielded(path, obj, func(field string) query.Query {
+		q := bleve.NewPrefixQuery(prefix)
+		q.SetField(field)
+		return q
+	})
+
+}
+
+// regexpClause matches terms against a regular expression
+func (p *dslParser) regexpClause(path string, v interface{}) (query.Query, error) {
+
+	obj, err := object(path, v, "regexp", "field", "boost")
+	if err != nil {
+		return nil, err
+	}
+	expr, err := stringField(path, obj, "regexp", true)
+	if err != nil {
+		return nil, err
+	}
+	_, err = regexp.Compile(expr)
+	if err != nil {
+		return nil, &DSLError{path + ".regexp", err.Error()}
+	}
+
+	return p.fielded(path, obj, func(field string) query.Query {
+		q := bleve.NewRegexpQuery(expr)
+		q.SetField(field)
+		return q
+	})
+
+}
+
+// termClause matches a term exactly, as it was indexed
+func (p *dslParser) termClause(path string, v interface{}) (query.Query, error) {
+
+	obj, err := object(path, v, "term", "field", "boost")
+	if err != nil {
+		return nil, err
+	}
+	term, err := stringField(path, obj, "term", true)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.fielded(path, obj, func(field string) query.Query {
+		q := bleve.NewTermQuery(term)
+		q.SetField(field)
+		return q
+	})
+
+}
+
+// modifiedClause matches pages modified from "after" up to "before"
+func (p *dslParser) modifiedClause(path string, v interface{}) (query.Query, error) {
+
+	obj, err := object(path, v, "after", "before", "boost")
+	if err != nil {
+		return nil, err
+	}
+
+	after, before, err := p.dateRange(path, obj)
+	if err != nil {
+		return nil, err
+	}
+
+	q := NewModifiedQuery(after, before)
+	return q, p.boost(path, obj, q)
+
+}
+
+// dateRange reads the "after" and "before" dates of an object, at least one
+// of which must be there
+func (p *dslParser) dateRange(path string, obj map[string]interface{}) (time.Time, time.Time, error) {
+
+	var dates [2]time.Time
+	for n, key := range []string{"after", "before"} {
+		s, err := stringField(path, obj, key, false)
+		if err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+		if s == "" {
+			continue
+		}
+		dates[n], err = ParseDate(s, p.now)
+		if err != nil {
+			return time.Time{}, time.Time{}, &DSLError{path + "." + key, err.Error()}
+		}
+	}
+
+	after, before := dates[0], dates[1]
+	if after.IsZero() && before.IsZero() {
+		return after, before, &DSLError{path, "needs \"after\", \"before\" or both"}
+	}
+	if !after.IsZero() && !before.IsZero() && !after.Before(before) {
+		return after, before, &DSLError{path, "\"after\" must be earlier than \"before\""}
+	}
+
+	return after, before, nil
+
+}
+
+// fielded builds a text clause for its field. Without one, it's built for
+// every boosted field.
+func (p *dslParser) fielded(path string, obj map[string]interface{}, build func(field string) query.Query) (query.Query, error) {
+
+	name, err := stringField(path, obj, "field", false)
+	if err != nil {
+		return nil, err
+	}
+
+	var q query.Query
+	switch {
+	case name != "":
+		field, ok := dslFields[name]
+		if !ok || field == "metadata.modified" {
+			return nil, &DSLError{path + ".field", fmt.Sprintf("unknown field %q", name)}
+		}
+		q = buildContents(field, build)
+
+	default:
+		fields := make([]string, 0, len(p.boosts))
+		for field := range p.boosts {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+
+		queries := []query.Query{}
+		for _, field := range fields {
+			fq := buildContents(field, build)
+			fq.(query.BoostableQuery).SetBoost(p.boosts[field])
+			queries = append(queries, fq)
+		}
+		q = bleve.NewDisjunctionQuery(queries...)
+	}
+
+	return q, p.boost(path, obj, q)
+
+}
+
+// buildContents builds a text clause for a field. Clauses for the contents
+// search them in every language.
+func buildContents(field string, build func(field string) query.Query) query.Query {
+
+	if field != "contents" {
+		return build(field)
+	}
+
+	queries := []query.Query{}
+	for _, f := range ContentFields {
+		queries = append(queries, build(f))
+	}
+	return bleve.NewDisjunctionQuery(queries...)
+
+}
+
+// boost sets the boost of a clause, if it has one
+func (p *dslParser) boost(path string, obj map[string]interface{}, q query.Query) error {
+
+	if _, ok := obj["boost"]; !ok {
+		return nil
+	}
+
+	boost, err := floatField(path+".boost", obj["boost"])
+	if err != nil {
+		return err
+	}
+	if boost <= 0 {
+		return &DSLError{path + ".boost", "must be greater than 0"}
+	}
+
+	q.(query.BoostableQuery).SetBoost(boost)
+	return nil
+
+}
+
+// boostMap reads the weights of the fields text clauses search by default
+func (p *dslParser) boostMap(path string, v interface{}) (map[string]float64, error) {
+
+	obj, ok := v.(map[string]interface{})
+	if !ok || len(obj) == 0 {
+		return nil, &DSLError{path, "must be an object of fields and their weights"}
+	}
+
+	boosts := map[string]float64{}
+	for name, w := range obj {
+		field, ok := dslFields[name]
+		if !ok || field == "metadata.modified" {
+			return nil, &DSLError{path + "." + name, "unknown field"}
+		}
+		boost, err := floatField(path+"."+name, w)
+		if err != nil {
+			return nil, err
+		}
+		if boost <= 0 {
+			return nil, &DSLError{path + "." + name, "must be greater than 0"}
+		}
+		boosts[field] = boost
+	}
+
+	return boosts, nil
+
+}
+
+// facets reads facet definitions: terms in a field, or ranges of
+// modification dates
+func (p *dslParser) facets(path string, v interface{}) (map[string]*bleve.FacetRequest, error) {
+
+	obj, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, &DSLError{path, "must be an object of facets by name"}
+	}
+
+	facets := map[string]*bleve.FacetRequest{}
+	for name, def := range obj {
+		fpath := path + "." + name
+		fobj, err := object(fpath, def, "field", "size", "ranges")
+		if err != nil {
+			return nil, err
+		}
+
+		fieldName, err := stringField(fpath, fobj, "field", true)
+		if err != nil {
+			return nil, err
+		}
+		field, ok := dslFields[fieldName]
+		if !ok {
+			return nil, &DSLError{fpath + ".field", fmt.Sprintf("unknown field %q", fieldName)}
+		}
+
+		size, err := intField(fpath+".size", fobj, 10, 1, dslMaxSize)
+		if err != nil {
+			return nil, err
+		}
+		facet := bleve.NewFacetRequest(field, size)
+
+		rawRanges, hasRanges := fobj["ranges"]
+		if field == "metadata.modified" && !hasRanges {
+			return nil, &DSLError{fpath, "facets on modification dates need \"ranges\""}
+		}
+		if hasRanges {
+			if field != "metadata.modified" {
+				return nil, &DSLError{fpath + ".ranges", "only facets on modification dates can have ranges"}
+			}
+			ranges, ok := rawRanges.([]interface{})
+			if !ok || len(ranges) == 0 {
+				return nil, &DSLError{fpath + ".ranges", "must be a list of ranges"}
+			}
+			for n, r := range ranges {
+				rpath := fmt.Sprintf("%s.ranges[%d]", fpath, n)
+				robj, err := object(rpath, r, "name", "after", "before")
+				if err != nil {
+					return nil, err
+				}
+				rname, err := stringField(rpath, robj, "name", true)
+				if err != nil {
+					return nil, err
+				}
+				after, before, err := p.dateRange(rpath, robj)
+				if err != nil {
+					return nil, err
+				}
+				facet.AddDateTimeRange(rname, after, before)
+			}
+		}
+
+		facets[name] = facet
+	}
+
+	return facets, nil
+
+}
+
+// sortOrder reads a list of fields to sort by, each starting with "-" to
+// sort in descending order
+func sortOrder(path string, v interface{}) ([]string, error) {
+
+	items, ok := v.([]interface{})
+	if !ok {
+		return nil, &DSLError{path, "must be a list of fields"}
+	}
+
+	order := []string{}
+	for n, item := range items {
+		ipath := fmt.Sprintf("%s[%d]", path, n)
+		s, ok := item.(string)
+		if !ok {
+			return nil, &DSLError{ipath, "must be a field name"}
+		}
+
+		desc := strings.HasPrefix(s, "-")
+		name := strings.TrimPrefix(s, "-")
+		field, known := dslFields[name]
+		switch {
+		case name == "_score" || name == "_id":
+			field = name
+		case !known || !dslSortFields[field]:
+			return nil, &DSLError{ipath, fmt.Sprintf("can't sort by %q", name)}
+		}
+
+		if desc {
+			field = "-" + field
+		}
+		order = append(order, field)
+	}
+
+	return order, nil
+
+}
+
+// object checks that v is an object with none but the allowed keys
+func object(path string, v interface{}, allowed ...string) (map[string]interface{}, error) {
+
+	obj, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, &DSLError{path, "must be an object"}
+	}
+
+	for key := range obj {
+		found := false
+		for _, a := range allowed {
+			if key == a {
+				found = true
+				break
+			}
+		}
+		if !found {
+			kpath := key
+			if path != "" {
+				kpath = path + "." + key
+			}
+			return nil, &DSLError{kpath, "unknown option"}
+		}
+	}
+
+	return obj, nil
+
+}
+
+// stringField reads a string from an object, which can't be empty if it's
+// required
+func stringField(path string, obj map[string]interface{}, key string, required bool) (string, error) {
+
+	kpath := path + "." + key
+	v, ok := obj[key]
+	if !ok {
+		if required {
+			return "", &DSLError{kpath, "is required"}
+		}
+		return "", nil
+	}
+
+	s, ok := v.(string)
+	if !ok {
+		return "", &DSLError{kpath, "must be a string"}
+	}
+	if required && s == "" {
+		return "", &DSLError{kpath, "can't be empty"}
+	}
+
+	return s, nil
+
+}
+
+// intField reads a whole number from an object, from min to max (with no
+// maximum if it's negative). path is where the number is.
+func intField(path string, obj map[string]interface{}, def int, min int, max int) (int, error) {
+
+	key := path
+	if i := strings.LastIndex(path, "."); i >= 0 {
+		key = path[i+1:]
+	}
+
+	v, ok := obj[key]
+	if !ok {
+		return def, nil
+	}
+
+	num, ok := v.(json.Number)
+	if !ok {
+		return 0, &DSLError{path, "must be a number"}
+	}
+	n, err := num.Int64()
+	if err != nil {
+		return 0, &DSLError{path, "must be a whole number"}
+	}
+	if n < int64(min) || (max >= 0 && n > int64(max)) {
+		if max < 0 {
+			return 0, &DSLError{path, fmt.Sprintf("must be at least %d", min)}
+		}
+		return 0, &DSLError{path, fmt.Sprintf("must be from %d to %d", min, max)}
+	}
+
+	return int(n), nil
+
+}
+
+// floatField reads a number
+func floatField(path string, v interface{}) (float64, error) {
+
+	num, ok := v.(json.Number)
+	if !ok {
+		return 0, &DSLError{path, "must be a number"}
+	}
+	f, err := num.Float64()
+	if err != nil {
+		return 0, &DSLError{path, "must be a number"}
+	}
+
+	return f, nil
+
+}
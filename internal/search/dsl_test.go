@@ -0,0 +1,399 @@
+package search
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blevesearch/bleve"
+	"github.com/blevesearch/bleve/search/query"
+)
+
+var dslNow = time.Date(2020, 6, 15, 12, 0, 0, 0, time.UTC)
+
+func parseDSL(t *testing.T, s string) *bleve.SearchRequest {
+	t.Helper()
+	req, err := ParseDSL([]byte(s), dslNow)
+	if err != nil {
+		t.Fatalf("%s: %s", s, err)
+	}
+	return req
+}
+
+// field returns the field of a clause built for a single field
+func field(q query.Query) string {
+	if fq, ok := q.(query.FieldableQuery); ok {
+		return fq.Field()
+	}
+	return ""
+}
+
+func TestDSLClauses(t *testing.T) {
+
+	cases := []struct {
+		name  string
+		query string
+		check func(q query.Query) error
+	}{
+		{"match", `{"match": {"text": "deploy", "field": "title", "operator": "and", "fuzziness": 1}}`,
+			func(q query.Query) error {
+				m, ok := q.(*query.MatchQuery)
+				if !ok || m.Match != "deploy" || m.FieldVal != "metadata.title" ||
+					m.Operator != query.MatchQueryOperatorAnd || m.Fuzziness != 1 {
+					return fmt.Errorf("got %#v", q)
+				}
+				return nil
+			}},
+		{"phrase", `{"phrase": {"text": "blue green", "field": "tags"}}`,
+			func(q query.Query) error {
+				m, ok := q.(*query.MatchPhraseQuery)
+				if !ok || m.MatchPhrase != "blue green" || m.FieldVal != "metadata.tags" {
+					return fmt.Errorf("got %#v", q)
+				}
+				return nil
+			}},
+		{"fuzzy", `{"fuzzy": {"term": "deplyo", "field": "title", "fuzziness": 2, "prefix": 1}}`,
+			func(q query.Query) error {
+				f, ok := q.(*query.FuzzyQuery)
+				if !ok || f.Term != "deplyo" || f.Fuzziness != 2 || f.Prefix != 1 {
+					return fmt.Errorf("got %#v", q)
+				}
+				return nil
+			}},
+		{"fuzzy defaults", `{"fuzzy": {"term": "deplyo", "field": "title"}}`,
+			func(q query.Query) error {
+				f, ok := q.(*query.FuzzyQuery)
+				if !ok || f.Fuzziness != 1 || f.Prefix != 0 {
+					return fmt.Errorf("got %#v", q)
+				}
+				return nil
+			}},
+		{"prefix", `{"prefix": {"prefix": "dep", "field": "title"}}`,
+			func(q query.Query) error {
+				p, ok := q.(*query.PrefixQuery)
+				if !ok || p.Prefix != "dep" {
+					return fmt.Errorf("got %#v", q)
+				}
+				return nil
+			}},
+		{"regexp", `{"regexp": {"regexp": "dep.*", "field": "title"}}`,
+			func(q query.Query) error {
+				r, ok := q.(*query.RegexpQuery)
+				if !ok || r.Regexp != "dep.*" {
+					return fmt.Errorf("got %#v", q)
+				}
+				return nil
+			}},
+		{"term", `{"term": {"term": "archived", "field": "tags", "boost": 2}}`,
+			func(q query.Query) error {
+				tq, ok := q.(*query.TermQuery)
+				if !ok || tq.Term != "archived" || tq.FieldVal != "metadata.tags" || tq.Boost() != 2 {
+					return fmt.Errorf("got %#v", q)
+				}
+				return nil
+			}},
+		{"modified", `{"modified": {"after": "2020-06-01T00:00:00Z", "before": "now"}}`,
+			func(q query.Query) error {
+				d, ok := q.(*query.DateRangeQuery)
+				if !ok || d.Start.Time.IsZero() || d.End.Time.IsZero() {
+					return fmt.Errorf("got %#v", q)
+				}
+				if !d.End.Time.Equal(dslNow) {
+					return fmt.Errorf("expected it to end now, got %s", d.End.Time)
+				}
+				return nil
+			}},
+		{"modified after", `{"modified": {"after": "now-2w"}}`,
+			func(q query.Query) error {
+				d, ok := q.(*query.DateRangeQuery)
+				if !ok || !d.Start.Time.Equal(dslNow.Add(-14*24*time.Hour)) {
+					return fmt.Errorf("got %#v", q)
+				}
+				return nil
+			}},
+		{"match_all", `{"match_all": {}}`,
+			func(q query.Query) error {
+				if _, ok := q.(*query.MatchAllQuery); !ok {
+					return fmt.Errorf("got %#v", q)
+				}
+				return nil
+			}},
+		{"bool", `{"bool": {"must": [{"match_all": {}}], "should": [{"match_all": {}}, {"match_all": {}}], "must_not": [{"match_all": {}}], "min_should": 2}}`,
+			func(q query.Query) error {
+				b, ok := q.(*query.BooleanQuery)
+				if !ok || b.Must == nil || b.Should == nil || b.MustNot == nil {
+					return fmt.Errorf("got %#v", q)
+				}
+				if n := len(b.Should.(*query.DisjunctionQuery).Disjuncts); n != 2 {
+					return fmt.Errorf("expected 2 should clauses, got %d", n)
+				}
+				if min := b.Should.(*query.DisjunctionQuery).Min; min != 2 {
+					return fmt.Errorf("expected min_should of 2, got %v", min)
+				}
+				return nil
+			}},
+		{"bool should only", `{"bool": {"should": [{"match_all": {}}]}}`,
+			func(q query.Query) error {
+				b, ok := q.(*query.BooleanQuery)
+				if !ok || b.Should.(*query.DisjunctionQuery).Min != 1 {
+					return fmt.Errorf("expected one should clause to have to match, got %#v", q)
+				}
+				return nil
+			}},
+		{"bool must_not only", `{"bool": {"must_not": [{"term": {"term": "archived", "field": "tags"}}]}}`,
+			func(q query.Query) error {
+				b, ok := q.(*query.BooleanQuery)
+				if !ok || b.Must == nil {
+					return fmt.Errorf("expected every page to be matched first, got %#v", q)
+				}
+				return nil
+			}},
+		{"contents", `{"match": {"text": "deploy", "field": "contents"}}`,
+			func(q query.Query) error {
+				d, ok := q.(*query.DisjunctionQuery)
+				if !ok || len(d.Disjuncts) != len(ContentFields) {
+					return fmt.Errorf("expected a clause for every language, got %#v", q)
+				}
+				for n, dq := range d.Disjuncts {
+					if field(dq) != ContentFields[n] {
+						return fmt.Errorf("expected %s, got %s", ContentFields[n], field(dq))
+					}
+				}
+				return nil
+			}},
+		{"default fields", `{"match": {"text": "deploy"}}`,
+			func(q query.Query) error {
+				d, ok := q.(*query.DisjunctionQuery)
+				if !ok || len(d.Disjuncts) != len(dslDefaultBoosts) {
+					return fmt.Errorf("expected a clause for every default field, got %#v", q)
+				}
+				if field(d.Disjuncts[1]) != "metadata.tags" || field(d.Disjuncts[2]) != "metadata.title" {
+					return fmt.Errorf("expected the fields in order, got %#v", d.Disjuncts)
+				}
+				return nil
+			}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			req := parseDSL(t, `{"query": `+c.query+`}`)
+			err := c.check(req.Query)
+			if err != nil {
+				t.Error(err)
+			}
+		})
+	}
+
+}
+
+func TestDSLBoosts(t *testing.T) {
+
+	req := parseDSL(t, `{"query": {"match": {"text": "deploy"}}, "boosts": {"title": 3, "contents": 0.5}}`)
+
+	d, ok := req.Query.(*query.DisjunctionQuery)
+	if !ok || len(d.Disjuncts) != 2 {
+		t.Fatalf("expected a clause for each boosted field, got %#v", req.Query)
+	}
+
+	contents := d.Disjuncts[0].(*query.DisjunctionQuery)
+	title := d.Disjuncts[1].(*query.MatchQuery)
+	if contents.Boost() != 0.5 || title.Boost() != 3 || title.FieldVal != "metadata.title" {
+		t.Errorf("expected the fields to be weighted, got %#v", d.Disjuncts)
+	}
+
+}
+
+func TestDSLRequest(t *testing.T) {
+
+	req := parseDSL(t, `{}`)
+	if _, ok := req.Query.(*query.MatchAllQuery); !ok {
+		t.Errorf("expected every page to match, got %#v", req.Query)
+	}
+	if req.Size != 10 || req.From != 0 || req.Highlight == nil {
+		t.Errorf("expected the defaults, got %#v", req)
+	}
+
+	req = parseDSL(t, `{"size": 0, "from": 20, "highlight": false}`)
+	if req.Size != 0 || req.From != 20 || req.Highlight != nil {
+		t.Errorf("expected the options to be used, got %#v", req)
+	}
+
+}
+
+func TestDSLSort(t *testing.T) {
+
+	cases := map[string][]string{
+		`["-_score"]`:               {"-_score"},
+		`["title", "-modified"]`:    {"metadata.title", "-metadata.modified"},
+		`["metadata.title", "_id"]`: {"metadata.title", "_id"},
+	}
+
+	for sort, want := range cases {
+		req := parseDSL(t, `{"sort": `+sort+`}`)
+		expected := bleve.NewSearchRequest(nil)
+		expected.SortBy(want)
+		if !reflect.DeepEqual(req.Sort, expected.Sort) {
+			t.Errorf("sort %s: expected %v, got %v", sort, expected.Sort, req.Sort)
+		}
+	}
+
+}
+
+func TestDSLFacets(t *testing.T) {
+
+	req := parseDSL(t, `{"facets": {
+		"tags": {"field": "tags", "size": 5},
+		"recent": {"field": "modified", "ranges": [
+			{"name": "this week", "after": "now-1w"},
+			{"name": "older", "before": "now-1w"}
+		]}
+	}}`)
+
+	tags := req.Facets["tags"]
+	if tags == nil || tags.Field != "metadata.tags" || tags.Size != 5 {
+		t.Errorf("expected a tags facet, got %#v", tags)
+	}
+
+	recent := req.Facets["recent"]
+	if recent == nil || recent.Field != "metadata.modified" || len(recent.DateTimeRanges) != 2 {
+		t.Fatalf("expected a facet with 2 date ranges, got %#v", recent)
+	}
+	if recent.DateTimeRanges[0].Name != "this week" || recent.DateTimeRanges[1].Name != "older" {
+		t.Errorf("expected the ranges in order, got %#v", recent.DateTimeRanges)
+	}
+
+}
+
+func TestDSLErrors(t *testing.T) {
+
+	cases := []struct {
+		request string
+		path    string
+	}{
+		{`{`, ""},
+		{`[]`, ""},
+		{`{"nope": 1}`, "nope"},
+
+		// Clauses
+		{`{"query": []}`, "query"},
+		{`{"query": {}}`, "query"},
+		{`{"query": {"match_all": {}, "term": {}}}`, "query"},
+		{`{"query": {"nope": {}}}`, "query.nope"},
+		{`{"query": {"match_all": {"boost": 2}}}`, "query.match_all.boost"},
+		{`{"query": {"bool": {"must": [{"match_all": {}}, {"fuzzy": {"term": "x", "fuzziness": 3}}]}}}`,
+			"query.bool.must[1].fuzzy.fuzziness"},
+		{`{"query": {"bool": {"should": [{"bool": {"must_not": [{"match": {}}]}}]}}}`,
+			"query.bool.should[0].bool.must_not[0].match.text"},
+		{`{"query": {"bool": {}}}`, "query.bool"},
+		{`{"query": {"bool": {"must": {}}}}`, "query.bool.must"},
+		{`{"query": {"bool": {"should": [{"match_all": {}}], "min_should": 2}}}`, "query.bool.min_should"},
+		{`{"query": {"bool": {"must": [{"match_all": {}}], "boost": 0}}}`, "query.bool.boost"},
+		{`{"query": {"match": {"text": ""}}}`, "query.match.text"},
+		{`{"query": {"match": {"text": 1}}}`, "query.match.text"},
+		{`{"query": {"match": {"text": "x", "operator": "xor"}}}`, "query.match.operator"},
+		{`{"query": {"match": {"text": "x", "fuzziness": 3}}}`, "query.match.fuzziness"},
+		{`{"query": {"match": {"text": "x", "fuzziness": 1.5}}}`, "query.match.fuzziness"},
+		{`{"query": {"match": {"text": "x", "field": "body"}}}`, "query.match.field"},
+		{`{"query": {"match": {"text": "x", "field": "modified"}}}`, "query.match.field"},
+		{`{"query": {"match": {"text": "x", "boost": "high"}}}`, "query.match.boost"},
+		{`{"query": {"match": {"text": "x", "slop": 1}}}`, "query.match.slop"},
+		{`{"query": {"phrase": {}}}`, "query.phrase.text"},
+		{`{"query": {"fuzzy": {"term": "x", "fuzziness": 0}}}`, "query.fuzzy.fuzziness"},
+		{`{"query": {"fuzzy": {"term": "x", "prefix": -1}}}`, "query.fuzzy.prefix"},
+		{`{"query": {"prefix": {"prefix": ""}}}`, "query.prefix.prefix"},
+		{`{"query": {"regexp": {"regexp": "("}}}`, "query.regexp.regexp"},
+		{`{"query": {"term": {"term": "x", "field": "nope"}}}`, "query.term.field"},
+		{`{"query": {"modified": {}}}`, "query.modified"},
+		{`{"query": {"modified": {"after": "yesterday"}}}`, "query.modified.after"},
+		{`{"query": {"modified": {"after": "now", "before": "now-1d"}}}`, "query.modified"},
+
+		// Boosts
+		{`{"boosts": {}}`, "boosts"},
+		{`{"boosts": {"modified": 1}}`, "boosts.modified"},
+		{`{"boosts": {"title": 0}}`, "boosts.title"},
+		{`{"boosts": {"title": "3"}}`, "boosts.title"},
+
+		// Paging and highlighting
+		{`{"size": 1001}`, "size"},
+		{`{"size": -1}`, "size"},
+		{`{"size": "10"}`, "size"},
+		{`{"from": -1}`, "from"},
+		{`{"highlight": "yes"}`, "highlight"},
+
+		// Sorting
+		{`{"sort": "title"}`, "sort"},
+		{`{"sort": ["title", 1]}`, "sort[1]"},
+		{`{"sort": ["contents"]}`, "sort[0]"},
+		{`{"sort": ["-tags"]}`, "sort[0]"},
+		{`{"sort": ["nope"]}`, "sort[0]"},
+
+		// Facets
+		{`{"facets": []}`, "facets"},
+		{`{"facets": {"x": {}}}`, "facets.x.field"},
+		{`{"facets": {"x": {"field": "nope"}}}`, "facets.x.field"},
+		{`{"facets": {"x": {"field": "tags", "size": 0}}}`, "facets.x.size"},
+		{`{"facets": {"x": {"field": "tags", "order": "count"}}}`, "facets.x.order"},
+		{`{"facets": {"x": {"field": "modified"}}}`, "facets.x"},
+		{`{"facets": {"x": {"field": "tags", "ranges": []}}}`, "facets.x.ranges"},
+		{`{"facets": {"x": {"field": "modified", "ranges": []}}}`, "facets.x.ranges"},
+		{`{"facets": {"x": {"field": "modified", "ranges": [{"after": "now-1d"}]}}}`, "facets.x.ranges[0].name"},
+		{`{"facets": {"x": {"field": "modified", "ranges": [{"name": "a", "after": "now-1d"}, {"name": "b"}]}}}`,
+			"facets.x.ranges[1]"},
+	}
+
+	for _, c := range cases {
+		_, err := ParseDSL([]byte(c.request), dslNow)
+		dslErr, ok := err.(*DSLError)
+		if !ok {
+			t.Errorf("%s: expected a DSLError, got %v", c.request, err)
+			continue
+		}
+		if dslErr.Path != c.path {
+			t.Errorf("%s: expected the error at %q, got %q (%s)", c.request, c.path, dslErr.Path, dslErr.Message)
+		}
+	}
+
+}
+
+// nested returns a query with clauses nested depth deep
+func nested(depth int) string {
+	return strings.Repeat(`{"bool": {"must": [`, depth) + `{"match_all": {}}` +
+		strings.Repeat(`]}}`, depth)
+}
+
+// clauses returns a query with n clauses
+func clauses(n int) string {
+	items := make([]string, n-1)
+	for i := range items {
+		items[i] = `{"match_all": {}}`
+	}
+	return `{"bool": {"should": [` + strings.Join(items, ",") + `]}}`
+}
+
+func TestDSLLimits(t *testing.T) {
+
+	parseDSL(t, `{"query": `+nested(dslMaxDepth)+`}`)
+
+	_, err := ParseDSL([]byte(`{"query": `+nested(dslMaxDepth+1)+`}`), dslNow)
+	dslErr, ok := err.(*DSLError)
+	if !ok || !strings.Contains(dslErr.Message, "nested") {
+		t.Errorf("expected clauses nested too deep to be refused, got %v", err)
+	}
+	if ok && strings.Count(dslErr.Path, "bool.must[0]") != dslMaxDepth+1 {
+		t.Errorf("expected the error at the clause that's too deep, got %s", dslErr.Path)
+	}
+
+	parseDSL(t, `{"query": `+clauses(dslMaxClauses)+`}`)
+
+	_, err = ParseDSL([]byte(`{"query": `+clauses(dslMaxClauses+1)+`}`), dslNow)
+	dslErr, ok = err.(*DSLError)
+	if !ok || !strings.Contains(dslErr.Message, "clauses") {
+		t.Errorf("expected too many clauses to be refused, got %v", err)
+	}
+	if ok && dslErr.Path != fmt.Sprintf("query.bool.should[%d]", dslMaxClauses-1) {
+		t.Errorf("expected the error at the clause that's one too many, got %s", dslErr.Path)
+	}
+
+}
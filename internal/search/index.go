@@ -2,25 +2,42 @@ package search
 
 import (
 	"os"
+	"strconv"
+	"sync"
 
 	"github.com/blevesearch/bleve"
 	"github.com/idrum4316/devpad-server/internal/page"
 )
 
-// Index is the search index
+// Index is the search index. The bleve index behind it can be rebuilt and
+// swapped out while it's being used.
 type Index struct {
-	index bleve.Index
+	mu       sync.RWMutex
+	index    bleve.Index
+	path     string
+	analysis *Analysis
+
+	// Pages that change while the index is being rebuilt, to be applied to
+	// the new index before it's swapped in. Deleted pages are nil.
+	rebuildMu sync.Mutex
+	rebuild   *RebuildStatus
+	changed   map[string]*page.Page
 }
 
-// NewIndex returns a new Index instance
-func NewIndex(path string) (*Index, error) {
+// NewIndex returns a new Index instance. New indexes analyze the contents of
+// pages as configured in a, while an existing index keeps the analysis it
+// was built with until it's rebuilt.
+func NewIndex(path string, a *Analysis) (*Index, error) {
+
+	err := a.Check()
+	if err != nil {
+		return nil, err
+	}
 
 	var index bleve.Index
-	var err error
 
-	if _, err := os.Stat(path); os.IsNotExist(err) {
-		mapping := NewPageMapping()
-		index, err = bleve.New(path, mapping)
+	if _, statErr := os.Stat(path); os.IsNotExist(statErr) {
+		index, err = newBleveIndex(path, a)
 	} else {
 		index, err = bleve.Open(path)
 	}
@@ -30,15 +47,86 @@ func NewIndex(path string) (*Index, error) {
 	}
 
 	i := Index{
-		index: index,
+		index:    index,
+		path:     path,
+		analysis: a,
+		rebuild:  &RebuildStatus{},
 	}
 
 	return &i, nil
 
 }
 
+// mappingVersionKey is where the mapping version is kept in the index
+var mappingVersionKey = []byte("devpad_mapping_version")
+
+// newBleveIndex creates a bleve index at path with the current mapping and
+// analysis
+func newBleveIndex(path string, a *Analysis) (bleve.Index, error) {
+
+	m, err := NewPageMapping(a)
+	if err != nil {
+		return nil, err
+	}
+
+	index, err := bleve.New(path, m)
+	if err != nil {
+		return nil, err
+	}
+
+	err = index.SetInternal(mappingVersionKey, []byte(strconv.Itoa(MappingVersion)))
+	if err != nil {
+		index.Close()
+		return nil, err
+	}
+
+	err = index.SetInternal(analysisKey, []byte(a.Fingerprint()))
+	if err != nil {
+		index.Close()
+		return nil, err
+	}
+
+	return index, nil
+
+}
+
+// Outdated returns why the index should be rebuilt, or "" if it shouldn't.
+// Indexes built with an older mapping don't have everything searchable, and
+// ones built with other synonyms or stop words don't match what's searched
+// for the way they should.
+func (i *Index) Outdated() (string, error) {
+
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	v, err := i.index.GetInternal(mappingVersionKey)
+	if err != nil {
+		return "", err
+	}
+
+	// Indexes from before versions were kept have none
+	version, _ := strconv.Atoi(string(v))
+	if version < MappingVersion {
+		return "it was built by an older version", nil
+	}
+
+	fingerprint, err := i.index.GetInternal(analysisKey)
+	if err != nil {
+		return "", err
+	}
+	if string(fingerprint) != i.analysis.Fingerprint() {
+		return "the synonyms or stop words have changed", nil
+	}
+
+	return "", nil
+
+}
+
 // Close the bleve database
 func (i *Index) Close() error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
 	err := i.index.Close()
 	return err
 }
@@ -46,6 +134,9 @@ func (i *Index) Close() error {
 // ExecuteSearch executes the search query in the index and returns the result
 func (i *Index) ExecuteSearch(r *bleve.SearchRequest) (*bleve.SearchResult, error) {
 
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
 	result, err := i.index.Search(r)
 	return result, err
 
@@ -54,18 +145,124 @@ func (i *Index) ExecuteSearch(r *bleve.SearchRequest) (*bleve.SearchResult, erro
 // IndexPage adds or updates the page in the index
 func (i *Index) IndexPage(id string, p *page.Page) error {
 
-	// Remove all html tags from the page before indexing
-	p.Contents = htmlPolicy.Sanitize(p.Contents)
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	i.changedDuringRebuild(id, p)
 
-	err := i.index.Index(id, p)
+	err := i.index.Index(id, newDocument(id, p))
 	return err
 
 }
 
+// IndexPages adds or updates many pages in one batch, which is much faster
+// than indexing them one at a time. Pages that are nil are removed.
+func (i *Index) IndexPages(pages map[string]*page.Page) error {
+
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	batch := i.index.NewBatch()
+	for id, p := range pages {
+		i.changedDuringRebuild(id, p)
+		if p == nil {
+			batch.Delete(id)
+			continue
+		}
+		err := batch.Index(id, newDocument(id, p))
+		if err != nil {
+			return err
+		}
+	}
+
+	return i.index.Batch(batch)
+
+}
+
 // DeletePage removes a page from the search index
 func (i *Index) DeletePage(id string) error {
 
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	i.changedDuringRebuild(id, nil)
 	err := i.index.Delete(id)
 	return err
 
 }
+
+// HasPage returns true if the page is in the search index
+func (i *Index) HasPage(id string) (bool, error) {
+
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	doc, err := i.index.Document(id)
+	if err != nil {
+		return false, err
+	}
+
+	return doc != nil, nil
+
+}
+
+// PageIDs returns the id of every page in the search index
+func (i *Index) PageIDs() ([]string, error) {
+
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	ids := []string{}
+	pageSize := 1000
+
+	for {
+		req := bleve.NewSearchRequestOptions(bleve.NewMatchAllQuery(), pageSize, len(ids), false)
+		req.SortBy([]string{"_id"})
+
+		result, err := i.index.Search(req)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, hit := range result.Hits {
+			ids = append(ids, hit.ID)
+		}
+
+		if len(result.Hits) < pageSize {
+			return ids, nil
+		}
+	}
+
+}
+
+// ContentHashes returns the content hash of every page in the search index.
+// Pages indexed before hashes were kept have an empty hash.
+func (i *Index) ContentHashes() (map[string]string, error) {
+
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	hashes := map[string]string{}
+	pageSize := 1000
+
+	for {
+		req := bleve.NewSearchRequestOptions(bleve.NewMatchAllQuery(), pageSize, len(hashes), false)
+		req.SortBy([]string{"_id"})
+		req.Fields = []string{"content_hash"}
+
+		result, err := i.index.Search(req)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, hit := range result.Hits {
+			hash, _ := hit.Fields["content_hash"].(string)
+			hashes[hit.ID] = hash
+		}
+
+		if len(result.Hits) < pageSize {
+			return hashes, nil
+		}
+	}
+
+}
@@ -0,0 +1,225 @@
+package search
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/idrum4316/devpad-server/internal/page"
+	"github.com/idrum4316/devpad-server/internal/storage"
+)
+
+// Indexer applies the jobs in an Outbox to the index in the background, in
+// batches. Pages are read again when their jobs are applied, so a page that
+// changed several times is only indexed once, as it is by then. Batches that
+// fail stay in the outbox and are retried with exponential backoff.
+type Indexer struct {
+	Outbox       storage.Outbox
+	Index        *Index
+	GetPage      func(id string) (*page.Page, error)
+	BatchSize    int
+	PollInterval time.Duration
+	BaseBackoff  time.Duration
+	MaxBackoff   time.Duration
+
+	mu     sync.Mutex
+	status IndexerStatus
+
+	// Only one batch is applied at a time
+	runMu sync.Mutex
+
+	wake chan struct{}
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// IndexerStatus is what the indexer has done
+type IndexerStatus struct {
+	Pending             int        `json:"pending"`
+	Indexed             int        `json:"indexed"`
+	LastIndexed         *time.Time `json:"last_indexed"`
+	LastFailure         *time.Time `json:"last_failure"`
+	LastError           string     `json:"last_error,omitempty"`
+	Failures            int        `json:"failures"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+}
+
+// NewIndexer returns a new Indexer with default values set
+func NewIndexer(o storage.Outbox, index *Index, getPage func(id string) (*page.Page, error)) *Indexer {
+	return &Indexer{
+		Outbox:       o,
+		Index:        index,
+		GetPage:      getPage,
+		BatchSize:    200,
+		PollInterval: 5 * time.Second,
+		BaseBackoff:  time.Second,
+		MaxBackoff:   5 * time.Minute,
+		wake:         make(chan struct{}, 1),
+	}
+}
+
+// Notify lets the worker know that jobs were queued, without blocking
+func (i *Indexer) Notify() {
+	select {
+	case i.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Start runs the worker in the background until Stop is called. Jobs left
+// over from before are applied first.
+func (i *Indexer) Start() {
+
+	i.stop = make(chan struct{})
+	i.wg.Add(1)
+
+	go func() {
+		defer i.wg.Done()
+
+		for {
+			wait := i.PollInterval
+
+			err := i.Flush()
+			if err != nil {
+				log.Println("indexer:", err)
+				wait = i.backoff()
+			}
+
+			timer := time.NewTimer(wait)
+			if err != nil {
+				// Jobs queued in the meantime wait for the retry
+				select {
+				case <-i.stop:
+					timer.Stop()
+					return
+				case <-timer.C:
+				}
+				continue
+			}
+
+			select {
+			case <-i.stop:
+				timer.Stop()
+				return
+			case <-i.wake:
+				timer.Stop()
+			case <-timer.C:
+			}
+		}
+	}()
+
+}
+
+// Stop stops the worker and waits for it to finish the batch it's applying
+func (i *Indexer) Stop() {
+	if i.stop == nil {
+		return
+	}
+	close(i.stop)
+	i.wg.Wait()
+	i.stop = nil
+}
+
+// Flush applies batches until the outbox is empty
+func (i *Indexer) Flush() error {
+	for {
+		n, err := i.ProcessPending()
+		if err != nil || n < i.BatchSize {
+			return err
+		}
+	}
+}
+
+// ProcessPending applies one batch of jobs to the index, and returns how many
+// jobs it applied
+func (i *Indexer) ProcessPending() (int, error) {
+
+	i.runMu.Lock()
+	defer i.runMu.Unlock()
+
+	jobs, err := i.Outbox.PendingIndexJobs(i.BatchSize)
+	if err == nil && len(jobs) > 0 {
+		err = i.apply(jobs)
+	}
+	if err == nil && len(jobs) > 0 {
+		err = i.Outbox.CompleteIndexJobs(jobs)
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	now := time.Now()
+	if err != nil {
+		i.status.LastFailure = &now
+		i.status.LastError = err.Error()
+		i.status.Failures++
+		i.status.ConsecutiveFailures++
+		return 0, err
+	}
+
+	i.status.LastError = ""
+	i.status.ConsecutiveFailures = 0
+	if len(jobs) > 0 {
+		i.status.Indexed += len(jobs)
+		i.status.LastIndexed = &now
+	}
+
+	return len(jobs), nil
+
+}
+
+// apply indexes the pages the jobs are for as they are now, and removes the
+// ones that no longer exist
+func (i *Indexer) apply(jobs []*storage.Job) error {
+
+	pages := map[string]*page.Page{}
+	for _, job := range jobs {
+		if _, ok := pages[job.PageID]; ok {
+			continue
+		}
+		p, err := i.GetPage(job.PageID)
+		if err != nil {
+			return err
+		}
+		pages[job.PageID] = p
+	}
+
+	return i.Index.IndexPages(pages)
+
+}
+
+// backoff returns how long to wait before retrying after the failures so far
+func (i *Indexer) backoff() time.Duration {
+
+	i.mu.Lock()
+	failures := i.status.ConsecutiveFailures
+	i.mu.Unlock()
+
+	wait := i.BaseBackoff
+	for n := 1; n < failures; n++ {
+		wait *= 2
+		if wait >= i.MaxBackoff {
+			return i.MaxBackoff
+		}
+	}
+	return wait
+
+}
+
+// Status returns what the indexer has done, along with how many jobs are
+// waiting. Pending is -1 if they can't be counted.
+func (i *Indexer) Status() IndexerStatus {
+
+	i.mu.Lock()
+	status := i.status
+	i.mu.Unlock()
+
+	pending, err := i.Outbox.CountIndexJobs()
+	if err != nil {
+		pending = -1
+	}
+	status.Pending = pending
+
+	return status
+
+}
@@ -0,0 +1,147 @@
+package search
+
+import (
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/idrum4316/devpad-server/internal/memstore"
+	"github.com/idrum4316/devpad-server/internal/page"
+)
+
+func newTestIndexer(t *testing.T, store *memstore.MemStore,
+	getPage func(id string) (*page.Page, error)) *Indexer {
+
+	index, err := NewIndex(filepath.Join(t.TempDir(), "index"), &Analysis{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { index.Close() })
+
+	return NewIndexer(store, index, getPage)
+
+}
+
+func expectIndexed(t *testing.T, i *Indexer, ids map[string]bool) {
+	for id, want := range ids {
+		has, err := i.Index.HasPage(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if has != want {
+			t.Errorf("expected page %s to be indexed: %v, got %v", id, want, has)
+		}
+	}
+}
+
+func TestIndexerCompletesAfterApplying(t *testing.T) {
+
+	store := memstore.New()
+	for _, id := range []string{"a", "b"} {
+		err := store.UpdatePage(page.New(), id)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := store.RenamePage("a", "c")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	failing := true
+	i := newTestIndexer(t, store, func(id string) (*page.Page, error) {
+		if failing {
+			return nil, errors.New("store unavailable")
+		}
+		return store.GetPage(id)
+	})
+
+	// Jobs that couldn't be applied stay in the outbox
+	n, err := i.ProcessPending()
+	if err == nil || n != 0 {
+		t.Fatalf("expected the batch to fail, got %d jobs applied and %v", n, err)
+	}
+	status := i.Status()
+	if status.Pending != 4 || status.ConsecutiveFailures != 1 || status.LastError == "" {
+		t.Fatalf("expected 4 pending jobs after one failure, got %+v", status)
+	}
+	expectIndexed(t, i, map[string]bool{"b": false, "c": false})
+
+	failing = false
+	err = i.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+	status = i.Status()
+	if status.Pending != 0 || status.Indexed != 4 || status.ConsecutiveFailures != 0 ||
+		status.Failures != 1 || status.LastError != "" {
+		t.Fatalf("expected every job to be applied, got %+v", status)
+	}
+	expectIndexed(t, i, map[string]bool{"a": false, "b": true, "c": true})
+
+}
+
+func TestIndexerBackoff(t *testing.T) {
+
+	i := newTestIndexer(t, memstore.New(), nil)
+	i.BaseBackoff = time.Second
+	i.MaxBackoff = 5 * time.Second
+
+	for failures, want := range map[int]time.Duration{
+		1:  time.Second,
+		2:  2 * time.Second,
+		3:  4 * time.Second,
+		4:  5 * time.Second,
+		10: 5 * time.Second,
+	} {
+		i.status.ConsecutiveFailures = failures
+		if got := i.backoff(); got != want {
+			t.Errorf("after %d failures, expected to wait %s, got %s", failures, want, got)
+		}
+	}
+
+}
+
+func TestIndexerRetries(t *testing.T) {
+
+	store := memstore.New()
+	err := store.UpdatePage(page.New(), "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The first two batches fail
+	var mu sync.Mutex
+	calls := 0
+	i := newTestIndexer(t, store, func(id string) (*page.Page, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		if calls <= 2 {
+			return nil, errors.New("store unavailable")
+		}
+		return store.GetPage(id)
+	})
+	i.BaseBackoff = 10 * time.Millisecond
+	i.PollInterval = time.Hour
+
+	i.Start()
+	deadline := time.Now().Add(5 * time.Second)
+	for i.Status().Pending != 0 {
+		if time.Now().After(deadline) {
+			i.Stop()
+			t.Fatal("the failed batch wasn't retried")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	i.Stop()
+
+	status := i.Status()
+	if status.Failures != 2 || status.ConsecutiveFailures != 0 || status.Indexed != 1 {
+		t.Fatalf("expected two failures before the job was applied, got %+v", status)
+	}
+	expectIndexed(t, i, map[string]bool{"a": true})
+
+}
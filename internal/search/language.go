@@ -0,0 +1,155 @@
+package search
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/blevesearch/bleve"
+	"github.com/blevesearch/bleve/analysis/lang/cjk"
+	"github.com/blevesearch/bleve/analysis/lang/ckb"
+	"github.com/blevesearch/bleve/analysis/lang/de"
+	"github.com/blevesearch/bleve/analysis/lang/es"
+	"github.com/blevesearch/bleve/analysis/lang/fr"
+	"github.com/blevesearch/bleve/analysis/lang/hi"
+	"github.com/blevesearch/bleve/analysis/lang/it"
+	"github.com/blevesearch/bleve/analysis/lang/pt"
+	"github.com/blevesearch/bleve/search/query"
+)
+
+// The contents of pages in a language with its own analyzer are indexed
+// again under this document, in a field named after the analyzer, like
+// "localized.de"
+const localizedPrefix = "localized."
+
+// languageAnalyzers are the analyzers for the languages pages can be written
+// in, by the primary subtag of their language tag. Pages in other languages
+// are only analyzed as English.
+var languageAnalyzers = map[string]string{
+	"ckb": ckb.AnalyzerName,
+	"de":  de.AnalyzerName,
+	"es":  es.AnalyzerName,
+	"fr":  fr.AnalyzerName,
+	"hi":  hi.AnalyzerName,
+	"it":  it.AnalyzerName,
+	"ja":  cjk.AnalyzerName,
+	"ko":  cjk.AnalyzerName,
+	"pt":  pt.AnalyzerName,
+	"zh":  cjk.AnalyzerName,
+}
+
+// ContentFields are the fields the contents of pages are indexed under: the
+// stored contents, analyzed as English, and a field for each language
+// analyzer
+var ContentFields = contentFields()
+
+func contentFields() []string {
+
+	localized := []string{}
+	seen := map[string]bool{}
+	for _, name := range languageAnalyzers {
+		if !seen[name] {
+			seen[name] = true
+			localized = append(localized, localizedPrefix+name)
+		}
+	}
+	sort.Strings(localized)
+
+	return append([]string{"contents"}, localized...)
+
+}
+
+// languageAnalyzer returns the analyzer for a language tag like "de" or
+// "pt-BR", or "" if the language doesn't have one
+func languageAnalyzer(lang string) string {
+
+	lang = strings.ToLower(strings.TrimSpace(lang))
+	if i := strings.IndexAny(lang, "-_"); i >= 0 {
+		lang = lang[:i]
+	}
+
+	return languageAnalyzers[lang]
+
+}
+
+// NewQueryStringQuery returns a query for a query string like the ones
+// bleve takes, except that words without a field also search the contents
+// in every language, each analyzed the way that language's contents are.
+// Query strings that can't be parsed are left for the search to report.
+func NewQueryStringQuery(s string) query.Query {
+
+	qs := bleve.NewQueryStringQuery(s)
+	q, err := qs.Parse()
+	if err != nil {
+		return qs
+	}
+
+	return expandContents(q)
+
+}
+
+// expandContents rewrites the text queries without a field in a parsed query
+// string, so they search every content field as well as the catch-all field
+func expandContents(q query.Query) query.Query {
+
+	switch q := q.(type) {
+	case *query.BooleanQuery:
+		if q.Must != nil {
+			q.Must = expandContents(q.Must)
+		}
+		if q.Should != nil {
+			q.Should = expandContents(q.Should)
+		}
+		if q.MustNot != nil {
+			q.MustNot = expandContents(q.MustNot)
+		}
+		return q
+
+	case *query.ConjunctionQuery:
+		for i, c := range q.Conjuncts {
+			q.Conjuncts[i] = expandContents(c)
+		}
+		return q
+
+	case *query.DisjunctionQuery:
+		for i, d := range q.Disjuncts {
+			q.Disjuncts[i] = expandContents(d)
+		}
+		return q
+
+	case *query.MatchQuery:
+		if q.FieldVal != "" {
+			return q
+		}
+		return contentDisjunction(q, func(field string) query.Query {
+			fq := *q
+			fq.FieldVal = field
+			return &fq
+		})
+
+	case *query.MatchPhraseQuery:
+		if q.FieldVal != "" {
+			return q
+		}
+		return contentDisjunction(q, func(field string) query.Query {
+			fq := *q
+			fq.FieldVal = field
+			return &fq
+		})
+	}
+
+	return q
+
+}
+
+// contentDisjunction returns a query matching q, or a copy of it built for
+// any of the content fields
+func contentDisjunction(q query.Query, build func(field string) query.Query) query.Query {
+
+	queries := []query.Query{q}
+	for _, field := range ContentFields {
+		queries = append(queries, build(field))
+	}
+
+	return bleve.NewDisjunctionQuery(queries...)
+
+}
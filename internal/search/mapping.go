@@ -1,34 +1,116 @@
 package search
 
 import (
+	"strings"
+
 	"github.com/blevesearch/bleve"
+	"github.com/blevesearch/bleve/analysis/analyzer/custom"
 	"github.com/blevesearch/bleve/analysis/analyzer/keyword"
+	"github.com/blevesearch/bleve/analysis/token/edgengram"
+	"github.com/blevesearch/bleve/analysis/token/lowercase"
+	"github.com/blevesearch/bleve/analysis/tokenizer/unicode"
 	"github.com/blevesearch/bleve/mapping"
 )
 
-// NewPageMapping creates the Bleve mapping for a page structure
-func NewPageMapping() *mapping.IndexMappingImpl {
+// MappingVersion changes whenever NewPageMapping or the indexed documents
+// change, so indexes built before can be found and rebuilt
+const MappingVersion = 3
+
+// Suggestions are indexed as every prefix of the words in titles and slugs,
+// and what's typed is matched against them as whole words
+const (
+	suggestAnalyzer      = "suggest"
+	suggestQueryAnalyzer = "suggest_query"
+	suggestEdgeNgram     = "suggest_edge_ngram"
+)
+
+// NewPageMapping creates the Bleve mapping for a page structure, with the
+// contents analyzed as configured
+func NewPageMapping(a *Analysis) (*mapping.IndexMappingImpl, error) {
+
+	m := bleve.NewIndexMapping()
+
+	err := addContentsAnalyzer(m, a)
+	if err != nil {
+		return nil, err
+	}
 
-	// Mapping for english fields
-	enFieldMapping := bleve.NewTextFieldMapping()
-	enFieldMapping.Analyzer = "en"
+	err = m.AddCustomTokenFilter(suggestEdgeNgram, map[string]interface{}{
+		"type": edgengram.Name,
+		"back": false,
+		"min":  1.0,
+		"max":  32.0,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.AddCustomAnalyzer(suggestAnalyzer, map[string]interface{}{
+		"type":          custom.Name,
+		"tokenizer":     unicode.Name,
+		"token_filters": []interface{}{lowercase.Name, suggestEdgeNgram},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.AddCustomAnalyzer(suggestQueryAnalyzer, map[string]interface{}{
+		"type":          custom.Name,
+		"tokenizer":     unicode.Name,
+		"token_filters": []interface{}{lowercase.Name},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Mapping for the contents
+	contentsFieldMapping := bleve.NewTextFieldMapping()
+	contentsFieldMapping.Analyzer = contentsAnalyzer
 
 	// Mapping for keyword fields
 	kwFieldMapping := bleve.NewTextFieldMapping()
 	kwFieldMapping.Analyzer = keyword.Name
 
+	// The content hash is only stored, to be read back
+	hashFieldMapping := bleve.NewTextFieldMapping()
+	hashFieldMapping.Analyzer = keyword.Name
+	hashFieldMapping.IncludeInAll = false
+	hashFieldMapping.IncludeTermVectors = false
+
+	// Suggestions are only searched
+	suggestFieldMapping := bleve.NewTextFieldMapping()
+	suggestFieldMapping.Analyzer = suggestAnalyzer
+	suggestFieldMapping.Store = false
+	suggestFieldMapping.IncludeInAll = false
+	suggestFieldMapping.IncludeTermVectors = false
+
+	// The contents of pages in other languages are also indexed with the
+	// analyzer for their language. They're only searched, and kept out of
+	// the catch-all field so words aren't counted twice there.
+	localizedMapping := bleve.NewDocumentMapping()
+	for _, field := range ContentFields[1:] {
+		fm := bleve.NewTextFieldMapping()
+		fm.Analyzer = strings.TrimPrefix(field, localizedPrefix)
+		fm.Store = false
+		fm.IncludeInAll = false
+		fm.IncludeTermVectors = false
+		localizedMapping.AddFieldMappingsAt(fm.Analyzer, fm)
+	}
+
 	// Set mapping for page.metadata
 	metadataMapping := bleve.NewDocumentMapping()
 	metadataMapping.AddFieldMappingsAt("tags", kwFieldMapping)
 
 	// Set mapping for page
 	pageMapping := bleve.NewDocumentMapping()
-	pageMapping.AddFieldMappingsAt("contents", enFieldMapping)
+	pageMapping.AddFieldMappingsAt("contents", contentsFieldMapping)
+	pageMapping.AddFieldMappingsAt("content_hash", hashFieldMapping)
+	pageMapping.AddFieldMappingsAt("suggest", suggestFieldMapping)
+	pageMapping.AddSubDocumentMapping("localized", localizedMapping)
 	pageMapping.AddSubDocumentMapping("metadata", metadataMapping)
 
-	m := bleve.NewIndexMapping()
 	m.DefaultMapping = pageMapping
 
-	return m
+	return m, nil
 
 }
@@ -0,0 +1,258 @@
+package search
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/blevesearch/bleve"
+	"github.com/idrum4316/devpad-server/internal/page"
+)
+
+// How many pages are indexed at a time when the index is rebuilt
+const rebuildBatchSize = 200
+
+// ErrRebuilding is returned when a rebuild is started while another one is
+// running
+var ErrRebuilding = errors.New("the index is already being rebuilt")
+
+// RebuildStatus is the progress of rebuilding the index
+type RebuildStatus struct {
+	Running  bool       `json:"running"`
+	Indexed  int        `json:"indexed"`
+	Started  *time.Time `json:"started"`
+	Finished *time.Time `json:"finished"`
+	Error    string     `json:"error,omitempty"`
+}
+
+// Rebuild builds a new index from the pages forEach goes through, with the
+// current mapping and analysis, and swaps it in for the old one. The index
+// can be used the whole time: searches use the old index until the new one is
+// ready, and pages that change in the meantime are applied to the new one
+// before it's swapped in. progress is called with the number of pages indexed
+// so far after every batch.
+func (i *Index) Rebuild(forEach func(fn func(id string, p *page.Page) error) error, progress func(indexed int)) error {
+
+	err := i.beginRebuild()
+	if err != nil {
+		return err
+	}
+
+	return i.endRebuild(i.rebuildIndex(forEach, progress))
+
+}
+
+// StartRebuild rebuilds the index like Rebuild, but in the background. done
+// is called with the result once it's finished.
+func (i *Index) StartRebuild(forEach func(fn func(id string, p *page.Page) error) error, done func(err error)) error {
+
+	err := i.beginRebuild()
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		err := i.endRebuild(i.rebuildIndex(forEach, nil))
+		if done != nil {
+			done(err)
+		}
+	}()
+
+	return nil
+
+}
+
+// beginRebuild marks the index as being rebuilt, and starts keeping track of
+// pages that change
+func (i *Index) beginRebuild() error {
+
+	i.rebuildMu.Lock()
+	defer i.rebuildMu.Unlock()
+
+	if i.rebuild.Running {
+		return ErrRebuilding
+	}
+
+	started := time.Now()
+	i.rebuild = &RebuildStatus{Running: true, Started: &started}
+	i.changed = map[string]*page.Page{}
+
+	return nil
+
+}
+
+// endRebuild records how a rebuild ended, and returns its error
+func (i *Index) endRebuild(err error) error {
+
+	i.rebuildMu.Lock()
+	defer i.rebuildMu.Unlock()
+
+	finished := time.Now()
+	i.rebuild.Running = false
+	i.rebuild.Finished = &finished
+	if err != nil {
+		i.rebuild.Error = err.Error()
+	}
+	i.changed = nil
+
+	return err
+
+}
+
+// RebuildProgress returns the progress of the running rebuild, or of the last
+// one if none is running
+func (i *Index) RebuildProgress() RebuildStatus {
+	i.rebuildMu.Lock()
+	defer i.rebuildMu.Unlock()
+	return *i.rebuild
+}
+
+// rebuildIndex builds the new index next to the old one, then swaps them
+func (i *Index) rebuildIndex(forEach func(fn func(id string, p *page.Page) error) error, progress func(indexed int)) error {
+
+	tmp := i.path + ".rebuild"
+	err := os.RemoveAll(tmp)
+	if err != nil {
+		return err
+	}
+
+	fresh, err := newBleveIndex(tmp, i.analysis)
+	if err != nil {
+		return err
+	}
+	discard := func() {
+		fresh.Close()
+		os.RemoveAll(tmp)
+	}
+
+	indexed := 0
+	batch := fresh.NewBatch()
+	flush := func() error {
+		err := fresh.Batch(batch)
+		if err != nil {
+			return err
+		}
+		indexed += batch.Size()
+		batch.Reset()
+
+		i.rebuildMu.Lock()
+		i.rebuild.Indexed = indexed
+		i.rebuildMu.Unlock()
+		if progress != nil {
+			progress(indexed)
+		}
+		return nil
+	}
+
+	err = forEach(func(id string, p *page.Page) error {
+		err := batch.Index(id, newDocument(id, p))
+		if err != nil || batch.Size() < rebuildBatchSize {
+			return err
+		}
+		return flush()
+	})
+	if err == nil {
+		err = flush()
+	}
+	if err != nil {
+		discard()
+		return err
+	}
+
+	// Nothing can use the index while it's being swapped, so nothing else
+	// changes in the meantime
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.rebuildMu.Lock()
+	changed := i.changed
+	i.changed = nil
+	i.rebuildMu.Unlock()
+
+	batch = fresh.NewBatch()
+	for id, p := range changed {
+		if p == nil {
+			batch.Delete(id)
+			continue
+		}
+		err = batch.Index(id, newDocument(id, p))
+		if err != nil {
+			discard()
+			return err
+		}
+	}
+	err = fresh.Batch(batch)
+	if err != nil {
+		discard()
+		return err
+	}
+
+	err = fresh.Close()
+	if err != nil {
+		os.RemoveAll(tmp)
+		return err
+	}
+
+	return i.swap(tmp)
+
+}
+
+// swap replaces the index with the one at dir. If that fails, the old index
+// is put back. The caller must hold the write lock.
+func (i *Index) swap(dir string) error {
+
+	old := i.path + ".old"
+	err := os.RemoveAll(old)
+	if err != nil {
+		return err
+	}
+
+	err = i.index.Close()
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(i.path, old)
+	if err != nil {
+		return i.reopen(err)
+	}
+
+	err = os.Rename(dir, i.path)
+	if err != nil {
+		os.Rename(old, i.path)
+		return i.reopen(err)
+	}
+
+	index, err := bleve.Open(i.path)
+	if err != nil {
+		os.RemoveAll(i.path)
+		os.Rename(old, i.path)
+		return i.reopen(err)
+	}
+	i.index = index
+
+	return os.RemoveAll(old)
+
+}
+
+// reopen opens the index at its path again after a swap failed, returning
+// the error that made it fail
+func (i *Index) reopen(cause error) error {
+	index, err := bleve.Open(i.path)
+	if err != nil {
+		return fmt.Errorf("%s; reopening the index: %s", cause, err)
+	}
+	i.index = index
+	return cause
+}
+
+// changedDuringRebuild remembers a page that changed while the index is being
+// rebuilt. p is nil if the page was deleted.
+func (i *Index) changedDuringRebuild(id string, p *page.Page) {
+	i.rebuildMu.Lock()
+	defer i.rebuildMu.Unlock()
+	if i.changed != nil {
+		i.changed[id] = p
+	}
+}
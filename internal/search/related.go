@@ -0,0 +1,201 @@
+package search
+
+import (
+	"math"
+	"sort"
+
+	"github.com/blevesearch/bleve"
+	"github.com/blevesearch/bleve/search/query"
+	"github.com/idrum4316/devpad-server/internal/page"
+)
+
+// How many of a page's words are used to find pages like it
+const relatedTerms = 25
+
+// RelatedPage is a page that's like another one
+type RelatedPage struct {
+	Slug  string   `json:"slug"`
+	Title string   `json:"title"`
+	Tags  []string `json:"tags"`
+	Score float64  `json:"score"`
+}
+
+// RelatedTerm is a word that's used to find related pages, weighted by how
+// distinctive it is of the page, and the field it's looked for in
+type RelatedTerm struct {
+	Term   string  `json:"term"`
+	Field  string  `json:"field"`
+	Weight float64 `json:"weight"`
+}
+
+// Related returns up to <size> pages like the page at id, most alike first,
+// and the words that were used to find them. The words are the page's most
+// distinctive, by TF-IDF: used often in the page, and in few other pages.
+// Pages that share its tags count as well. Pages in a language with its own
+// analyzer are also compared by their contents analyzed for that language.
+func (i *Index) Related(id string, p *page.Page, size int) ([]*RelatedPage, []*RelatedTerm, error) {
+
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	d := newDocument(id, p)
+	terms, err := i.distinctiveTerms("contents", d.Contents)
+	if err != nil {
+		return nil, nil, err
+	}
+	for analyzer, contents := range d.Localized {
+		localized, err := i.distinctiveTerms(localizedPrefix+analyzer, contents)
+		if err != nil {
+			return nil, nil, err
+		}
+		terms = append(terms, localized...)
+	}
+	terms = mostDistinctive(terms)
+
+	related := []*RelatedPage{}
+	queries := []query.Query{}
+	for _, t := range terms {
+		q := bleve.NewTermQuery(t.Term)
+		q.SetField(t.Field)
+		q.SetBoost(t.Weight)
+		queries = append(queries, q)
+	}
+
+	// A shared tag counts as much as the most distinctive word
+	tagWeight := 1.0
+	if len(terms) > 0 {
+		tagWeight = terms[0].Weight
+	}
+	for _, tag := range p.Metadata.Tags {
+		q := bleve.NewTermQuery(tag)
+		q.SetField("metadata.tags")
+		q.SetBoost(tagWeight)
+		queries = append(queries, q)
+	}
+
+	if len(queries) == 0 {
+		return related, terms, nil
+	}
+
+	q := bleve.NewBooleanQuery()
+	q.AddShould(queries...)
+	q.AddMustNot(bleve.NewDocIDQuery([]string{id}))
+
+	req := bleve.NewSearchRequestOptions(q, size, 0, false)
+	req.Fields = []string{"metadata.title", "metadata.tags"}
+
+	result, err := i.index.Search(req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, hit := range result.Hits {
+		title, _ := hit.Fields["metadata.title"].(string)
+		related = append(related, &RelatedPage{
+			Slug:  hit.ID,
+			Title: title,
+			Tags:  stringValues(hit.Fields["metadata.tags"]),
+			Score: hit.Score,
+		})
+	}
+
+	return related, terms, nil
+
+}
+
+// distinctiveTerms analyzes the contents the way they're indexed in field,
+// and returns the terms with their TF-IDF in that field. Terms no other page
+// has can't find anything, so they're left out.
+func (i *Index) distinctiveTerms(field, contents string) ([]*RelatedTerm, error) {
+
+	m := i.index.Mapping()
+	analyzer := m.AnalyzerNamed(m.AnalyzerNameForPath(field))
+
+	counts := map[string]int{}
+	for _, token := range analyzer.Analyze([]byte(contents)) {
+		counts[string(token.Term)]++
+	}
+
+	idx, _, err := i.index.Advanced()
+	if err != nil {
+		return nil, err
+	}
+	reader, err := idx.Reader()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	docs, err := reader.DocCount()
+	if err != nil {
+		return nil, err
+	}
+
+	terms := []*RelatedTerm{}
+	for term, count := range counts {
+		tfr, err := reader.TermFieldReader([]byte(term), field, false, false, false)
+		if err != nil {
+			return nil, err
+		}
+		df := tfr.Count()
+		tfr.Close()
+
+		if df < 2 {
+			continue
+		}
+
+		idf := math.Log(float64(docs) / float64(df))
+		if idf <= 0 {
+			continue
+		}
+
+		terms = append(terms, &RelatedTerm{
+			Term:   term,
+			Field:  field,
+			Weight: (1 + math.Log(float64(count))) * idf,
+		})
+	}
+
+	return terms, nil
+
+}
+
+// mostDistinctive returns the terms with the highest weight, highest first
+func mostDistinctive(terms []*RelatedTerm) []*RelatedTerm {
+
+	sort.Slice(terms, func(a, b int) bool {
+		if terms[a].Weight != terms[b].Weight {
+			return terms[a].Weight > terms[b].Weight
+		}
+		if terms[a].Term != terms[b].Term {
+			return terms[a].Term < terms[b].Term
+		}
+		return terms[a].Field < terms[b].Field
+	})
+	if len(terms) > relatedTerms {
+		terms = terms[:relatedTerms]
+	}
+
+	return terms
+
+}
+
+// stringValues returns a stored field as a list of strings. Fields with one
+// value come back from bleve as a string rather than a list.
+func stringValues(v interface{}) []string {
+
+	values := []string{}
+	switch v := v.(type) {
+	case string:
+		values = append(values, v)
+	case []interface{}:
+		for _, s := range v {
+			if s, ok := s.(string); ok {
+				values = append(values, s)
+			}
+		}
+	}
+
+	return values
+
+}
@@ -0,0 +1,55 @@
+package search
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/idrum4316/devpad-server/internal/page"
+)
+
+func TestRelatedUsesPageLanguage(t *testing.T) {
+
+	i, err := NewIndex(filepath.Join(t.TempDir(), "index"), &Analysis{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer i.Close()
+
+	newPage := func(lang, contents string) *page.Page {
+		p := page.New()
+		p.Metadata.Language = lang
+		p.Contents = contents
+		return p
+	}
+
+	// Only the German analyzer knows "Häuser" is the plural of "Haus"
+	pages := map[string]*page.Page{
+		"haeuser": newPage("de", "Die Häuser, die Häuser"),
+		"haus":    newPage("de", "Das Haus"),
+		"katze":   newPage("de", "Die Katze"),
+		"house":   newPage("en", "The house"),
+	}
+	err = i.IndexPages(pages)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	related, terms, err := i.Related("haeuser", pages["haeuser"], 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found := false
+	for _, term := range terms {
+		if term.Term == "haus" && term.Field == localizedPrefix+languageAnalyzer("de") {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("expected haus in the German contents to be a term, got %v", terms)
+	}
+	if len(related) == 0 || related[0].Slug != "haus" {
+		t.Errorf("expected haus to be the most related page, got %v", related)
+	}
+
+}
@@ -0,0 +1,110 @@
+package search
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/blevesearch/bleve/registry"
+)
+
+// How many keys are copied to a snapshot in each batch
+const snapshotBatchSize = 10000
+
+// Bleve keeps its settings in index_meta.json and its data in store, inside
+// of the index directory
+const (
+	indexMetaFile = "index_meta.json"
+	indexStoreDir = "store"
+)
+
+// SnapshotTo writes a consistent copy of the index to dir, which must not
+// exist yet. The index can keep being used while the copy is made, since it's
+// read in a single transaction. The copy can be opened with NewIndex.
+func (i *Index) SnapshotTo(dir string) error {
+
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	meta, err := ioutil.ReadFile(filepath.Join(i.path, indexMetaFile))
+	if err != nil {
+		return err
+	}
+	var m struct {
+		Storage string `json:"storage"`
+	}
+	err = json.Unmarshal(meta, &m)
+	if err != nil {
+		return err
+	}
+	newStore := registry.KVStoreConstructorByName(m.Storage)
+	if newStore == nil {
+		return fmt.Errorf("unknown index storage %q", m.Storage)
+	}
+
+	_, kv, err := i.index.Advanced()
+	if err != nil {
+		return err
+	}
+	reader, err := kv.Reader()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	err = os.Mkdir(dir, 0700)
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, indexMetaFile), meta, 0600)
+	if err != nil {
+		return err
+	}
+
+	// Nothing is merged while copying, so there's no need for a merge
+	// operator
+	dst, err := newStore(nil, map[string]interface{}{
+		"path": filepath.Join(dir, indexStoreDir),
+	})
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	writer, err := dst.Writer()
+	if err != nil {
+		return err
+	}
+	defer writer.Close()
+
+	it := reader.RangeIterator(nil, nil)
+	defer it.Close()
+
+	batch := writer.NewBatch()
+	defer batch.Close()
+	n := 0
+	for ; it.Valid(); it.Next() {
+		// The iterator reuses its buffers
+		k := append([]byte{}, it.Key()...)
+		v := append([]byte{}, it.Value()...)
+		batch.Set(k, v)
+
+		n++
+		if n == snapshotBatchSize {
+			err = writer.ExecuteBatch(batch)
+			if err != nil {
+				return err
+			}
+			batch.Reset()
+			n = 0
+		}
+	}
+
+	if n > 0 {
+		return writer.ExecuteBatch(batch)
+	}
+	return nil
+
+}
@@ -0,0 +1,52 @@
+package search
+
+import (
+	"strings"
+
+	"github.com/blevesearch/bleve"
+	"github.com/blevesearch/bleve/search/query"
+)
+
+// Suggestion is a page whose title or slug starts with what was typed
+type Suggestion struct {
+	Slug  string  `json:"slug"`
+	Title string  `json:"title"`
+	Score float64 `json:"score"`
+}
+
+// Suggest returns up to <size> pages with a word in their title or slug that
+// starts with each word of the text, best matches first. The last word can
+// be partly typed, and so can the others.
+func (i *Index) Suggest(text string, size int) ([]*Suggestion, error) {
+
+	suggestions := []*Suggestion{}
+	if strings.TrimSpace(text) == "" {
+		return suggestions, nil
+	}
+
+	q := bleve.NewMatchQuery(text)
+	q.SetField("suggest")
+	q.Analyzer = suggestQueryAnalyzer
+	q.SetOperator(query.MatchQueryOperatorAnd)
+
+	req := bleve.NewSearchRequestOptions(q, size, 0, false)
+	req.Fields = []string{"metadata.title"}
+	req.SortBy([]string{"-_score", "_id"})
+
+	result, err := i.ExecuteSearch(req)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, hit := range result.Hits {
+		title, _ := hit.Fields["metadata.title"].(string)
+		suggestions = append(suggestions, &Suggestion{
+			Slug:  hit.ID,
+			Title: title,
+			Score: hit.Score,
+		})
+	}
+
+	return suggestions, nil
+
+}
@@ -0,0 +1,428 @@
+package site
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"html/template"
+	"io"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/idrum4316/devpad-server/internal/archive"
+	"github.com/idrum4316/devpad-server/internal/page"
+	"github.com/idrum4316/devpad-server/internal/render"
+	"github.com/idrum4316/devpad-server/internal/storage"
+	"github.com/microcosm-cc/bluemonday"
+)
+
+// Options change how the site is built
+type Options struct {
+	// The title of the index page
+	Title string
+
+	// Sanitize the HTML of pages. Code blocks aren't highlighted when it's
+	// set.
+	Sanitize bool
+}
+
+// pageInfo is what the listings and the search index know about a page
+type pageInfo struct {
+	Slug  string
+	Title string
+	Tags  []string
+	Path  string
+
+	// Path as a relative URL, with the escapes in file names escaped again
+	URL string
+}
+
+// searchEntry is a page in the client-side search index
+type searchEntry struct {
+	URL   string   `json:"url"`
+	Title string   `json:"title"`
+	Tags  []string `json:"tags"`
+	Text  string   `json:"text"`
+}
+
+// builder keeps track of what has been written so far
+type builder struct {
+	zw      *zip.Writer
+	opts    Options
+	now     time.Time
+	pages   map[string]*pageInfo
+	tagPath map[string]string
+}
+
+// Build writes a static HTML site made from every page to w, as a zip
+// archive. Every page becomes a standalone HTML file in the pages folder,
+// laid out like the Markdown export, with links between pages rewritten to
+// relative paths. There's also an index page, a page for every tag in the
+// tags folder, the stylesheets and a search index (search.json) used by the
+// index page.
+func Build(w io.Writer, pages storage.PageStore, opts Options) error {
+
+	b := builder{
+		zw:      zip.NewWriter(w),
+		opts:    opts,
+		now:     time.Now(),
+		pages:   map[string]*pageInfo{},
+		tagPath: map[string]string{},
+	}
+
+	// Find every page first, so links can be checked before rendering. The
+	// pages are read again one at a time while the site is written, so the
+	// store isn't held open while it's streamed.
+	slugs := []string{}
+	err := pages.ForEachPage(func(slug string, p *page.Page) error {
+		name, err := archive.PathFor(slug)
+		if err != nil {
+			return nil
+		}
+		title := p.Metadata.Title
+		if title == "" {
+			title = slug
+		}
+		name = "pages/" + strings.TrimSuffix(name, path.Ext(name)) + ".html"
+		b.pages[slug] = &pageInfo{
+			Slug:  slug,
+			Title: title,
+			Tags:  p.Metadata.Tags,
+			Path:  name,
+			URL:   urlPath(name),
+		}
+		slugs = append(slugs, slug)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	b.assignTagPaths()
+
+	search := []*searchEntry{}
+	for _, slug := range slugs {
+		p, err := pages.GetPage(slug)
+		if err != nil {
+			return err
+		}
+
+		// Pages deleted since they were listed are left out of the listings
+		if p == nil {
+			delete(b.pages, slug)
+			continue
+		}
+
+		entry, err := b.writePage(b.pages[slug], p)
+		if err != nil {
+			return err
+		}
+		search = append(search, entry)
+	}
+
+	err = b.writeListings()
+	if err != nil {
+		return err
+	}
+
+	err = b.writeJSON("search.json", search)
+	if err != nil {
+		return err
+	}
+
+	err = b.writeStylesheets()
+	if err != nil {
+		return err
+	}
+
+	return b.zw.Close()
+
+}
+
+// assignTagPaths gives every tag a file name, making sure two tags that look
+// alike don't end up sharing one
+func (b *builder) assignTagPaths() {
+
+	tags := b.tags()
+	used := map[string]bool{}
+
+	for _, tag := range tags {
+		base := fileName(tag)
+		name := base
+		for i := 2; used[strings.ToLower(name)]; i++ {
+			name = fmt.Sprintf("%s-%d", base, i)
+		}
+		used[strings.ToLower(name)] = true
+		b.tagPath[tag] = "tags/" + name + ".html"
+	}
+
+}
+
+// tags returns every tag that is used, sorted
+func (b *builder) tags() []string {
+
+	seen := map[string]bool{}
+	tags := []string{}
+	for _, info := range b.pages {
+		for _, tag := range info.Tags {
+			if !seen[tag] {
+				seen[tag] = true
+				tags = append(tags, tag)
+			}
+		}
+	}
+	sort.Strings(tags)
+
+	return tags
+
+}
+
+// sortedPages returns pages sorted by title
+func (b *builder) sortedPages(include func(info *pageInfo) bool) []*pageInfo {
+
+	list := []*pageInfo{}
+	for _, info := range b.pages {
+		if include == nil || include(info) {
+			list = append(list, info)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		ti, tj := strings.ToLower(list[i].Title), strings.ToLower(list[j].Title)
+		if ti != tj {
+			return ti < tj
+		}
+		return list[i].Slug < list[j].Slug
+	})
+
+	return list
+
+}
+
+// writePage renders a page and writes it, returning its search index entry
+func (b *builder) writePage(info *pageInfo, p *page.Page) (*searchEntry, error) {
+
+	root := rootFrom(info.Path)
+
+	body := render.Markdown([]byte(p.Contents), render.Options{
+		Sanitize: b.opts.Sanitize,
+		Classes:  true,
+		Link: func(dest string) string {
+			return b.resolveLink(dest, info)
+		},
+	})
+
+	tags := []link{}
+	for _, tag := range info.Tags {
+		tags = append(tags, link{Title: tag, URL: root + b.tagPath[tag]})
+	}
+
+	data := map[string]interface{}{
+		"Root":     root,
+		"Title":    info.Title,
+		"Slug":     info.Slug,
+		"Tags":     tags,
+		"Modified": p.Metadata.Modified,
+		"Body":     template.HTML(body),
+
+		// Most pages start with their title as a heading already
+		"ShowTitle": !bytes.HasPrefix(bytes.TrimSpace(body), []byte("<h1")),
+	}
+
+	err := b.writeTemplate(info.Path, p.Metadata.Modified, "page", data)
+	if err != nil {
+		return nil, err
+	}
+
+	entry := searchEntry{
+		URL:   info.URL,
+		Title: info.Title,
+		Tags:  info.Tags,
+		Text:  plainText(body),
+	}
+	if entry.Tags == nil {
+		entry.Tags = []string{}
+	}
+
+	return &entry, nil
+
+}
+
+// writeListings writes the index page and the tag pages
+func (b *builder) writeListings() error {
+
+	pageLinks := func(root string, list []*pageInfo) []link {
+		links := []link{}
+		for _, info := range list {
+			links = append(links, link{Title: info.Title, URL: root + info.URL, Slug: info.Slug})
+		}
+		return links
+	}
+
+	tagLinks := []link{}
+	for _, tag := range b.tags() {
+		tagLinks = append(tagLinks, link{Title: tag, URL: b.tagPath[tag]})
+	}
+
+	err := b.writeTemplate("index.html", b.now, "index", map[string]interface{}{
+		"Root":  "",
+		"Title": b.opts.Title,
+		"Pages": pageLinks("", b.sortedPages(nil)),
+		"Tags":  tagLinks,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, tag := range b.tags() {
+		t := tag
+		tagged := b.sortedPages(func(info *pageInfo) bool {
+			for _, pt := range info.Tags {
+				if pt == t {
+					return true
+				}
+			}
+			return false
+		})
+
+		err = b.writeTemplate(b.tagPath[tag], b.now, "tag", map[string]interface{}{
+			"Root":  "../",
+			"Title": tag,
+			"Pages": pageLinks("../", tagged),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+
+}
+
+// writeStylesheets writes the site's stylesheet and the one for highlighted
+// code
+func (b *builder) writeStylesheets() error {
+
+	f, err := b.create("chroma.css", b.now)
+	if err != nil {
+		return err
+	}
+	err = render.WriteCSS(f)
+	if err != nil {
+		return err
+	}
+
+	f, err = b.create("style.css", b.now)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(f, stylesheet)
+	return err
+
+}
+
+// writeTemplate executes one of the templates into a file
+func (b *builder) writeTemplate(name string, modified time.Time, tmpl string, data interface{}) error {
+
+	buf := bytes.Buffer{}
+	err := templates.ExecuteTemplate(&buf, tmpl, data)
+	if err != nil {
+		return err
+	}
+
+	f, err := b.create(name, modified)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(buf.Bytes())
+	return err
+
+}
+
+// writeJSON writes a value to a file as JSON
+func (b *builder) writeJSON(name string, v interface{}) error {
+
+	j, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	f, err := b.create(name, b.now)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(j)
+	return err
+
+}
+
+// create adds a file to the archive
+func (b *builder) create(name string, modified time.Time) (io.Writer, error) {
+	if modified.IsZero() {
+		modified = b.now
+	}
+	return b.zw.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: modified,
+	})
+}
+
+// resolveLink rewrites a link on a page if it points to another page. Other
+// links are left as they are.
+func (b *builder) resolveLink(dest string, from *pageInfo) string {
+
+	targets, fragment := page.LinkTargets(dest, from.Slug)
+	for _, slug := range targets {
+		if info, ok := b.pages[slug]; ok {
+			return rootFrom(from.Path) + info.URL + fragment
+		}
+	}
+
+	return dest
+
+}
+
+// plainText returns the text of rendered HTML, for searching
+func plainText(body []byte) string {
+	text := html.UnescapeString(bluemonday.StrictPolicy().Sanitize(string(body)))
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// urlPath escapes every part of a slash separated path for use in a URL
+func urlPath(name string) string {
+
+	parts := strings.Split(name, "/")
+	for i, part := range parts {
+		parts[i] = url.PathEscape(part)
+	}
+
+	return strings.Join(parts, "/")
+
+}
+
+// rootFrom returns the relative path from a file to the root of the site
+func rootFrom(name string) string {
+	return strings.Repeat("../", strings.Count(name, "/"))
+}
+
+// fileName turns a tag into something safe to use as a file name
+func fileName(s string) string {
+
+	name := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_' {
+			return r
+		}
+		return '-'
+	}, s)
+
+	if name == "" {
+		name = "tag"
+	}
+	return name
+
+}
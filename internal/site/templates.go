@@ -0,0 +1,169 @@
+package site
+
+import (
+	"html/template"
+)
+
+// link is a link in a listing
+type link struct {
+	Title string
+	URL   string
+	Slug  string
+}
+
+var templates = template.Must(template.New("").Parse(`
+{{define "head"}}<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<link rel="stylesheet" href="{{.Root}}style.css">
+<link rel="stylesheet" href="{{.Root}}chroma.css">
+</head>
+<body>
+<nav><a href="{{.Root}}index.html">Index</a></nav>
+{{end}}
+
+{{define "foot"}}</body>
+</html>
+{{end}}
+
+{{define "page"}}{{template "head" .}}<article>
+<header>
+{{if .ShowTitle}}<h1>{{.Title}}</h1>
+{{end}}<p class="meta">{{.Slug}}{{if not .Modified.IsZero}} &middot; updated {{.Modified.Format "2006-01-02 15:04"}}{{end}}</p>
+{{if .Tags}}<ul class="tags">{{range .Tags}}<li><a href="{{.URL}}">{{.Title}}</a></li>{{end}}</ul>{{end}}
+</header>
+{{.Body}}
+</article>
+{{template "foot" .}}{{end}}
+
+{{define "tag"}}{{template "head" .}}<h1>Tagged &ldquo;{{.Title}}&rdquo;</h1>
+<ul class="pages">{{range .Pages}}
+<li><a href="{{.URL}}">{{.Title}}</a> <span class="meta">{{.Slug}}</span></li>{{end}}
+</ul>
+{{template "foot" .}}{{end}}
+
+{{define "index"}}{{template "head" .}}<h1>{{.Title}}</h1>
+<input id="search" type="search" placeholder="Search" autocomplete="off">
+<ul id="results" class="pages"></ul>
+{{if .Tags}}<h2>Tags</h2>
+<ul class="tags">{{range .Tags}}<li><a href="{{.URL}}">{{.Title}}</a></li>{{end}}</ul>{{end}}
+<h2>Pages</h2>
+<ul class="pages">{{range .Pages}}
+<li><a href="{{.URL}}">{{.Title}}</a> <span class="meta">{{.Slug}}</span></li>{{end}}
+</ul>
+<script>
+(function () {
+	var input = document.getElementById("search");
+	var results = document.getElementById("results");
+	var index = null;
+
+	function search() {
+		var terms = input.value.toLowerCase().split(/\s+/).filter(Boolean);
+		results.innerHTML = "";
+		if (!index || terms.length === 0) {
+			return;
+		}
+
+		var hits = [];
+		index.forEach(function (p) {
+			var title = p.title.toLowerCase();
+			var text = title + " " + p.tags.join(" ").toLowerCase() + " " + p.text.toLowerCase();
+			var score = 0;
+			for (var i = 0; i < terms.length; i++) {
+				if (text.indexOf(terms[i]) < 0) {
+					return;
+				}
+				score += title.indexOf(terms[i]) >= 0 ? 10 : 1;
+			}
+			hits.push({page: p, score: score});
+		});
+		hits.sort(function (a, b) { return b.score - a.score; });
+
+		hits.slice(0, 50).forEach(function (hit) {
+			var li = document.createElement("li");
+			var a = document.createElement("a");
+			a.href = hit.page.url;
+			a.textContent = hit.page.title;
+			li.appendChild(a);
+			results.appendChild(li);
+		});
+	}
+
+	// Browsers don't allow this for files opened straight from disk, the site
+	// has to be served over HTTP for search to work
+	fetch("search.json").then(function (r) { return r.json(); }).then(function (data) {
+		index = data;
+		search();
+	}).catch(function () {
+		input.disabled = true;
+		input.placeholder = "Search needs the site to be served over HTTP";
+	});
+
+	input.addEventListener("input", search);
+})();
+</script>
+{{template "foot" .}}{{end}}
+`))
+
+// stylesheet is the layout of the site
+const stylesheet = `body {
+	font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif;
+	line-height: 1.5;
+	color: #222;
+	max-width: 50em;
+	margin: 0 auto;
+	padding: 1em;
+}
+
+nav {
+	margin-bottom: 1em;
+}
+
+a {
+	color: #0366d6;
+}
+
+pre {
+	padding: 0.75em;
+	overflow: auto;
+	background: #f6f8fa;
+}
+
+code {
+	font-family: Consolas, Menlo, monospace;
+	font-size: 0.9em;
+}
+
+table {
+	border-collapse: collapse;
+}
+
+th, td {
+	border: 1px solid #ddd;
+	padding: 0.25em 0.5em;
+}
+
+.meta {
+	color: #777;
+	font-size: 0.9em;
+}
+
+ul.tags {
+	list-style: none;
+	padding: 0;
+}
+
+ul.tags li {
+	display: inline-block;
+	margin-right: 0.5em;
+}
+
+#search {
+	width: 100%;
+	padding: 0.5em;
+	font-size: 1em;
+}
+`
@@ -0,0 +1,68 @@
+package sqlstore
+
+import (
+	"github.com/idrum4316/devpad-server/internal/storage"
+)
+
+// enqueueIndexJobs queues the pages to be indexed again, as part of the
+// transaction that changed them
+func enqueueIndexJobs(db execer, ids ...string) error {
+	for _, id := range ids {
+		_, err := db.Exec(`INSERT INTO index_outbox (page_id) VALUES (?)`, id)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PendingIndexJobs returns up to <limit> of the oldest queued index jobs
+func (s *SQLStore) PendingIndexJobs(limit int) ([]*storage.Job, error) {
+
+	rows, err := s.db.Query(`SELECT seq, page_id FROM index_outbox
+		ORDER BY seq LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := []*storage.Job{}
+	for rows.Next() {
+		job := storage.Job{}
+		err = rows.Scan(&job.Seq, &job.PageID)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, &job)
+	}
+
+	return jobs, rows.Err()
+
+}
+
+// CompleteIndexJobs removes index jobs from the queue once they're applied
+func (s *SQLStore) CompleteIndexJobs(jobs []*storage.Job) error {
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, job := range jobs {
+		_, err = tx.Exec(`DELETE FROM index_outbox WHERE seq = ?`, job.Seq)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+
+}
+
+// CountIndexJobs returns how many index jobs are queued
+func (s *SQLStore) CountIndexJobs() (int, error) {
+	var count int
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM index_outbox`).Scan(&count)
+	return count, err
+}
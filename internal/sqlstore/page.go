@@ -0,0 +1,305 @@
+package sqlstore
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/idrum4316/devpad-server/internal/page"
+	"github.com/idrum4316/devpad-server/internal/storage"
+)
+
+// UpdatePage updates a page in the database, creating it if it doesn't exist
+func (s *SQLStore) UpdatePage(p *page.Page, pageID string) error {
+
+	p.Metadata.Modified = time.Now()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = putPage(tx, pageID, p)
+	if err != nil {
+		return err
+	}
+
+	err = enqueueIndexJobs(tx, pageID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+
+}
+
+// UpdatePageIf updates a page in the database if check accepts the page
+// that's there, in the same transaction
+func (s *SQLStore) UpdatePageIf(p *page.Page, pageID string,
+	check func(current *page.Page) error) (*page.Page, error) {
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	current, err := getPage(tx, pageID)
+	if err != nil {
+		return nil, err
+	}
+	err = check(current)
+	if err != nil {
+		return nil, err
+	}
+
+	p.Metadata.Modified = time.Now()
+	err = putPage(tx, pageID, p)
+	if err != nil {
+		return nil, err
+	}
+
+	err = enqueueIndexJobs(tx, pageID)
+	if err != nil {
+		return nil, err
+	}
+
+	saved, err := getPage(tx, pageID)
+	if err != nil {
+		return nil, err
+	}
+
+	return saved, tx.Commit()
+
+}
+
+// PutPages writes pages as they are, keeping their modification times. It's
+// all done in one transaction, so either every page is written or none are.
+func (s *SQLStore) PutPages(pages map[string]*page.Page) error {
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for id, p := range pages {
+		err = putPage(tx, id, p)
+		if err != nil {
+			return err
+		}
+		err = enqueueIndexJobs(tx, id)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+
+}
+
+// putPage writes a page as it is, without touching its modification time
+func putPage(db execer, id string, p *page.Page) error {
+
+	tags, err := json.Marshal(p.Metadata.Tags)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`INSERT INTO pages (id, title, tags, contents, modified, language)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET title = excluded.title,
+			tags = excluded.tags, contents = excluded.contents,
+			modified = excluded.modified, language = excluded.language`,
+		id, p.Metadata.Title, string(tags), p.Contents,
+		p.Metadata.Modified.Format(time.RFC3339Nano), p.Metadata.Language)
+
+	return err
+
+}
+
+// RenamePage moves a page to a new ID
+func (s *SQLStore) RenamePage(oldID string, newID string) error {
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = renamePage(tx, oldID, newID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+
+}
+
+// renamePage moves a page to a new ID within a transaction
+func renamePage(tx *sql.Tx, oldID string, newID string) error {
+
+	// Make sure the new ID is available
+	var exists int
+	err := tx.QueryRow(`SELECT COUNT(*) FROM pages WHERE id = ?`, newID).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if exists > 0 {
+		return fmt.Errorf("page %s already exists", newID)
+	}
+
+	res, err := tx.Exec(`UPDATE pages SET id = ? WHERE id = ?`, newID, oldID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("could not find page %s", oldID)
+	}
+
+	return enqueueIndexJobs(tx, oldID, newID)
+
+}
+
+// ApplyPageOps makes a batch of page changes in one transaction
+func (s *SQLStore) ApplyPageOps(ops []*storage.PageOp) error {
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, op := range ops {
+		switch op.Type {
+		case storage.OpPut:
+			err = putPage(tx, op.ID, op.Page)
+		case storage.OpDelete:
+			_, err = tx.Exec(`DELETE FROM pages WHERE id = ?`, op.ID)
+		case storage.OpRename:
+			err = renamePage(tx, op.ID, op.NewID)
+			if err != nil {
+				return err
+			}
+			continue
+		default:
+			err = fmt.Errorf("unknown page operation %q", op.Type)
+		}
+		if err != nil {
+			return err
+		}
+
+		err = enqueueIndexJobs(tx, op.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+
+}
+
+// DeletePage deletes a page from the database
+func (s *SQLStore) DeletePage(id string) error {
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`DELETE FROM pages WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+
+	err = enqueueIndexJobs(tx, id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+
+}
+
+// GetPage returns a page from the database
+func (s *SQLStore) GetPage(id string) (*page.Page, error) {
+	return getPage(s.db, id)
+}
+
+// getPage reads a page, or returns nil if it doesn't exist
+func getPage(db querier, id string) (*page.Page, error) {
+
+	row := db.QueryRow(`SELECT id, title, tags, contents, modified, language
+		FROM pages WHERE id = ?`, id)
+
+	_, p, err := scanPage(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return p, nil
+
+}
+
+// ForEachPage calls fn for every page in the database, in id order. If fn
+// returns an error, iteration stops and the error is returned.
+func (s *SQLStore) ForEachPage(fn func(id string, p *page.Page) error) error {
+
+	rows, err := s.db.Query(`SELECT id, title, tags, contents, modified, language
+		FROM pages ORDER BY id`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		id, p, err := scanPage(rows)
+		if err != nil {
+			return err
+		}
+
+		err = fn(id, p)
+		if err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+
+}
+
+// scanPage reads a page out of a row of the pages table
+func scanPage(row interface{ Scan(...interface{}) error }) (string, *page.Page, error) {
+
+	var id, tags, modified string
+	p := page.Page{}
+
+	err := row.Scan(&id, &p.Metadata.Title, &tags, &p.Contents, &modified,
+		&p.Metadata.Language)
+	if err != nil {
+		return "", nil, err
+	}
+
+	err = json.Unmarshal([]byte(tags), &p.Metadata.Tags)
+	if err != nil {
+		return "", nil, err
+	}
+
+	p.Metadata.Modified, err = time.Parse(time.RFC3339Nano, modified)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return id, &p, nil
+
+}
@@ -0,0 +1,134 @@
+package sqlstore
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/idrum4316/devpad-server/internal/page"
+	"github.com/idrum4316/devpad-server/internal/storage"
+	"github.com/idrum4316/devpad-server/internal/user"
+
+	// The SQLite driver registers itself with database/sql
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// The tables are plain enough to be read with the sqlite3 shell. Tags are
+// stored as a JSON array and times as RFC 3339 text.
+const schema = `
+CREATE TABLE IF NOT EXISTS pages (
+	id       TEXT PRIMARY KEY,
+	title    TEXT NOT NULL,
+	tags     TEXT NOT NULL,
+	contents TEXT NOT NULL,
+	modified TEXT NOT NULL,
+	language TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS users (
+	id         TEXT PRIMARY KEY,
+	password   BLOB,
+	salt       BLOB,
+	admin      INTEGER NOT NULL DEFAULT 0,
+	feed_token BLOB
+);
+
+CREATE INDEX IF NOT EXISTS users_feed_token ON users (feed_token);
+
+CREATE TABLE IF NOT EXISTS index_outbox (
+	seq     INTEGER PRIMARY KEY AUTOINCREMENT,
+	page_id TEXT NOT NULL
+);
+`
+
+// SQLStore keeps pages and user accounts in a SQLite database
+type SQLStore struct {
+	db *sql.DB
+}
+
+// Make sure SQLStore implements everything it should
+var (
+	_ storage.PageStore   = (*SQLStore)(nil)
+	_ storage.PageBatcher = (*SQLStore)(nil)
+	_ storage.UserStore   = (*SQLStore)(nil)
+	_ storage.Outbox      = (*SQLStore)(nil)
+)
+
+// execer and querier are satisfied by both *sql.DB and *sql.Tx
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+type querier interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// New returns a new, already opened SQLStore for the database file at path,
+// creating the file and its tables if needed
+func New(path string) (*SQLStore, error) {
+
+	db, err := sql.Open("sqlite3", path+"?_busy_timeout=5000&_journal_mode=WAL&_txlock=immediate")
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = db.Exec(schema)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &SQLStore{db: db}, nil
+
+}
+
+// Close closes the database
+func (s *SQLStore) Close() {
+	s.db.Close()
+}
+
+// SnapshotTo writes a consistent copy of the database to a new file at path,
+// while the store keeps being used
+func (s *SQLStore) SnapshotTo(path string) error {
+	_, err := s.db.Exec("VACUUM INTO ?", path)
+	return err
+}
+
+// CopyFrom copies every page and user from other stores into this one, in a
+// single transaction. Pages keep their modification times. It's meant for
+// migrating to SQLite, so the store must be empty.
+func (s *SQLStore) CopyFrom(pages storage.PageStore, users storage.UserStore) error {
+
+	var count int
+	err := s.db.QueryRow(`SELECT (SELECT COUNT(*) FROM pages) +
+		(SELECT COUNT(*) FROM users)`).Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return errors.New("the SQLite database already has pages or users in it")
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	err = pages.ForEachPage(func(id string, p *page.Page) error {
+		return putPage(tx, id, p)
+	})
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = users.ForEachUser(func(u *user.User) error {
+		return insertUser(tx, u)
+	})
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+
+}
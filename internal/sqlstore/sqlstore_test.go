@@ -0,0 +1,27 @@
+package sqlstore
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/idrum4316/devpad-server/internal/storage"
+	"github.com/idrum4316/devpad-server/internal/storage/storagetest"
+)
+
+func newTestStore(t *testing.T) *SQLStore {
+	s, err := New(filepath.Join(t.TempDir(), "devpad.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestConformance(t *testing.T) {
+	storagetest.TestPageStore(t, func(t *testing.T) storage.PageStore {
+		return newTestStore(t)
+	})
+	storagetest.TestUserStore(t, func(t *testing.T) storage.UserStore {
+		return newTestStore(t)
+	})
+}
@@ -0,0 +1,141 @@
+package sqlstore
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/idrum4316/devpad-server/internal/user"
+)
+
+// CountUsers returns the number of users in the database
+func (s *SQLStore) CountUsers() (int, error) {
+	count := 0
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM users`).Scan(&count)
+	return count, err
+}
+
+// UserExists returns a false if the user doesn't exist in the database
+func (s *SQLStore) UserExists(id string) (bool, error) {
+	count := 0
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM users WHERE id = ?`, id).Scan(&count)
+	return count > 0, err
+}
+
+// CreateUser creates a new user in the database
+func (s *SQLStore) CreateUser(u *user.User) error {
+
+	exists, err := s.UserExists(u.ID)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return errors.New("user already exists")
+	}
+
+	return insertUser(s.db, u)
+
+}
+
+// insertUser adds a row for a user to the users table
+func insertUser(db execer, u *user.User) error {
+	_, err := db.Exec(`INSERT INTO users (id, password, salt, admin, feed_token)
+		VALUES (?, ?, ?, ?, ?)`, u.ID, u.Password, u.Salt, u.Admin, u.FeedToken)
+	return err
+}
+
+// UpdateUser updates a user in the database
+func (s *SQLStore) UpdateUser(u *user.User) error {
+
+	res, err := s.db.Exec(`UPDATE users SET password = ?, salt = ?, admin = ?,
+		feed_token = ? WHERE id = ?`, u.Password, u.Salt, u.Admin, u.FeedToken, u.ID)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errors.New("user does not exist")
+	}
+
+	return nil
+
+}
+
+// DeleteUser deletes a user from the database
+func (s *SQLStore) DeleteUser(id string) error {
+	_, err := s.db.Exec(`DELETE FROM users WHERE id = ?`, id)
+	return err
+}
+
+// GetUser returns a user from the database
+func (s *SQLStore) GetUser(id string) (*user.User, error) {
+
+	row := s.db.QueryRow(`SELECT id, password, salt, admin, feed_token
+		FROM users WHERE id = ?`, id)
+
+	u, err := scanUser(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return u, err
+
+}
+
+// GetUserByFeedToken returns the user a feed token belongs to, or nil if the
+// token isn't valid. Only hashes of tokens are stored, so they can be looked
+// up directly.
+func (s *SQLStore) GetUserByFeedToken(token string) (*user.User, error) {
+
+	row := s.db.QueryRow(`SELECT id, password, salt, admin, feed_token
+		FROM users WHERE feed_token = ?`, user.HashFeedToken(token))
+
+	u, err := scanUser(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return u, err
+
+}
+
+// ForEachUser calls fn for every user in the database, in id order. If fn
+// returns an error, iteration stops and the error is returned.
+func (s *SQLStore) ForEachUser(fn func(u *user.User) error) error {
+
+	rows, err := s.db.Query(`SELECT id, password, salt, admin, feed_token
+		FROM users ORDER BY id`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return err
+		}
+
+		err = fn(u)
+		if err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+
+}
+
+// scanUser reads a user out of a row of the users table
+func scanUser(row interface{ Scan(...interface{}) error }) (*user.User, error) {
+
+	u := user.User{}
+	err := row.Scan(&u.ID, &u.Password, &u.Salt, &u.Admin, &u.FeedToken)
+	if err != nil {
+		return nil, err
+	}
+
+	return &u, nil
+
+}
@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"github.com/idrum4316/devpad-server/internal/event"
+	"github.com/idrum4316/devpad-server/internal/page"
+	"github.com/idrum4316/devpad-server/internal/savedsearch"
+	"github.com/idrum4316/devpad-server/internal/user"
+	"github.com/idrum4316/devpad-server/internal/webhook"
+)
+
+// PageStore is where pages are kept. GetPage returns nil (and no error) for
+// pages that don't exist. PutPages writes many pages at once, as they are,
+// without touching their modification times. UpdatePageIf saves a page like
+// UpdatePage, but only if check accepts the page as it's stored (nil if
+// there isn't one), and returns the page as it was saved. The check and the
+// write are one transaction, and check may still fill in p. An error from
+// check is returned as it is.
+type PageStore interface {
+	GetPage(id string) (*page.Page, error)
+	UpdatePage(p *page.Page, id string) error
+	UpdatePageIf(p *page.Page, id string, check func(current *page.Page) error) (*page.Page, error)
+	PutPages(pages map[string]*page.Page) error
+	RenamePage(oldID string, newID string) error
+	DeletePage(id string) error
+	ForEachPage(fn func(id string, p *page.Page) error) error
+}
+
+// The kinds of change a PageOp makes
+const (
+	OpPut    = "put"
+	OpDelete = "delete"
+	OpRename = "rename"
+)
+
+// PageOp is one change in a batch of page writes. A put writes Page as it is,
+// without touching its modification time, and a rename moves the page at ID
+// to NewID.
+type PageOp struct {
+	Type  string
+	ID    string
+	NewID string
+	Page  *page.Page
+}
+
+// PageBatcher is a PageStore that can make a batch of changes in one
+// transaction, so either all of them are made or none are. They're made in
+// order, and a rename fails like RenamePage does.
+type PageBatcher interface {
+	ApplyPageOps(ops []*PageOp) error
+}
+
+// Job is a page change waiting in an Outbox to be indexed
+type Job struct {
+	Seq    uint64
+	PageID string
+}
+
+// Outbox is a PageStore that queues its changes for the search index. Jobs
+// are queued in the same transaction as the change itself, so a change that
+// was saved is never lost before it's indexed, even if the server stops.
+type Outbox interface {
+	PendingIndexJobs(limit int) ([]*Job, error)
+	CompleteIndexJobs(jobs []*Job) error
+	CountIndexJobs() (int, error)
+}
+
+// UserStore is where user accounts are kept. GetUser and GetUserByFeedToken
+// return nil (and no error) for users that don't exist.
+type UserStore interface {
+	CountUsers() (int, error)
+	UserExists(id string) (bool, error)
+	CreateUser(u *user.User) error
+	UpdateUser(u *user.User) error
+	DeleteUser(id string) error
+	GetUser(id string) (*user.User, error)
+	GetUserByFeedToken(token string) (*user.User, error)
+	ForEachUser(fn func(u *user.User) error) error
+}
+
+// MetaStore is where everything else is kept: webhooks and their deliveries,
+// the event log, and saved searches and their notifications.
+type MetaStore interface {
+	webhook.Queue
+	CreateWebhook(w *webhook.Webhook) error
+	DeleteWebhook(id string) error
+	ListDeliveries(webhookID string, limit int) ([]*webhook.Delivery, error)
+
+	event.Log
+	EventsBefore(id uint64, limit int,
+		match func(e *event.Event) (include bool, stop bool)) ([]*event.Event, error)
+
+	savedsearch.Store
+}
+
+// Store is a backend that keeps everything
+type Store interface {
+	PageStore
+	UserStore
+	MetaStore
+}
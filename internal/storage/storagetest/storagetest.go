@@ -0,0 +1,992 @@
+// Package storagetest is a conformance suite for the storage interfaces.
+// Every backend should pass it, so they can be swapped for each other:
+//
+//	func TestConformance(t *testing.T) {
+//		storagetest.TestPageStore(t, func(t *testing.T) storage.PageStore {
+//			return memstore.New()
+//		})
+//	}
+package storagetest
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/idrum4316/devpad-server/internal/event"
+	"github.com/idrum4316/devpad-server/internal/page"
+	"github.com/idrum4316/devpad-server/internal/savedsearch"
+	"github.com/idrum4316/devpad-server/internal/storage"
+	"github.com/idrum4316/devpad-server/internal/user"
+	"github.com/idrum4316/devpad-server/internal/webhook"
+)
+
+// TestPageStore checks that a PageStore behaves like the others. newStore
+// must return a new, empty store every time it's called.
+func TestPageStore(t *testing.T, newStore func(t *testing.T) storage.PageStore) {
+
+	t.Run("GetMissingPage", func(t *testing.T) {
+		s := newStore(t)
+		p, err := s.GetPage("missing")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p != nil {
+			t.Fatal("expected nil for a page that doesn't exist")
+		}
+	})
+
+	t.Run("UpdateAndGetPage", func(t *testing.T) {
+		s := newStore(t)
+		p := newPage("Title", "contents", "a", "b")
+		p.Metadata.Language = "de"
+		before := time.Now().Add(-time.Second)
+
+		err := s.UpdatePage(p, "one")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.Metadata.Modified.Before(before) {
+			t.Fatal("UpdatePage didn't set the modified time")
+		}
+
+		got, err := s.GetPage("one")
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertPage(t, got, p)
+
+		// Saving again replaces the page
+		p.Contents = "changed"
+		err = s.UpdatePage(p, "one")
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err = s.GetPage("one")
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertPage(t, got, p)
+	})
+
+	t.Run("UpdatePageIf", func(t *testing.T) {
+		s := newStore(t)
+		errRefused := errors.New("refused")
+
+		// The check sees that there's no page yet
+		p := newPage("Title", "contents")
+		saved, err := s.UpdatePageIf(p, "one", func(current *page.Page) error {
+			if current != nil {
+				return errRefused
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertPage(t, saved, p)
+
+		got, err := s.GetPage("one")
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertPage(t, got, p)
+		if !got.Metadata.Modified.Equal(saved.Metadata.Modified) {
+			t.Fatalf("UpdatePageIf returned the modified time %s, but %s was saved",
+				saved.Metadata.Modified, got.Metadata.Modified)
+		}
+
+		// A refused update isn't saved, and the check's error comes back
+		_, err = s.UpdatePageIf(newPage("Other", "other"), "one", func(current *page.Page) error {
+			if current == nil || current.Contents != "contents" {
+				t.Fatalf("the check was given %v", current)
+			}
+			return errRefused
+		})
+		if err != errRefused {
+			t.Fatalf("expected the check's error, got %v", err)
+		}
+		got, err = s.GetPage("one")
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertPage(t, got, p)
+
+		// The check can build the page from the one that's there
+		filled := page.Page{}
+		_, err = s.UpdatePageIf(&filled, "one", func(current *page.Page) error {
+			filled = *current
+			filled.Contents = "filled in"
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err = s.GetPage("one")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Contents != "filled in" || got.Metadata.Title != "Title" {
+			t.Fatalf("expected the filled in page to be saved, got %v", got)
+		}
+	})
+
+	t.Run("NamespacedPage", func(t *testing.T) {
+		s := newStore(t)
+		p := newPage("Deploy", "steps")
+
+		err := s.UpdatePage(p, "ops:deploy")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := s.GetPage("ops:deploy")
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertPage(t, got, p)
+	})
+
+	t.Run("RenamePage", func(t *testing.T) {
+		s := newStore(t)
+		p := newPage("Title", "contents")
+		mustUpdatePage(t, s, p, "old")
+		mustUpdatePage(t, s, newPage("Taken", ""), "taken")
+
+		err := s.RenamePage("old", "taken")
+		if err == nil {
+			t.Fatal("renaming onto an existing page should fail")
+		}
+
+		err = s.RenamePage("missing", "new")
+		if err == nil {
+			t.Fatal("renaming a page that doesn't exist should fail")
+		}
+
+		err = s.RenamePage("old", "new")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := s.GetPage("old")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != nil {
+			t.Fatal("the old page still exists after renaming")
+		}
+
+		got, err = s.GetPage("new")
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertPage(t, got, p)
+	})
+
+	t.Run("DeletePage", func(t *testing.T) {
+		s := newStore(t)
+		mustUpdatePage(t, s, newPage("Title", "contents"), "one")
+
+		err := s.DeletePage("one")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := s.GetPage("one")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != nil {
+			t.Fatal("the page still exists after deleting it")
+		}
+
+		// Deleting a page that doesn't exist isn't an error
+		err = s.DeletePage("one")
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("ForEachPage", func(t *testing.T) {
+		s := newStore(t)
+		want := map[string]*page.Page{
+			"one":    newPage("One", "1"),
+			"two":    newPage("Two", "2"),
+			"ns:tri": newPage("Three", "3"),
+		}
+		for id, p := range want {
+			mustUpdatePage(t, s, p, id)
+		}
+
+		seen := map[string]bool{}
+		err := s.ForEachPage(func(id string, p *page.Page) error {
+			w, ok := want[id]
+			if !ok {
+				t.Fatalf("unexpected page %s", id)
+			}
+			if seen[id] {
+				t.Fatalf("page %s was visited twice", id)
+			}
+			seen[id] = true
+			assertPage(t, p, w)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(seen) != len(want) {
+			t.Fatalf("visited %d pages, expected %d", len(seen), len(want))
+		}
+	})
+
+	t.Run("PutPages", func(t *testing.T) {
+		s := newStore(t)
+		mustUpdatePage(t, s, newPage("Old", "old"), "one")
+
+		modified := time.Date(2018, 6, 1, 12, 0, 0, 0, time.UTC)
+		want := map[string]*page.Page{
+			"one":    newPage("One", "1", "a"),
+			"ns:two": newPage("Two", "2"),
+		}
+		for _, p := range want {
+			p.Metadata.Modified = modified
+		}
+
+		err := s.PutPages(want)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for id, p := range want {
+			got, err := s.GetPage(id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertPage(t, got, p)
+			if !got.Metadata.Modified.Equal(modified) {
+				t.Fatalf("PutPages changed the modified time of %s to %s", id,
+					got.Metadata.Modified)
+			}
+		}
+	})
+
+}
+
+// TestUserStore checks that a UserStore behaves like the others. newStore
+// must return a new, empty store every time it's called.
+func TestUserStore(t *testing.T, newStore func(t *testing.T) storage.UserStore) {
+
+	t.Run("CreateAndGetUser", func(t *testing.T) {
+		s := newStore(t)
+
+		count, err := s.CountUsers()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != 0 {
+			t.Fatalf("a new store has %d users", count)
+		}
+
+		u := &user.User{ID: "alice", Admin: true, Password: []byte("pw"), Salt: []byte("salt")}
+		err = s.CreateUser(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = s.CreateUser(u)
+		if err == nil {
+			t.Fatal("creating a user twice should fail")
+		}
+
+		exists, err := s.UserExists("alice")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !exists {
+			t.Fatal("the user doesn't exist after creating it")
+		}
+
+		got, err := s.GetUser("alice")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got == nil || got.ID != "alice" || !got.Admin || string(got.Password) != "pw" ||
+			string(got.Salt) != "salt" {
+			t.Fatalf("got %+v, expected %+v", got, u)
+		}
+
+		count, err = s.CountUsers()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != 1 {
+			t.Fatalf("expected 1 user, got %d", count)
+		}
+	})
+
+	t.Run("GetMissingUser", func(t *testing.T) {
+		s := newStore(t)
+
+		got, err := s.GetUser("missing")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != nil {
+			t.Fatal("expected nil for a user that doesn't exist")
+		}
+
+		exists, err := s.UserExists("missing")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if exists {
+			t.Fatal("a missing user exists")
+		}
+	})
+
+	t.Run("UpdateUser", func(t *testing.T) {
+		s := newStore(t)
+
+		u := &user.User{ID: "bob"}
+		err := s.UpdateUser(u)
+		if err == nil {
+			t.Fatal("updating a user that doesn't exist should fail")
+		}
+
+		err = s.CreateUser(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		u.Admin = true
+		err = s.UpdateUser(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := s.GetUser("bob")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got == nil || !got.Admin {
+			t.Fatal("the update wasn't saved")
+		}
+	})
+
+	t.Run("DeleteUser", func(t *testing.T) {
+		s := newStore(t)
+
+		err := s.CreateUser(&user.User{ID: "carol"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = s.DeleteUser("carol")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		exists, err := s.UserExists("carol")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if exists {
+			t.Fatal("the user still exists after deleting it")
+		}
+	})
+
+	t.Run("GetUserByFeedToken", func(t *testing.T) {
+		s := newStore(t)
+
+		u := &user.User{ID: "dave"}
+		token, err := u.NewFeedToken()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = s.CreateUser(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = s.CreateUser(&user.User{ID: "erin"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := s.GetUserByFeedToken(token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got == nil || got.ID != "dave" {
+			t.Fatalf("expected dave, got %+v", got)
+		}
+
+		got, err = s.GetUserByFeedToken("not a token")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != nil {
+			t.Fatal("an invalid token found a user")
+		}
+
+		// A new token replaces the old one
+		newToken, err := u.NewFeedToken()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = s.UpdateUser(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err = s.GetUserByFeedToken(token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != nil {
+			t.Fatal("the replaced token still found a user")
+		}
+		got, err = s.GetUserByFeedToken(newToken)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got == nil || got.ID != "dave" {
+			t.Fatalf("expected the new token to find dave, got %+v", got)
+		}
+
+		// And it's gone with the user
+		err = s.DeleteUser("dave")
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err = s.GetUserByFeedToken(newToken)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != nil {
+			t.Fatal("the token of a deleted user found a user")
+		}
+	})
+
+	t.Run("ForEachUser", func(t *testing.T) {
+		s := newStore(t)
+
+		for _, id := range []string{"frank", "grace"} {
+			err := s.CreateUser(&user.User{ID: id})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		seen := map[string]bool{}
+		err := s.ForEachUser(func(u *user.User) error {
+			seen[u.ID] = true
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(seen) != 2 || !seen["frank"] || !seen["grace"] {
+			t.Fatalf("expected frank and grace, got %v", seen)
+		}
+	})
+
+}
+
+// TestMetaStore checks that a MetaStore behaves like the others. newStore
+// must return a new, empty store every time it's called.
+func TestMetaStore(t *testing.T, newStore func(t *testing.T) storage.MetaStore) {
+
+	t.Run("Webhooks", func(t *testing.T) {
+		s := newStore(t)
+
+		w, err := webhook.New("http://example.com/hook", []string{event.PageCreated})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = s.CreateWebhook(w)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = s.CreateWebhook(w)
+		if err == nil {
+			t.Fatal("creating a webhook twice should fail")
+		}
+
+		got, err := s.GetWebhook(w.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got == nil || got.URL != w.URL || got.Secret != w.Secret || len(got.Events) != 1 {
+			t.Fatalf("got %+v, expected %+v", got, w)
+		}
+
+		hooks, err := s.ListWebhooks()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(hooks) != 1 {
+			t.Fatalf("expected 1 webhook, got %d", len(hooks))
+		}
+
+		err = s.DeleteWebhook(w.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err = s.GetWebhook(w.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != nil {
+			t.Fatal("the webhook still exists after deleting it")
+		}
+	})
+
+	t.Run("Deliveries", func(t *testing.T) {
+		s := newStore(t)
+		now := time.Now()
+
+		deliveries := []*webhook.Delivery{
+			{WebhookID: "a", Status: webhook.StatusPending, NextAttempt: now.Add(-time.Minute)},
+			{WebhookID: "b", Status: webhook.StatusPending, NextAttempt: now.Add(-time.Minute)},
+			{WebhookID: "a", Status: webhook.StatusPending, NextAttempt: now.Add(time.Hour)},
+		}
+		err := s.EnqueueDeliveries(deliveries)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if deliveries[0].ID == 0 || deliveries[1].ID <= deliveries[0].ID ||
+			deliveries[2].ID <= deliveries[1].ID {
+			t.Fatal("deliveries weren't given increasing IDs")
+		}
+
+		due, err := s.DueDeliveries(now, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(due) != 2 || due[0].ID != deliveries[0].ID || due[1].ID != deliveries[1].ID {
+			t.Fatalf("expected the first two deliveries to be due, got %d", len(due))
+		}
+
+		due, err = s.DueDeliveries(now, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(due) != 1 {
+			t.Fatalf("the limit wasn't respected, got %d deliveries", len(due))
+		}
+
+		// Finished deliveries leave the queue but stay in the log
+		deliveries[0].Status = webhook.StatusSucceeded
+		err = s.UpdateDelivery(deliveries[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		due, err = s.DueDeliveries(now, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(due) != 1 || due[0].ID != deliveries[1].ID {
+			t.Fatal("a finished delivery is still queued")
+		}
+
+		log, err := s.ListDeliveries("a", 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(log) != 2 || log[0].ID != deliveries[2].ID || log[1].ID != deliveries[0].ID {
+			t.Fatal("the delivery log should list the webhook's deliveries, newest first")
+		}
+		if log[1].Status != webhook.StatusSucceeded {
+			t.Fatal("the delivery update wasn't saved")
+		}
+
+		// Deleting a webhook deletes its deliveries, queued or not
+		err = s.DeleteWebhook("a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		log, err = s.ListDeliveries("a", 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(log) != 0 {
+			t.Fatal("a deleted webhook still has deliveries")
+		}
+		due, err = s.DueDeliveries(now.Add(2*time.Hour), 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(due) != 1 || due[0].ID != deliveries[1].ID {
+			t.Fatal("a deleted webhook's deliveries are still queued")
+		}
+	})
+
+	t.Run("PruneDeliveries", func(t *testing.T) {
+		s := newStore(t)
+		now := time.Now()
+
+		deliveries := []*webhook.Delivery{}
+		for i := 0; i < 4; i++ {
+			deliveries = append(deliveries, &webhook.Delivery{
+				WebhookID:   "a",
+				Status:      webhook.StatusPending,
+				NextAttempt: now,
+			})
+		}
+		err := s.EnqueueDeliveries(deliveries)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The first is old, the next two are finished, and the last is
+		// still pending
+		for i, del := range deliveries[:3] {
+			del.Status = webhook.StatusSucceeded
+			del.Updated = now
+			if i == 0 {
+				del.Updated = now.Add(-48 * time.Hour)
+			}
+			err = s.UpdateDelivery(del)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		err = s.PruneDeliveries(now.Add(-24*time.Hour), 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		log, err := s.ListDeliveries("a", 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(log) != 2 || log[0].ID != deliveries[3].ID || log[1].ID != deliveries[2].ID {
+			t.Fatalf("expected the pending and the newest finished delivery to be "+
+				"kept, got %d deliveries", len(log))
+		}
+
+		due, err := s.DueDeliveries(now, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(due) != 1 || due[0].ID != deliveries[3].ID {
+			t.Fatal("pruning changed the queue")
+		}
+	})
+
+	t.Run("EventLog", func(t *testing.T) {
+		s := newStore(t)
+
+		for _, slug := range []string{"a", "b", "c", "d"} {
+			e := event.New(event.PageUpdated, "someone")
+			e.Slug = slug
+			err := s.AppendEvent(e)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		events, err := s.EventsSince(0, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(events) != 4 {
+			t.Fatalf("expected 4 events, got %d", len(events))
+		}
+		for i := 1; i < len(events); i++ {
+			if events[i].ID <= events[i-1].ID {
+				t.Fatal("event IDs aren't increasing")
+			}
+		}
+
+		since, err := s.EventsSince(events[1].ID, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(since) != 2 || since[0].Slug != "c" {
+			t.Fatal("EventsSince should return the events after the ID")
+		}
+
+		all := func(e *event.Event) (bool, bool) { return true, false }
+
+		before, err := s.EventsBefore(0, 10, all)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(before) != 4 || before[0].Slug != "d" {
+			t.Fatal("EventsBefore should start at the newest event")
+		}
+
+		before, err = s.EventsBefore(events[2].ID, 10, all)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(before) != 2 || before[0].Slug != "b" || before[1].Slug != "a" {
+			t.Fatal("EventsBefore should return the events before the ID, newest first")
+		}
+
+		stopAtB := func(e *event.Event) (bool, bool) { return e.Slug != "c", e.Slug == "b" }
+		before, err = s.EventsBefore(0, 10, stopAtB)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(before) != 1 || before[0].Slug != "d" {
+			t.Fatal("EventsBefore didn't respect the filter")
+		}
+	})
+
+	t.Run("TrimEvents", func(t *testing.T) {
+		s := newStore(t)
+		now := time.Now()
+
+		for i, slug := range []string{"a", "b", "c"} {
+			e := event.New(event.PageUpdated, "someone")
+			e.Slug = slug
+			e.Timestamp = now.Add(time.Duration(i-2) * time.Hour)
+			err := s.AppendEvent(e)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		err := s.TrimEvents(now.Add(-30 * time.Minute))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		events, err := s.EventsSince(0, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(events) != 1 || events[0].Slug != "c" {
+			t.Fatalf("expected only the newest event to be left, got %d", len(events))
+		}
+
+		// IDs carry on from where they were
+		e := event.New(event.PageUpdated, "someone")
+		e.Slug = "d"
+		err = s.AppendEvent(e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e.ID <= events[0].ID {
+			t.Fatal("an event was given an ID that was already used")
+		}
+
+		since, err := s.EventsSince(events[0].ID, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(since) != 1 || since[0].Slug != "d" {
+			t.Fatal("EventsSince is wrong after trimming")
+		}
+
+		all := func(e *event.Event) (bool, bool) { return true, false }
+		before, err := s.EventsBefore(e.ID, 10, all)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(before) != 1 || before[0].Slug != "c" {
+			t.Fatal("EventsBefore is wrong after trimming")
+		}
+	})
+
+	t.Run("SavedSearches", func(t *testing.T) {
+		s := newStore(t)
+
+		mine, err := savedsearch.New("me", "incidents")
+		if err != nil {
+			t.Fatal(err)
+		}
+		mine.Tags = []string{"incident"}
+		theirs, err := savedsearch.New("them", "drafts")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, ss := range []*savedsearch.SavedSearch{mine, theirs} {
+			err = s.PutSavedSearch(ss)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		got, err := s.GetSavedSearch(mine.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got == nil || got.Name != "incidents" || len(got.Tags) != 1 {
+			t.Fatalf("got %+v, expected %+v", got, mine)
+		}
+
+		list, err := s.ListSavedSearches("me")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(list) != 1 || list[0].ID != mine.ID {
+			t.Fatal("ListSavedSearches should only list the owner's searches")
+		}
+		list, err = s.ListSavedSearches("")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(list) != 2 {
+			t.Fatalf("expected 2 saved searches, got %d", len(list))
+		}
+
+		checked := time.Now().Add(time.Hour).Round(time.Second)
+		notes := []*savedsearch.Notification{
+			{Owner: "me", SearchID: mine.ID, Slug: "a"},
+			{Owner: "me", SearchID: mine.ID, Slug: "b"},
+		}
+		err = s.RecordMatches(mine.ID, checked, notes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if notes[0].ID == 0 || notes[1].ID <= notes[0].ID {
+			t.Fatal("notification IDs aren't increasing")
+		}
+
+		got, err = s.GetSavedSearch(mine.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !got.Checked.Equal(checked) {
+			t.Fatal("RecordMatches didn't update the checked time")
+		}
+
+		// An update keeps the checked time recorded since the search was read
+		updated, err := s.UpdateSavedSearch(mine.ID, func(ss *savedsearch.SavedSearch) {
+			ss.Name = "outages"
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if updated == nil || updated.Name != "outages" || !updated.Checked.Equal(checked) {
+			t.Fatalf("got %+v, expected the new name and the checked time", updated)
+		}
+		got, err = s.GetSavedSearch(mine.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Name != "outages" || !got.Checked.Equal(checked) {
+			t.Fatal("UpdateSavedSearch didn't save the change")
+		}
+
+		err = s.RecordMatches(theirs.ID, checked, []*savedsearch.Notification{
+			{Owner: "them", SearchID: theirs.ID, Slug: "c"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		mineNotes, err := s.ListNotifications("me", 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(mineNotes) != 2 || mineNotes[0].Slug != "b" {
+			t.Fatal("ListNotifications should list the owner's notifications, newest first")
+		}
+
+		err = s.DeleteNotifications("me")
+		if err != nil {
+			t.Fatal(err)
+		}
+		mineNotes, err = s.ListNotifications("me", 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		theirNotes, err := s.ListNotifications("them", 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(mineNotes) != 0 || len(theirNotes) != 1 {
+			t.Fatal("DeleteNotifications should only delete the owner's notifications")
+		}
+
+		err = s.DeleteSavedSearch(mine.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err = s.GetSavedSearch(mine.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != nil {
+			t.Fatal("the saved search still exists after deleting it")
+		}
+
+		// Matches recorded for a deleted search don't bring it back
+		err = s.RecordMatches(mine.ID, checked, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err = s.GetSavedSearch(mine.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != nil {
+			t.Fatal("RecordMatches recreated a deleted saved search")
+		}
+		updated, err = s.UpdateSavedSearch(mine.ID, func(ss *savedsearch.SavedSearch) {})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if updated != nil {
+			t.Fatal("UpdateSavedSearch returned a deleted saved search")
+		}
+		got, err = s.GetSavedSearch(mine.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != nil {
+			t.Fatal("UpdateSavedSearch recreated a deleted saved search")
+		}
+	})
+
+}
+
+func newPage(title string, contents string, tags ...string) *page.Page {
+	p := page.New()
+	p.Contents = contents
+	p.Metadata.Title = title
+	p.Metadata.Tags = append(p.Metadata.Tags, tags...)
+	return p
+}
+
+func mustUpdatePage(t *testing.T, s storage.PageStore, p *page.Page, id string) {
+	t.Helper()
+	err := s.UpdatePage(p, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func assertPage(t *testing.T, got *page.Page, want *page.Page) {
+	t.Helper()
+
+	if got == nil {
+		t.Fatal("expected a page, got nil")
+	}
+	if got.Contents != want.Contents {
+		t.Fatalf("contents: got %q, expected %q", got.Contents, want.Contents)
+	}
+	if got.Metadata.Title != want.Metadata.Title {
+		t.Fatalf("title: got %q, expected %q", got.Metadata.Title, want.Metadata.Title)
+	}
+	if got.Metadata.Language != want.Metadata.Language {
+		t.Fatalf("language: got %q, expected %q", got.Metadata.Language, want.Metadata.Language)
+	}
+	if len(got.Metadata.Tags) != len(want.Metadata.Tags) {
+		t.Fatalf("tags: got %v, expected %v", got.Metadata.Tags, want.Metadata.Tags)
+	}
+	for i := range got.Metadata.Tags {
+		if got.Metadata.Tags[i] != want.Metadata.Tags[i] {
+			t.Fatalf("tags: got %v, expected %v", got.Metadata.Tags, want.Metadata.Tags)
+		}
+	}
+	diff := got.Metadata.Modified.Sub(want.Metadata.Modified)
+	if diff > time.Second || diff < -time.Second {
+		t.Fatalf("modified: got %s, expected %s", got.Metadata.Modified, want.Metadata.Modified)
+	}
+}
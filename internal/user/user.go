@@ -3,14 +3,17 @@ package user
 import (
 	"bytes"
 	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"io"
 
 	"golang.org/x/crypto/scrypt"
 )
 
 const (
-	pwSaltBytes = 32
-	pwHashBytes = 64
+	pwSaltBytes    = 32
+	pwHashBytes    = 64
+	feedTokenBytes = 24
 )
 
 // User is an API user - or web user
@@ -19,6 +22,9 @@ type User struct {
 	Password []byte
 	Salt     []byte
 	Admin    bool
+
+	// A hash of the token used to read feeds without a JWT token
+	FeedToken []byte
 }
 
 // SetPassword generates a new salt and uses it to has the user's password
@@ -55,3 +61,27 @@ func (u *User) VerifyPassword(password string) (bool, error) {
 	return bytes.Equal(derivedKey, u.Password), nil
 
 }
+
+// NewFeedToken generates a new feed token for the user, replacing the old
+// one. Only a hash of the token is kept, so the returned token can't be
+// recovered later.
+func (u *User) NewFeedToken() (string, error) {
+
+	b := make([]byte, feedTokenBytes)
+	_, err := io.ReadFull(rand.Reader, b)
+	if err != nil {
+		return "", err
+	}
+
+	token := hex.EncodeToString(b)
+	u.FeedToken = HashFeedToken(token)
+
+	return token, nil
+
+}
+
+// HashFeedToken returns the hash that is stored for a feed token
+func HashFeedToken(token string) []byte {
+	h := sha256.Sum256([]byte(token))
+	return h[:]
+}
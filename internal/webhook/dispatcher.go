@@ -0,0 +1,273 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/idrum4316/devpad-server/internal/event"
+)
+
+// Headers sent along with every delivery
+const (
+	EventHeader     = "X-Devpad-Event"
+	DeliveryHeader  = "X-Devpad-Delivery"
+	SignatureHeader = "X-Devpad-Signature"
+)
+
+// Queue is the persistent storage the Dispatcher uses for webhooks and their
+// deliveries.
+type Queue interface {
+	ListWebhooks() ([]*Webhook, error)
+	GetWebhook(id string) (*Webhook, error)
+	EnqueueDeliveries(deliveries []*Delivery) error
+	DueDeliveries(now time.Time, limit int) ([]*Delivery, error)
+	UpdateDelivery(d *Delivery) error
+	PruneDeliveries(before time.Time, keep int) error
+}
+
+// Dispatcher queues events for the webhooks that want them and delivers them
+// in the background, retrying failed deliveries with exponential backoff.
+// Finished deliveries are kept for DeliveryRetention, up to KeepDeliveries
+// for each webhook.
+type Dispatcher struct {
+	Queue             Queue
+	Client            *http.Client
+	MaxAttempts       int
+	BaseBackoff       time.Duration
+	MaxBackoff        time.Duration
+	PollInterval      time.Duration
+	BatchSize         int
+	KeepDeliveries    int
+	DeliveryRetention time.Duration
+	PruneInterval     time.Duration
+
+	wake chan struct{}
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewDispatcher returns a new Dispatcher with default values set
+func NewDispatcher(q Queue) *Dispatcher {
+	return &Dispatcher{
+		Queue:             q,
+		Client:            &http.Client{Timeout: 10 * time.Second},
+		MaxAttempts:       8,
+		BaseBackoff:       30 * time.Second,
+		MaxBackoff:        6 * time.Hour,
+		PollInterval:      5 * time.Second,
+		BatchSize:         50,
+		KeepDeliveries:    100,
+		DeliveryRetention: 30 * 24 * time.Hour,
+		PruneInterval:     time.Hour,
+		wake:              make(chan struct{}, 1),
+	}
+}
+
+// Dispatch queues the event for every webhook subscribed to its type
+func (d *Dispatcher) Dispatch(e *event.Event) error {
+
+	hooks, err := d.Queue.ListWebhooks()
+	if err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	deliveries := []*Delivery{}
+	for _, hook := range hooks {
+		if !hook.Wants(e.Type) {
+			continue
+		}
+		deliveries = append(deliveries, &Delivery{
+			WebhookID:   hook.ID,
+			Event:       e.Type,
+			Payload:     payload,
+			Status:      StatusPending,
+			NextAttempt: now,
+			Created:     now,
+			Updated:     now,
+		})
+	}
+
+	if len(deliveries) == 0 {
+		return nil
+	}
+
+	err = d.Queue.EnqueueDeliveries(deliveries)
+	if err != nil {
+		return err
+	}
+
+	// Let the worker know there's something to do without blocking
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+
+	return nil
+
+}
+
+// Start runs the delivery worker in the background until Stop is called
+func (d *Dispatcher) Start() {
+
+	d.stop = make(chan struct{})
+	d.wg.Add(1)
+
+	go func() {
+		defer d.wg.Done()
+
+		ticker := time.NewTicker(d.PollInterval)
+		defer ticker.Stop()
+
+		var pruned time.Time
+		for {
+			_, err := d.ProcessDue()
+			if err != nil {
+				log.Println("webhook:", err)
+			}
+
+			if time.Since(pruned) >= d.PruneInterval {
+				pruned = time.Now()
+				err = d.Prune()
+				if err != nil {
+					log.Println("webhook:", err)
+				}
+			}
+
+			select {
+			case <-d.stop:
+				return
+			case <-d.wake:
+			case <-ticker.C:
+			}
+		}
+	}()
+
+}
+
+// Stop stops the delivery worker and waits for it to finish
+func (d *Dispatcher) Stop() {
+	if d.stop == nil {
+		return
+	}
+	close(d.stop)
+	d.wg.Wait()
+	d.stop = nil
+}
+
+// ProcessDue attempts every delivery whose next attempt is due and returns
+// the number of deliveries that were attempted.
+func (d *Dispatcher) ProcessDue() (int, error) {
+
+	due, err := d.Queue.DueDeliveries(time.Now(), d.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, del := range due {
+		hook, err := d.Queue.GetWebhook(del.WebhookID)
+		if err != nil {
+			return 0, err
+		}
+
+		d.attempt(hook, del)
+
+		err = d.Queue.UpdateDelivery(del)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return len(due), nil
+
+}
+
+// Prune deletes the finished deliveries that are older than the retention
+// period, or beyond the number kept for each webhook
+func (d *Dispatcher) Prune() error {
+	return d.Queue.PruneDeliveries(time.Now().Add(-d.DeliveryRetention), d.KeepDeliveries)
+}
+
+// attempt sends a delivery once and records the outcome on it
+func (d *Dispatcher) attempt(hook *Webhook, del *Delivery) {
+
+	now := time.Now()
+	del.Attempts++
+	del.Updated = now
+
+	// The webhook may have been deleted or disabled since the delivery was
+	// queued. There's nobody left to deliver to.
+	if hook == nil || !hook.Active {
+		del.Status = StatusFailed
+		del.LastError = "webhook no longer exists or is inactive"
+		return
+	}
+
+	code, err := d.send(hook, del)
+	del.ResponseCode = code
+	if err == nil {
+		del.Status = StatusSucceeded
+		del.LastError = ""
+		return
+	}
+
+	del.LastError = err.Error()
+	if del.Attempts >= d.MaxAttempts {
+		del.Status = StatusFailed
+		return
+	}
+	del.NextAttempt = now.Add(d.backoff(del.Attempts))
+
+}
+
+// send POSTs the payload to the webhook's URL
+func (d *Dispatcher) send(hook *Webhook, del *Delivery) (int, error) {
+
+	req, err := http.NewRequest("POST", hook.URL, bytes.NewReader(del.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, del.Event)
+	req.Header.Set(DeliveryHeader, strconv.FormatUint(del.ID, 10))
+	req.Header.Set(SignatureHeader, signaturePrefix+Sign(hook.Secret, del.Payload))
+
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("receiver responded with %s", resp.Status)
+	}
+
+	return resp.StatusCode, nil
+
+}
+
+// backoff returns how long to wait after the given number of failed attempts
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	wait := d.BaseBackoff
+	for i := 1; i < attempts; i++ {
+		wait *= 2
+		if wait >= d.MaxBackoff {
+			return d.MaxBackoff
+		}
+	}
+	return wait
+}
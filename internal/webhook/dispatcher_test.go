@@ -0,0 +1,247 @@
+package webhook_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/idrum4316/devpad-server/internal/event"
+	"github.com/idrum4316/devpad-server/internal/memstore"
+	"github.com/idrum4316/devpad-server/internal/webhook"
+)
+
+// receiver is a webhook receiver that fails the first <failures> requests
+type receiver struct {
+	mu       sync.Mutex
+	failures int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	body, _ := ioutil.ReadAll(r.Body)
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	rc.requests = append(rc.requests, r)
+	rc.bodies = append(rc.bodies, body)
+	if len(rc.requests) <= rc.failures {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+
+}
+
+func newDispatcher(t *testing.T, rc *receiver) (*webhook.Dispatcher, *memstore.MemStore, *webhook.Webhook) {
+
+	srv := httptest.NewServer(rc)
+	t.Cleanup(srv.Close)
+
+	store := memstore.New()
+	hook, err := webhook.New(srv.URL, []string{event.PageCreated})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.CreateWebhook(hook)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := webhook.NewDispatcher(store)
+	d.BaseBackoff = time.Millisecond
+	d.MaxBackoff = time.Millisecond
+	d.MaxAttempts = 3
+
+	return d, store, hook
+
+}
+
+func dispatch(t *testing.T, d *webhook.Dispatcher, eventType string) {
+	e := event.New(eventType, "someone")
+	e.Slug = "page"
+	err := d.Dispatch(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// processUntilDone attempts due deliveries until none are left, waiting out
+// the backoff between attempts
+func processUntilDone(t *testing.T, d *webhook.Dispatcher, store *memstore.MemStore) {
+	for i := 0; i < 100; i++ {
+		_, err := d.ProcessDue()
+		if err != nil {
+			t.Fatal(err)
+		}
+		due, err := store.DueDeliveries(time.Now().Add(time.Hour), 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(due) == 0 {
+			return
+		}
+		time.Sleep(2 * time.Millisecond)
+	}
+	t.Fatal("deliveries are still queued")
+}
+
+func TestDeliverySignature(t *testing.T) {
+
+	rc := &receiver{}
+	d, store, hook := newDispatcher(t, rc)
+
+	dispatch(t, d, event.PageCreated)
+	dispatch(t, d, event.PageDeleted)
+	processUntilDone(t, d, store)
+
+	if len(rc.requests) != 1 {
+		t.Fatalf("expected 1 request for the event the webhook wants, got %d",
+			len(rc.requests))
+	}
+
+	r := rc.requests[0]
+	if r.Header.Get(webhook.EventHeader) != event.PageCreated {
+		t.Fatalf("expected the %s header to be %q, got %q", webhook.EventHeader,
+			event.PageCreated, r.Header.Get(webhook.EventHeader))
+	}
+
+	signature := r.Header.Get(webhook.SignatureHeader)
+	if signature != "sha256="+webhook.Sign(hook.Secret, rc.bodies[0]) {
+		t.Fatalf("unexpected signature %q", signature)
+	}
+	if !webhook.Verify(hook.Secret, rc.bodies[0], signature) {
+		t.Fatal("Verify rejected the signature header")
+	}
+	if webhook.Verify("wrong", rc.bodies[0], signature) {
+		t.Fatal("Verify accepted a signature made with another secret")
+	}
+
+	log, err := store.ListDeliveries(hook.ID, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(log) != 1 || log[0].Status != webhook.StatusSucceeded ||
+		log[0].Attempts != 1 || log[0].ResponseCode != http.StatusOK {
+		t.Fatalf("expected one successful delivery to be recorded, got %+v", log)
+	}
+
+}
+
+func TestDeliveryRetry(t *testing.T) {
+
+	rc := &receiver{failures: 1}
+	d, store, hook := newDispatcher(t, rc)
+
+	dispatch(t, d, event.PageCreated)
+
+	n, err := d.ProcessDue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Fatalf("expected 1 delivery to be attempted, got %d", n)
+	}
+
+	log, err := store.ListDeliveries(hook.ID, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(log) != 1 || log[0].Status != webhook.StatusPending ||
+		log[0].ResponseCode != http.StatusInternalServerError || log[0].LastError == "" {
+		t.Fatalf("expected the failed attempt to be recorded, got %+v", log[0])
+	}
+	if !log[0].NextAttempt.After(log[0].Updated) {
+		t.Fatal("the retry wasn't put off")
+	}
+
+	processUntilDone(t, d, store)
+
+	log, err = store.ListDeliveries(hook.ID, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if log[0].Status != webhook.StatusSucceeded || log[0].Attempts != 2 {
+		t.Fatalf("expected the delivery to succeed on the second attempt, got %+v", log[0])
+	}
+	if len(rc.requests) != 2 {
+		t.Fatalf("expected 2 requests, got %d", len(rc.requests))
+	}
+
+}
+
+func TestDeliveryGivesUp(t *testing.T) {
+
+	rc := &receiver{failures: 100}
+	d, store, hook := newDispatcher(t, rc)
+
+	dispatch(t, d, event.PageCreated)
+	processUntilDone(t, d, store)
+
+	log, err := store.ListDeliveries(hook.ID, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if log[0].Status != webhook.StatusFailed || log[0].Attempts != d.MaxAttempts {
+		t.Fatalf("expected the delivery to fail after %d attempts, got %+v",
+			d.MaxAttempts, log[0])
+	}
+
+}
+
+func TestBackoff(t *testing.T) {
+
+	d := webhook.NewDispatcher(memstore.New())
+	d.BaseBackoff = time.Second
+	d.MaxBackoff = 5 * time.Second
+
+	rc := &receiver{failures: 100}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+
+	hook, err := webhook.New(srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = d.Queue.(*memstore.MemStore).CreateWebhook(hook)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dispatch(t, d, event.PageCreated)
+
+	// Each failure doubles the wait, up to the maximum
+	for _, expected := range []time.Duration{time.Second, 2 * time.Second,
+		4 * time.Second, 5 * time.Second} {
+
+		due, err := d.Queue.DueDeliveries(time.Now().Add(time.Hour), 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		del := due[0]
+		del.NextAttempt = time.Time{}
+		err = d.Queue.UpdateDelivery(del)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = d.ProcessDue()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		due, err = d.Queue.DueDeliveries(time.Now().Add(time.Hour), 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wait := due[0].NextAttempt.Sub(due[0].Updated)
+		if wait != expected {
+			t.Fatalf("after %d attempts, expected to wait %s, got %s",
+				due[0].Attempts, expected, wait)
+		}
+	}
+
+}
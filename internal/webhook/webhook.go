@@ -0,0 +1,120 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"strings"
+	"time"
+)
+
+// The states a delivery can be in
+const (
+	StatusPending   = "pending"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+)
+
+// Webhook is an admin-configured URL that receives event notifications
+type Webhook struct {
+	ID      string    `json:"id"`
+	URL     string    `json:"url"`
+	Secret  string    `json:"secret,omitempty"`
+	Events  []string  `json:"events"`
+	Active  bool      `json:"active"`
+	Created time.Time `json:"created"`
+}
+
+// Delivery is a single event queued for (or already sent to) a webhook
+type Delivery struct {
+	ID           uint64          `json:"id"`
+	WebhookID    string          `json:"webhook_id"`
+	Event        string          `json:"event"`
+	Payload      json.RawMessage `json:"payload"`
+	Status       string          `json:"status"`
+	Attempts     int             `json:"attempts"`
+	NextAttempt  time.Time       `json:"next_attempt"`
+	ResponseCode int             `json:"response_code,omitempty"`
+	LastError    string          `json:"last_error,omitempty"`
+	Created      time.Time       `json:"created"`
+	Updated      time.Time       `json:"updated"`
+}
+
+// New returns a new active webhook with a random ID and secret
+func New(url string, events []string) (*Webhook, error) {
+
+	id, err := randomHex(16)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := randomHex(32)
+	if err != nil {
+		return nil, err
+	}
+
+	w := Webhook{
+		ID:      id,
+		URL:     url,
+		Secret:  secret,
+		Events:  events,
+		Active:  true,
+		Created: time.Now(),
+	}
+
+	return &w, nil
+
+}
+
+// Wants returns true if the webhook is subscribed to the event type. A webhook
+// without any event filters receives every event.
+func (w *Webhook) Wants(eventType string) bool {
+
+	if !w.Active {
+		return false
+	}
+
+	if len(w.Events) == 0 {
+		return true
+	}
+
+	for _, e := range w.Events {
+		if e == eventType {
+			return true
+		}
+	}
+
+	return false
+
+}
+
+// Sign returns the hex encoded HMAC-SHA256 of the payload using the secret
+func Sign(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// The signature header names the hash before the signature, like
+// "sha256=<hex>"
+const signaturePrefix = "sha256="
+
+// Verify checks a signature produced by Sign. Receivers can use it to
+// authenticate deliveries, passing it the signature header as it is.
+func Verify(secret string, payload []byte, signature string) bool {
+	expected := Sign(secret, payload)
+	signature = strings.TrimPrefix(signature, signaturePrefix)
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	_, err := io.ReadFull(rand.Reader, b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -5,12 +5,11 @@ import (
 	"log"
 	"net/http"
 	"os"
-	"path"
+	"time"
 
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
-	"github.com/idrum4316/devpad-server/internal/datastore"
-	"github.com/idrum4316/devpad-server/internal/search"
+	"github.com/idrum4316/devpad-server/internal/collab"
 	"github.com/idrum4316/devpad-server/internal/user"
 )
 
@@ -27,23 +26,59 @@ func main() {
 		os.MkdirAll(appContext.Config.DataDir, 0700)
 	}
 
-	// Create and attach the Bolt datastore
-	store, err := datastore.New(path.Join(appContext.Config.DataDir, "devpad.db"))
+	// Run a command instead of the server if one was given
+	if len(os.Args) > 1 {
+		runCommand(appContext, os.Args[1:])
+		return
+	}
+
+	// Open the datastores and the search index
+	closeStores, err := appContext.openStores()
 	if err != nil {
 		log.Fatal(err)
 	}
-	appContext.Store = store
-	defer appContext.Store.Close()
+	defer closeStores()
+
+	// Trim old changes from the event log in the background
+	appContext.Events.Start()
+	defer appContext.Events.Stop()
+
+	// Start delivering webhooks in the background
+	appContext.Webhooks.Start()
+	defer appContext.Webhooks.Stop()
+
+	// Notify users about new pages that match their subscribed searches
+	appContext.Notifier.Start()
+	defer appContext.Notifier.Stop()
+
+	// Apply changes to the search index in the background
+	stopIndexer := appContext.startIndexer()
+	defer stopIndexer()
+
+	// Indexes built by older versions are missing newer fields. There's no
+	// point checking an index that's being rebuilt from the pages anyway.
+	if !appContext.rebuildOutdatedIndex() {
+		appContext.checkIndexOnStart()
+	}
 
-	// Create and attach the Bleve search index
-	index, err := search.NewIndex(path.Join(appContext.Config.DataDir, "pages.index"))
+	// Make backups on a schedule, if one is configured
+	stopBackups, err := appContext.startBackupScheduler()
 	if err != nil {
 		log.Fatal(err)
 	}
-	appContext.Index = index
-	defer appContext.Index.Close()
+	defer stopBackups()
+
+	// Periodically save pages that are being edited together
+	appContext.Collab = collab.NewManager(appContext.loadPageContents,
+		appContext.savePageSnapshot)
+	if appContext.Config.CollabSnapshotInterval > 0 {
+		appContext.Collab.SnapshotInterval =
+			time.Duration(appContext.Config.CollabSnapshotInterval) * time.Second
+	}
+	appContext.Collab.Start()
+	defer appContext.Collab.Stop()
 
-	userCount, err := appContext.Store.CountUsers()
+	userCount, err := appContext.Users.CountUsers()
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -53,7 +88,7 @@ func main() {
 			Admin: true,
 		}
 		u.SetPassword("admin")
-		err = appContext.Store.CreateUser(&u)
+		err = appContext.Users.CreateUser(&u)
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -67,16 +102,48 @@ func main() {
 	apiRouter := router.PathPrefix("/api").Subrouter()
 	apiRouter.Handle("", APIInfoHandler(appContext)).Methods("GET")
 	apiRouter.Handle("/pages", GetPagesHandler(appContext)).Methods("GET")
+	apiRouter.Handle("/pages/_bulk", BulkPagesHandler(appContext)).Methods("POST")
 	apiRouter.Handle("/pages/{slug}", GetPageHandler(appContext)).Methods("GET")
 	apiRouter.Handle("/pages/{slug}", PutPageHandler(appContext)).Methods("PUT")
 	apiRouter.Handle("/pages/{slug}", DeletePageHandler(appContext)).Methods("DELETE")
+	apiRouter.Handle("/pages/{slug}/collab", CollabHandler(appContext)).Methods("GET")
 	apiRouter.Handle("/pages/{slug}/rename", RenamePageHandler(appContext)).Methods("GET")
+	apiRouter.Handle("/pages/{slug}/related", RelatedPagesHandler(appContext)).Methods("GET")
+	apiRouter.Handle("/changes", GetChangesHandler(appContext)).Methods("GET")
+	apiRouter.Handle("/feed/pages/{slug}", FeedPageHandler(appContext)).Methods("GET")
+	apiRouter.Handle("/events", GetEventsHandler(appContext)).Methods("GET")
+	apiRouter.Handle("/export", ExportHandler(appContext)).Methods("GET")
+	apiRouter.Handle("/export/site", ExportSiteHandler(appContext)).Methods("GET")
+	apiRouter.Handle("/export/epub", ExportEPUBHandler(appContext)).Methods("GET")
+	apiRouter.Handle("/import", ImportHandler(appContext)).Methods("POST")
 	apiRouter.Handle("/search", SearchHandler(appContext)).Methods("GET")
+	apiRouter.Handle("/search", SearchDSLHandler(appContext)).Methods("POST")
+	apiRouter.Handle("/suggest", SuggestHandler(appContext)).Methods("GET")
+	apiRouter.Handle("/searches", GetSavedSearchesHandler(appContext)).Methods("GET")
+	apiRouter.Handle("/searches", CreateSavedSearchHandler(appContext)).Methods("POST")
+	apiRouter.Handle("/searches/{id}", GetSavedSearchHandler(appContext)).Methods("GET")
+	apiRouter.Handle("/searches/{id}", UpdateSavedSearchHandler(appContext)).Methods("PUT")
+	apiRouter.Handle("/searches/{id}", DeleteSavedSearchHandler(appContext)).Methods("DELETE")
+	apiRouter.Handle("/searches/{id}/results", RunSavedSearchHandler(appContext)).Methods("GET")
+	apiRouter.Handle("/notifications", GetNotificationsHandler(appContext)).Methods("GET")
+	apiRouter.Handle("/notifications", DeleteNotificationsHandler(appContext)).Methods("DELETE")
 	apiRouter.Handle("/tags", GetTagsHandler(appContext)).Methods("GET")
 	apiRouter.Handle("/preview", PostPreviewHandler(appContext)).Methods("POST")
 	apiRouter.Handle("/auth/token", GetAuthToken(appContext)).Methods("POST")
 	apiRouter.Handle("/account/password", ChangePasswordHandler(appContext)).Methods("POST")
 	apiRouter.Handle("/account/new", CreateUserHandler(appContext)).Methods("POST")
+	apiRouter.Handle("/account/feed-token", NewFeedTokenHandler(appContext)).Methods("POST")
+	apiRouter.Handle("/webhooks", GetWebhooksHandler(appContext)).Methods("GET")
+	apiRouter.Handle("/webhooks", CreateWebhookHandler(appContext)).Methods("POST")
+	apiRouter.Handle("/webhooks/{id}", DeleteWebhookHandler(appContext)).Methods("DELETE")
+	apiRouter.Handle("/webhooks/{id}/deliveries", GetWebhookDeliveriesHandler(appContext)).Methods("GET")
+	apiRouter.Handle("/admin/backup", BackupHandler(appContext)).Methods("GET")
+	apiRouter.Handle("/admin/backups", BackupStatusHandler(appContext)).Methods("GET")
+	apiRouter.Handle("/admin/metrics", MetricsHandler(appContext)).Methods("GET")
+	apiRouter.Handle("/admin/index/check", CheckIndexHandler(appContext, false)).Methods("GET")
+	apiRouter.Handle("/admin/index/repair", CheckIndexHandler(appContext, true)).Methods("POST")
+	apiRouter.Handle("/admin/reindex", GetReindexHandler(appContext)).Methods("GET")
+	apiRouter.Handle("/admin/reindex", StartReindexHandler(appContext)).Methods("POST")
 
 	// Serves static files
 	if appContext.Config.ServeStatic {
@@ -84,7 +151,7 @@ func main() {
 	}
 
 	// Start the server
-	loggedRouter := handlers.LoggingHandler(os.Stdout, router)
+	loggedRouter := RedactCredentials(handlers.LoggingHandler(os.Stdout, router))
 	host := appContext.Config.ListenHost
 	port := appContext.Config.Port
 	err = http.ListenAndServe(fmt.Sprintf("%s:%d", host, port), loggedRouter)
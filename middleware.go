@@ -1,17 +1,23 @@
 package main
 
 import (
+	"crypto/hmac"
 	"fmt"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
 	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/gorilla/mux"
 )
 
 // RequireAuth checks for a valid token before forwarding
 func RequireAuth(next http.Handler, a *AppContext) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
-		tokenHeader := r.Header.Get("jwt")
+		tokenHeader := requestToken(r)
 		if tokenHeader == "" {
 			w.WriteHeader(http.StatusUnauthorized)
 			w.Write(FormatError("unauthorized"))
@@ -33,7 +39,7 @@ func RequireAuth(next http.Handler, a *AppContext) http.Handler {
 		}
 
 		if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-			userExists, err := a.Store.UserExists(claims["userid"].(string))
+			userExists, err := a.Users.UserExists(claims["userid"].(string))
 			if !userExists || err != nil {
 				w.WriteHeader(http.StatusUnauthorized)
 				w.Write(FormatError("unauthorized"))
@@ -49,3 +55,140 @@ func RequireAuth(next http.Handler, a *AppContext) http.Handler {
 
 	})
 }
+
+// RequireAdmin checks that the token belongs to an admin user before
+// forwarding
+func RequireAdmin(next http.Handler, a *AppContext) http.Handler {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		userID, err := a.GetUserIDFromRequest(r)
+		if err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write(FormatError("unauthorized"))
+			return
+		}
+
+		u, err := a.Users.GetUser(userID)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write(FormatError("error accessing database"))
+			return
+		}
+
+		if u == nil || !u.Admin {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write(FormatError("you must be an admin to do that"))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+
+	})
+
+	return RequireAuth(handler, a)
+}
+
+// RequireAuthOrFeedToken lets the request through if it has a valid feed token
+// in the 'token' parameter, and checks for a valid JWT token otherwise. It
+// is meant for feeds that are read by feed readers.
+func RequireAuthOrFeedToken(next http.Handler, a *AppContext) http.Handler {
+	authed := RequireAuth(next, a)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		token := r.URL.Query().Get("token")
+		if token == "" {
+			authed.ServeHTTP(w, r)
+			return
+		}
+
+		u, err := a.Users.GetUserByFeedToken(token)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write(FormatError("error accessing database"))
+			return
+		}
+		if u == nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write(FormatError("unauthorized"))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+
+	})
+}
+
+// RequireAuthOrSignedLink lets the request through if it has a signature for
+// the page in its 'slug' variable that hasn't expired, as the links in feeds
+// do. Otherwise it checks for a feed token or a valid JWT token.
+func RequireAuthOrSignedLink(next http.Handler, a *AppContext) http.Handler {
+	authed := RequireAuthOrFeedToken(next, a)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		sig := r.URL.Query().Get("sig")
+		if sig == "" {
+			authed.ServeHTTP(w, r)
+			return
+		}
+
+		expires, err := strconv.ParseInt(r.URL.Query().Get("expires"), 10, 64)
+		if err != nil || time.Now().Unix() > expires {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write(FormatError("the link has expired"))
+			return
+		}
+
+		want := a.signFeedLink(mux.Vars(r)["slug"], expires)
+		if !hmac.Equal([]byte(sig), []byte(want)) {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write(FormatError("unauthorized"))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+
+	})
+}
+
+// redactedParams are the query string parameters that carry credentials.
+// Their values are left out of the request log.
+var redactedParams = []string{"jwt", "token", "sig"}
+
+// RedactCredentials hides the credentials in the query string from the
+// handlers after it (the request logger) by replacing them in the request's
+// RequestURI. The parsed URL is left alone, so the handlers can still read
+// them.
+func RedactCredentials(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		i := strings.Index(r.RequestURI, "?")
+		if i < 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		query, err := url.ParseQuery(r.RequestURI[i+1:])
+		if err != nil {
+			query = r.URL.Query()
+		}
+
+		redacted := false
+		for _, param := range redactedParams {
+			if _, ok := query[param]; ok {
+				query.Set(param, "REDACTED")
+				redacted = true
+			}
+		}
+		if !redacted {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		r2 := *r
+		r2.RequestURI = r.RequestURI[:i+1] + query.Encode()
+		next.ServeHTTP(w, &r2)
+
+	})
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"time"
+
+	"github.com/blevesearch/bleve"
+	"github.com/idrum4316/devpad-server/internal/savedsearch"
+	"github.com/idrum4316/devpad-server/internal/search"
+)
+
+// How many matching pages are read from the index at a time when checking a
+// subscription
+const savedSearchMatchBatch = 100
+
+// savedSearchRequest returns the search request that runs a saved search
+func savedSearchRequest(s *savedsearch.SavedSearch) *bleve.SearchRequest {
+
+	q := bleve.NewConjunctionQuery(pageQueries(s.Query, s.Tags)...)
+	req := bleve.NewSearchRequest(q)
+	req.Highlight = bleve.NewHighlight()
+	req.Fields = []string{"contents", "metadata.title", "metadata.tags", "metadata.modified"}
+	if len(s.Sort) > 0 {
+		req.SortBy(s.Sort)
+	}
+
+	return req
+
+}
+
+// matchSavedSearch returns the pages that match a saved search and were
+// changed from <since> up to <until>, as far as the search index knows. The
+// notifier makes pending changes searchable before it calls this.
+func (a *AppContext) matchSavedSearch(s *savedsearch.SavedSearch, since time.Time,
+	until time.Time) ([]*savedsearch.Match, error) {
+
+	queries := pageQueries(s.Query, s.Tags)
+	queries = append(queries, search.NewModifiedQuery(since, until))
+
+	matches := []*savedsearch.Match{}
+	for {
+		req := bleve.NewSearchRequestOptions(bleve.NewConjunctionQuery(queries...),
+			savedSearchMatchBatch, len(matches), false)
+		req.Fields = []string{"metadata.title", "metadata.modified"}
+		req.SortBy([]string{"metadata.modified", "_id"})
+
+		result, err := a.Index.ExecuteSearch(req)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, hit := range result.Hits {
+			title, _ := hit.Fields["metadata.title"].(string)
+			modified, _ := hit.Fields["metadata.modified"].(string)
+			m := savedsearch.Match{Slug: hit.ID, Title: title}
+			m.Modified, _ = time.Parse(time.RFC3339, modified)
+			matches = append(matches, &m)
+		}
+
+		if len(result.Hits) < savedSearchMatchBatch {
+			return matches, nil
+		}
+	}
+
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/idrum4316/devpad-server/internal/datastore"
+	"github.com/idrum4316/devpad-server/internal/event"
+	"github.com/idrum4316/devpad-server/internal/savedsearch"
+	"github.com/idrum4316/devpad-server/internal/search"
+	"github.com/idrum4316/devpad-server/internal/sqlstore"
+	"github.com/idrum4316/devpad-server/internal/storage"
+	"github.com/idrum4316/devpad-server/internal/webhook"
+)
+
+// openStores opens the datastores and the search index as configured, and
+// attaches them to the context along with the event broker, the webhook
+// dispatcher and the subscription notifier. None of them is started. The
+// returned function closes everything that was opened.
+func (a *AppContext) openStores() (func(), error) {
+
+	closers := []func(){}
+	closeAll := func() {
+		for i := len(closers) - 1; i >= 0; i-- {
+			closers[i]()
+		}
+	}
+
+	// Create and attach the Bolt datastore
+	store, err := datastore.New(path.Join(a.Config.DataDir, "devpad.db"))
+	if err != nil {
+		return nil, err
+	}
+	a.Meta = store
+	closers = append(closers, store.Close)
+
+	// Attach the store for pages and users
+	var pages storage.PageStore
+	switch a.Config.Storage {
+	case "bolt", "":
+		a.Users = store
+		pages = store
+	case "sqlite":
+		sqlStore, err := sqlstore.New(a.sqlitePath())
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		closers = append(closers, sqlStore.Close)
+		a.Users = sqlStore
+		pages = sqlStore
+	default:
+		closeAll()
+		return nil, fmt.Errorf("unknown Storage %q", a.Config.Storage)
+	}
+
+	// Create and attach the Bleve search index
+	index, err := search.NewIndex(a.indexPath(), a.searchAnalysis())
+	if err != nil {
+		closeAll()
+		return nil, err
+	}
+	a.Index = index
+	closers = append(closers, func() { a.Index.Close() })
+
+	// Keep a log of changes and send them to live subscribers. They have
+	// to be there before the file watcher starts, since it publishes the
+	// changes it finds.
+	a.Events = event.NewBroker(a.Meta)
+	a.Events.Retention = time.Duration(a.Config.EventRetentionDays) * 24 * time.Hour
+
+	// Webhooks are queued as events are published
+	a.Webhooks = webhook.NewDispatcher(a.Meta)
+
+	// Attach the page store
+	switch a.Config.PageStorage {
+	case "", "bolt":
+		a.Pages = pages
+	case "filesystem":
+		watcher, err := a.openFileStore()
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		closers = append(closers, func() { watcher.Close() })
+	default:
+		closeAll()
+		return nil, fmt.Errorf("unknown PageStorage %q", a.Config.PageStorage)
+	}
+
+	// Apply changes to the search index from the page store's outbox
+	a.Indexer = a.newIndexer()
+
+	// Subscribed searches are checked for new matches periodically
+	a.Notifier = savedsearch.NewNotifier(a.Meta, a.matchSavedSearch)
+	a.Notifier.Flush = a.flushIndex
+	if a.Config.SubscriptionInterval > 0 {
+		a.Notifier.Interval = time.Duration(a.Config.SubscriptionInterval) * time.Second
+	}
+
+	return closeAll, nil
+
+}